@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"establishment/v1/establishment/mail"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// GET /verify-email?token=
+//
+// This is the link mailed on registration, so it answers in plain text.
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /verify-email", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	token, ok := useOneTimeToken(ctx, w, r.URL.Query().Get("token"), models.PurposeVerifyEmail)
+	if !ok {
+		return
+	}
+	auditUser(r, token.UserID, "")
+	if err := db.SetEmailVerified(ctx, token.UserID); err != nil {
+		log.Printf("Failed to verify email of user %s: %v", token.UserID, err)
+		http.Error(w, "Failed to verify email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s verified their email address", token.UserID)
+	fmt.Fprintln(w, "Your email address is verified.")
+}
+
+// POST /verify-email/resend
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /verify-email/resend", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := currentUser(r)
+	if user.EmailVerified {
+		log.Printf("Email of user %s is already verified", user.Login)
+		http.Error(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Login, err)
+		http.Error(w, "Failed to send verification email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /forgot-password
+//
+// Mails a reset link if a user has the given email address. The response is
+// the same either way, so that it does not reveal which addresses are
+// registered.
+func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /forgot-password", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		log.Printf("Invalid input data in POST /forgot-password: %v", err)
+		http.Error(w, "An email address is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := db.GetUserByEmail(ctx, input.Email)
+	switch err {
+	case nil:
+		if err := sendPasswordReset(ctx, user); err != nil {
+			log.Printf("Failed to send password reset to %s: %v", user.Login, err)
+		}
+	case store.ErrNoSuchUser:
+		log.Printf("Password reset requested for unknown email %s", input.Email)
+	default:
+		log.Printf("Error fetching user by email: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /reset-password
+//
+// Sets a new password with the token from the reset link. Since the link
+// proves access to the mailbox, the address counts as verified afterwards;
+// every existing session of the user is signed out.
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /reset-password", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Invalid input data in POST /reset-password: %v", err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+	if input.Password == "" {
+		log.Printf("Missing password in POST /reset-password")
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	token, ok := useOneTimeToken(ctx, w, input.Token, models.PurposeResetPassword)
+	if !ok {
+		return
+	}
+	auditUser(r, token.UserID, "")
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Error hashing password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.SetPassword(ctx, token.UserID, string(hashedPassword)); err != nil {
+		log.Printf("Failed to reset password of user %s: %v", token.UserID, err)
+		http.Error(w, "Failed to reset password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.SetEmailVerified(ctx, token.UserID); err != nil {
+		log.Printf("Failed to verify email of user %s: %v", token.UserID, err)
+	}
+	if err := db.DeleteOneTimeTokens(ctx, token.UserID, models.PurposeResetPassword); err != nil {
+		log.Printf("Failed to delete reset tokens of user %s: %v", token.UserID, err)
+	}
+	if _, err := db.DeleteUserSessions(ctx, token.UserID, ""); err != nil {
+		log.Printf("Failed to sign out user %s: %v", token.UserID, err)
+	}
+	if user, err := db.GetUserByID(ctx, token.UserID); err == nil {
+		loginGuard.succeed(user.Login)
+	}
+
+	log.Printf("User %s reset their password", token.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// useOneTimeToken redeems a one-time token, writing the error response itself
+// when it is invalid, expired or already used.
+func useOneTimeToken(ctx context.Context, w http.ResponseWriter, secret, purpose string) (models.OneTimeToken, bool) {
+	if secret == "" {
+		log.Printf("Missing %s token", purpose)
+		http.Error(w, "Token required", http.StatusBadRequest)
+		return models.OneTimeToken{}, false
+	}
+
+	token, err := db.UseOneTimeToken(ctx, hashToken(secret), purpose, time.Now().Unix())
+	if err == store.ErrNoSuchOneTimeToken {
+		log.Printf("Invalid or expired %s token", purpose)
+		http.Error(w, "The token is invalid or has expired", http.StatusBadRequest)
+		return models.OneTimeToken{}, false
+	}
+	if err != nil {
+		log.Printf("Error using %s token: %v", purpose, err)
+		http.Error(w, "Error checking token: "+err.Error(), http.StatusInternalServerError)
+		return models.OneTimeToken{}, false
+	}
+	return token, true
+}
+
+// sendVerificationEmail mails the user a link that verifies their address,
+// replacing any link sent before.
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+	link, err := mailLink(ctx, user, models.PurposeVerifyEmail, verifyEmailTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %v.\n",
+			user.Login, link, verifyEmailTTL),
+	})
+}
+
+// sendPasswordReset mails the user a link to the page that sets a new
+// password, replacing any link sent before.
+func sendPasswordReset(ctx context.Context, user models.User) error {
+	link, err := mailLink(ctx, user, models.PurposeResetPassword, resetPasswordTTL, "/reset_password.html")
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nsomeone asked to reset your password. To choose a new one, open this link:\n\n%s\n\n"+
+			"The link expires in %v. If you did not ask for it, you can ignore this email.\n",
+			user.Login, link, resetPasswordTTL),
+	})
+}
+
+// mailLink stores a new one-time token for purpose, invalidating older ones,
+// and returns the link at path under PUBLIC_URL that carries it.
+func mailLink(ctx context.Context, user models.User, purpose string, ttl time.Duration, path string) (string, error) {
+	if err := db.DeleteOneTimeTokens(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+	secret, err := newOneTimeToken(ctx, user.ID, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+	return publicURL + path + "?token=" + url.QueryEscape(secret), nil
+}
+
+// newOneTimeToken stores a token for purpose that expires after ttl and
+// returns its secret.
+func newOneTimeToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = db.AddOneTimeToken(ctx, models.OneTimeToken{
+		Hash:      hashToken(secret),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// GET /admin/users
+func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /admin/users", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	users, err := db.GetUsers(ctx)
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		http.Error(w, "Error fetching users: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, users)
+}
+
+// /admin/users/:id/roles and /admin/users/:id/2fa
+func handleAdminUser(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/admin/users/")
+	section, rest, _ := strings.Cut(sub, "/")
+	switch {
+	case id != "" && section == "roles":
+		handleAdminUserRoles(w, r, id, rest)
+	case id != "" && section == "2fa" && rest == "":
+		handleAdminUserTwoFactor(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// POST /admin/users/:id/roles, DELETE /admin/users/:id/roles/:role
+func handleAdminUserRoles(w http.ResponseWriter, r *http.Request, id, role string) {
+	switch {
+	case r.Method == http.MethodPost && role == "":
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			log.Printf("Invalid input data in POST /admin/users/%s/roles: %v", id, err)
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		role = input.Role
+	case r.Method == http.MethodDelete && role != "":
+	default:
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only POST .../roles and DELETE .../roles/:role allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !models.ValidRole(role) {
+		log.Printf("Unknown role %q for user %s", role, id)
+		http.Error(w, "Role must be one of: "+strings.Join(models.Roles, ", "), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	var err error
+	if r.Method == http.MethodPost {
+		user, err = db.GrantRole(ctx, id, role)
+	} else {
+		if role == models.RoleAdmin && lastAdmin(ctx, w, id) {
+			return
+		}
+		user, err = db.RevokeRole(ctx, id, role)
+	}
+	if err == store.ErrNoSuchUser {
+		log.Printf("User not found for ID: %s", id)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update roles of user %s: %v", id, err)
+		http.Error(w, "Failed to update roles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if admin, ok := currentUser(r); ok {
+		log.Printf("User %s changed roles of %s to %v", admin.Login, user.Login, user.Roles)
+	}
+	writeJSON(w, user)
+}
+
+// DELETE /admin/users/:id/2fa
+//
+// Turns off two-factor authentication for a user who lost both their
+// authenticator and their recovery codes.
+func handleAdminUserTwoFactor(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.SetTOTP(ctx, id, "", false, nil); err != nil {
+		if err == store.ErrNoSuchUser {
+			log.Printf("User not found for ID: %s", id)
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to reset two-factor authentication of user %s: %v", id, err)
+		http.Error(w, "Failed to reset two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if admin, ok := currentUser(r); ok {
+		log.Printf("User %s reset two-factor authentication of %s", admin.Login, id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/settings, PUT /admin/settings
+func handleAdminSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := db.GetSettings(ctx)
+		if err != nil {
+			log.Printf("Error fetching settings: %v", err)
+			http.Error(w, "Error fetching settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, settings)
+	case http.MethodPut:
+		var settings models.Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			log.Printf("Invalid input data in PUT /admin/settings: %v", err)
+			http.Error(w, "Invalid input data", http.StatusBadRequest)
+			return
+		}
+		// Otherwise the admin would lose the rights needed to undo it.
+		admin, _ := currentUser(r)
+		if settings.Require2FAForEditors && !admin.TOTPEnabled {
+			log.Printf("Admin %s without two-factor authentication tried to require it", admin.Login)
+			http.Error(w, "Enable two-factor authentication for yourself first", http.StatusConflict)
+			return
+		}
+		if err := db.SaveSettings(ctx, settings); err != nil {
+			log.Printf("Failed to save settings: %v", err)
+			http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s changed settings to %+v", admin.Login, settings)
+		writeJSON(w, settings)
+	default:
+		log.Printf("Unsupported method %s for /admin/settings", r.Method)
+		http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// lastAdmin reports whether the user is the only admin left, writing the
+// error response itself when it is or when the check fails.
+func lastAdmin(ctx context.Context, w http.ResponseWriter, userID string) bool {
+	users, err := db.GetUsers(ctx)
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		http.Error(w, "Error fetching users: "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	for _, user := range users {
+		if user.ID != userID && slices.Contains(user.Roles, models.RoleAdmin) {
+			return false
+		}
+	}
+	log.Printf("Refusing to revoke admin role of the last admin %s", userID)
+	http.Error(w, "Cannot revoke the admin role of the last admin", http.StatusConflict)
+	return true
+}
+
+// bootstrapAdmin grants the admin role to the user with the given login, so
+// that installations whose users predate roles can be administered.
+func bootstrapAdmin(ctx context.Context, login string) error {
+	user, err := db.GetUserByLogin(ctx, login)
+	if err == store.ErrNoSuchUser {
+		log.Printf("Warning: ADMIN_LOGIN user %s does not exist yet", login)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := db.GrantRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		return err
+	}
+	log.Printf("Granted admin role to %s", login)
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader   = "X-Request-ID"
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditedReads are GET endpoints audited like writes because they sign
+// users in, change their account or hand out secrets.
+var auditedReads = map[string]bool{
+	"/oidc/callback": true,
+	"/verify-email":  true,
+	"/admin/backup":  true,
+}
+
+// auditTargets maps the routes of single entities to the entity type
+// recorded as the target of their audit entries.
+var auditTargets = []struct {
+	prefix     string
+	entityType string
+}{
+	{"/person/", models.EntityPerson},
+	{"/relationship/", models.EntityRelationship},
+	{"/source/", "source"},
+	{"/proposal/", "proposal"},
+	{"/token/", "token"},
+	{"/session/", "session"},
+	{"/admin/users/", "user"},
+}
+
+// auditParams names the IDs that follow sub-resources in routes such as
+// DELETE /person/:id/sources/:source_id.
+var auditParams = map[string]string{
+	"sources": ":source_id",
+	"roles":   ":role",
+}
+
+// validRequestID limits the request IDs accepted from clients or proxies to
+// ones that are safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type auditKey struct{}
+
+// auditRecord collects what handlers learn about a request for its audit
+// entry.
+type auditRecord struct {
+	userID string
+	login  string
+	target *models.EntityRef
+}
+
+// auditRequests assigns every request an ID, echoed in the X-Request-ID
+// response header, and appends an entry to the audit log for each request
+// that may change something, once it has been answered.
+func auditRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if !auditedReads[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		case http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &auditRecord{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditKey{}, record)))
+
+		action, target := auditAction(r.Method, r.URL.Path)
+		if record.target != nil {
+			target = record.target
+		}
+		entry := models.AuditEntry{
+			ID:        uuid.New().String(),
+			CreatedAt: time.Now().Unix(),
+			UserID:    record.userID,
+			Login:     record.login,
+			Action:    action,
+			Target:    target,
+			IP:        clientIP(r),
+			RequestID: requestID,
+			Outcome:   auditOutcome(recorder.status),
+			Status:    recorder.status,
+		}
+
+		// The request context may already be cancelled; the entry must be
+		// stored regardless.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := db.AddAuditEntry(ctx, entry); err != nil {
+			log.Printf("Error writing audit entry for %s %s (request %s): %v", r.Method, r.URL.Path, requestID, err)
+		}
+	})
+}
+
+// auditUser attributes the audit entry of r to a user. userID is empty when
+// only the login is known, as for failed logins.
+func auditUser(r *http.Request, userID, login string) {
+	if record, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		record.userID, record.login = userID, login
+	}
+}
+
+// auditTarget records the entity r acted on, for requests such as creations
+// whose path does not name it.
+func auditTarget(r *http.Request, entityType, id string) {
+	if record, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		record.target = &models.EntityRef{Type: entityType, ID: id}
+	}
+}
+
+// auditAction names the route of a request, with IDs replaced by
+// placeholders, and derives its target from the ID in the path.
+func auditAction(method, path string) (string, *models.EntityRef) {
+	for _, t := range auditTargets {
+		if !strings.HasPrefix(path, t.prefix) {
+			continue
+		}
+		id, sub := resourcePath(path, t.prefix)
+		if id == "" {
+			break
+		}
+		route := t.prefix + ":id"
+		if sub != "" {
+			section, param, found := strings.Cut(sub, "/")
+			route += "/" + section
+			if found {
+				if name, ok := auditParams[section]; ok {
+					param = name
+				}
+				route += "/" + param
+			}
+		}
+		return method + " " + route, &models.EntityRef{Type: t.entityType, ID: id}
+	}
+	return method + " " + strings.TrimSuffix(path, "/"), nil
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return models.OutcomeSuccess
+	case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusTooManyRequests:
+		return models.OutcomeDenied
+	default:
+		return models.OutcomeFailure
+	}
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// GET /admin/audit
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /admin/audit", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		log.Printf("Invalid query in GET /admin/audit: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entries, err := db.GetAuditEntries(ctx, query)
+	if err != nil {
+		log.Printf("Error fetching audit log: %v", err)
+		http.Error(w, "Error fetching audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, entries)
+}
+
+// parseAuditQuery reads the user, action, since, until and limit
+// parameters of GET /admin/audit. Both dates are inclusive.
+func parseAuditQuery(r *http.Request) (models.AuditQuery, error) {
+	params := r.URL.Query()
+	query := models.AuditQuery{User: params.Get("user"), Action: params.Get("action")}
+
+	var err error
+	query.Limit, err = parseLimit(params.Get("limit"), defaultAuditLimit, maxAuditLimit)
+	if err != nil {
+		return models.AuditQuery{}, fmt.Errorf("invalid limit: %w", err)
+	}
+
+	if value := params.Get("since"); value != "" {
+		since, err := parseTimestamp(value)
+		if err != nil {
+			return models.AuditQuery{}, fmt.Errorf("invalid since %q: use YYYY-MM-DD or RFC 3339", value)
+		}
+		query.Since = since.Unix()
+	}
+	if value := params.Get("until"); value != "" {
+		until, err := parseTimestamp(value)
+		if err != nil {
+			return models.AuditQuery{}, fmt.Errorf("invalid until %q: use YYYY-MM-DD or RFC 3339", value)
+		}
+		// A date stands for the whole day, up to its last second.
+		if len(value) == len(time.DateOnly) {
+			until = until.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		query.Until = until.Unix()
+	}
+	return query, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"establishment/v1/establishment/models"
+)
+
+func TestParseAuditQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		since time.Time
+		until time.Time
+		limit int
+		ok    bool
+	}{
+		{"", time.Time{}, time.Time{}, defaultAuditLimit, true},
+		{"since=2024-05-01&until=2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 23, 59, 59, 0, time.UTC), defaultAuditLimit, true},
+		{"until=2024-05-01T12:00:00Z&limit=10", time.Time{}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), 10, true},
+		{"since=yesterday", time.Time{}, time.Time{}, 0, false},
+		{"until=2024-13-01", time.Time{}, time.Time{}, 0, false},
+		{"limit=0", time.Time{}, time.Time{}, 0, false},
+	}
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	for _, tt := range tests {
+		query, err := parseAuditQuery(httptest.NewRequest(http.MethodGet, "/admin/audit?"+tt.query, nil))
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error = %v, want ok = %v", tt.query, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if query.Since != unix(tt.since) || query.Until != unix(tt.until) || query.Limit != tt.limit {
+			t.Errorf("%q: since %d, until %d, limit %d, want %d, %d, %d", tt.query, query.Since, query.Until, query.Limit, unix(tt.since), unix(tt.until), tt.limit)
+		}
+	}
+}
+
+func TestAuditRateLimited(t *testing.T) {
+	s := newLimitedTestServer(t, newRateLimiter(rateLimit{requests: 1, period: time.Minute}), nil)
+	c := s.client()
+	person := models.Person{ID: "p1", Name: "Pat"}
+	c.expect(http.StatusUnauthorized, http.MethodPost, "/person", person, nil)
+	c.expect(http.StatusTooManyRequests, http.MethodPost, "/person", person, nil)
+
+	entries, err := db.GetAuditEntries(context.Background(), models.AuditQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Status != http.StatusTooManyRequests || entries[0].Outcome != models.OutcomeDenied {
+		t.Errorf("audit log = %+v, want the refused request first", entries)
+	}
+}
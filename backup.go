@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"establishment/v1/establishment/backup"
+)
+
+const backupTimeout = 5 * time.Minute
+
+// GET /admin/backup
+//
+// Downloads a backup archive of persons, relationships, users and sources;
+// restore it with the restore command. The archive holds password hashes
+// and two-factor secrets, so downloads are audited.
+func handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /admin/backup", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+	defer cancel()
+
+	// The archive is built in memory so that errors can still be reported
+	// with a status.
+	var buf bytes.Buffer
+	manifest, err := backup.Write(ctx, db, &buf)
+	if err != nil {
+		log.Printf("Error writing backup: %v", err)
+		http.Error(w, "Error writing backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, _ := currentUser(r)
+	log.Printf("User %s downloaded a backup of %d persons, %d relationships, %d users and %d sources", user.Login,
+		manifest.Counts[backup.SectionPersons], manifest.Counts[backup.SectionRelationships],
+		manifest.Counts[backup.SectionUsers], manifest.Counts[backup.SectionSources])
+
+	name := "establishment-" + time.Unix(manifest.CreatedAt, 0).UTC().Format("20060102-150405") + ".ndjson.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error sending backup: %v", err)
+	}
+}
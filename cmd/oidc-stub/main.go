@@ -0,0 +1,246 @@
+// Command oidc-stub is a minimal OpenID Connect provider for trying out and
+// testing sign-in locally. It signs in every authorization request as the
+// user given by its flags, without asking anything, and enforces PKCE.
+//
+//	go run ./cmd/oidc-stub -addr 127.0.0.1:9000 -email alice@example.test
+//	OIDC_ISSUER=http://127.0.0.1:9000 OIDC_CLIENT_ID=establishment go run .
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"establishment/v1/establishment/oidc"
+)
+
+// grant is an issued authorization code waiting to be redeemed.
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	expiresAt   time.Time
+}
+
+type provider struct {
+	issuer   string
+	clientID string
+	claims   map[string]interface{}
+	key      *rsa.PrivateKey
+	// keyID changes with the key on every start, so that clients refetch
+	// the key set instead of using a key they cached from an earlier run.
+	keyID string
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "address to listen on")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	clientID := flag.String("client-id", "establishment", "the only client ID accepted")
+	subject := flag.String("sub", "stub-user", "subject of the signed-in user")
+	email := flag.String("email", "stub-user@example.test", "email address of the signed-in user")
+	emailVerified := flag.Bool("email-verified", true, "whether the email address is verified")
+	username := flag.String("username", "stub-user", "preferred username of the signed-in user")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Error generating signing key: %v", err)
+	}
+
+	p := &provider{
+		issuer:   *issuer,
+		clientID: *clientID,
+		claims: map[string]interface{}{
+			"sub":                *subject,
+			"email":              *email,
+			"email_verified":     *emailVerified,
+			"preferred_username": *username,
+		},
+		key:    key,
+		grants: make(map[string]grant),
+	}
+	thumbprint := sha256.Sum256(key.N.Bytes())
+	p.keyID = base64.RawURLEncoding.EncodeToString(thumbprint[:8])
+
+	http.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	http.HandleFunc("/authorize", p.handleAuthorize)
+	http.HandleFunc("/token", p.handleToken)
+	http.HandleFunc("/jwks", p.handleJWKS)
+
+	log.Printf("Stub OIDC provider for %s listening on %s as issuer %s", *subject, *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func (p *provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case query.Get("client_id") != p.clientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.grants[code] = grant{
+		clientID:    p.clientID,
+		redirectURI: redirectURI.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	log.Printf("Authorized %s for client %s", p.claims["sub"], p.clientID)
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !ok || time.Now().After(g.expiresAt) || clientID != g.clientID ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		log.Printf("Rejected code_verifier for client %s", clientID)
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.issuer,
+		"aud":   g.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": g.nonce,
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+	idToken, err := p.sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "stub",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// sign returns claims as an RS256 JSON Web Token.
+func (p *provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"establishment/v1/establishment/backup"
+	"establishment/v1/establishment/csvimport"
+	"establishment/v1/establishment/graphimport"
+	"establishment/v1/establishment/store"
+)
+
+// commands are run instead of the server when named as the first argument,
+// e.g. "establishment import-csv -persons persons.csv". They use the store
+// configured by the same environment variables as the server.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"import-csv":   runImportCSV,
+	"import-graph": runImportGraph,
+	"backup":       runBackup,
+	"restore":      runRestore,
+}
+
+func runCommand(ctx context.Context, name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return command(ctx, args)
+}
+
+func runImportCSV(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import-csv", flag.ExitOnError)
+	personsPath := flags.String("persons", "", "persons CSV file")
+	relationshipsPath := flags.String("relationships", "", "relationships CSV file")
+	personsMapping := flags.String("persons-mapping", "", "columns of person fields, as field=Column,...")
+	relationshipsMapping := flags.String("relationships-mapping", "", "columns of relationship fields, as field=Column,...")
+	dryRun := flags.Bool("dry-run", false, "only validate the rows")
+	batchSize := flags.Int("batch-size", csvimport.DefaultBatchSize, "rows committed per transaction")
+	author := flags.String("author", "", "login of the user the revisions are attributed to")
+	flags.Parse(args)
+
+	if *personsPath == "" && *relationshipsPath == "" {
+		return fmt.Errorf("-persons or -relationships is required")
+	}
+	opts := csvimport.Options{DryRun: *dryRun, BatchSize: *batchSize}
+	var err error
+	if opts.PersonMapping, err = csvimport.ParseMapping(*personsMapping); err != nil {
+		return fmt.Errorf("-persons-mapping: %w", err)
+	}
+	if opts.RelationshipMapping, err = csvimport.ParseMapping(*relationshipsMapping); err != nil {
+		return fmt.Errorf("-relationships-mapping: %w", err)
+	}
+
+	var persons, relationships io.Reader
+	if *personsPath != "" {
+		file, err := os.Open(*personsPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		persons = file
+	}
+	if *relationshipsPath != "" {
+		file, err := os.Open(*relationshipsPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		relationships = file
+	}
+
+	st, err := openImportStore(ctx, "import-csv", *dryRun, "POST /import/csv")
+	if err != nil {
+		return err
+	}
+	defer st.Close(ctx)
+
+	if ctx, err = withAuthorLogin(ctx, st, *author); err != nil {
+		return err
+	}
+
+	report, err := csvimport.Import(ctx, st, persons, relationships, opts)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	switch {
+	case !report.Valid:
+		return fmt.Errorf("nothing imported: some rows are invalid")
+	case report.Error != "":
+		return fmt.Errorf("import failed: %s", report.Error)
+	}
+	return nil
+}
+
+func runImportGraph(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import-graph", flag.ExitOnError)
+	path := flags.String("file", "", "GraphML or GEXF file")
+	format := flags.String("format", "", "graphml or gexf (default from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "only validate the nodes and edges")
+	batchSize := flags.Int("batch-size", graphimport.DefaultBatchSize, "changes committed per transaction")
+	author := flags.String("author", "", "login of the user the revisions are attributed to")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("-file is required")
+	}
+	if *format == "" {
+		*format = strings.ToLower(strings.TrimPrefix(filepath.Ext(*path), "."))
+	}
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	doc, err := graphimport.Read(*format, file)
+	if err != nil {
+		return err
+	}
+
+	st, err := openImportStore(ctx, "import-graph", *dryRun, "POST /import/graphml or /import/gexf")
+	if err != nil {
+		return err
+	}
+	defer st.Close(ctx)
+
+	if ctx, err = withAuthorLogin(ctx, st, *author); err != nil {
+		return err
+	}
+
+	report, err := graphimport.Import(ctx, st, doc, graphimport.Options{DryRun: *dryRun, BatchSize: *batchSize})
+	if err != nil {
+		return err
+	}
+	if err := printJSON(report); err != nil {
+		return err
+	}
+	switch {
+	case !report.Valid:
+		return fmt.Errorf("nothing imported: some nodes or edges are invalid")
+	case report.Error != "":
+		return fmt.Errorf("import failed: %s", report.Error)
+	}
+	return nil
+}
+
+func runBackup(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	path := flags.String("out", "", "archive file to write, e.g. backup.ndjson.gz")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("-out is required")
+	}
+	st, err := openDatabase(ctx, "backup", "back up a running server with GET /admin/backup")
+	if err != nil {
+		return err
+	}
+	defer st.Close(ctx)
+
+	file, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Write(ctx, st, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*path)
+		return err
+	}
+	return printJSON(manifest)
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	path := flags.String("in", "", "archive file written by backup")
+	author := flags.String("author", "", "login of an archived user the revisions are attributed to")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("-in is required")
+	}
+	st, err := openDatabase(ctx, "restore", "start the server with RESTORE_FROM")
+	if err != nil {
+		return err
+	}
+	defer st.Close(ctx)
+
+	manifest, err := restoreFile(ctx, st, *path, *author)
+	if err != nil {
+		return err
+	}
+	return printJSON(manifest)
+}
+
+// restoreFile loads the archive at path into the empty store st, as
+// backup.Restore does.
+func restoreFile(ctx context.Context, st store.Store, path, author string) (backup.Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	defer file.Close()
+	return backup.Restore(ctx, st, file, author)
+}
+
+// openDatabase opens the configured store for a command that is pointless
+// without a database: the memory backend would give it a store of its own
+// that starts empty and is gone when the command exits. instead tells how
+// to do the same with the memory backend.
+func openDatabase(ctx context.Context, command, instead string) (store.Store, error) {
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		return nil, fmt.Errorf("%s needs the neo4j backend, STORE_BACKEND=memory only lasts as long as one process (%s instead)", command, instead)
+	}
+	return openStore(ctx)
+}
+
+// openImportStore is openDatabase for the import commands, which can still
+// check files against the empty memory store with -dry-run.
+func openImportStore(ctx context.Context, command string, dryRun bool, endpoint string) (store.Store, error) {
+	if dryRun {
+		return openStore(ctx)
+	}
+	return openDatabase(ctx, command, "use -dry-run, or "+endpoint+" on a running server,")
+}
+
+// withAuthorLogin attributes the revisions made with ctx to the user with
+// the given login, if any.
+func withAuthorLogin(ctx context.Context, st store.Store, login string) (context.Context, error) {
+	if login == "" {
+		return ctx, nil
+	}
+	user, err := st.GetUserByLogin(ctx, login)
+	if err != nil {
+		return ctx, fmt.Errorf("author %s: %w", login, err)
+	}
+	return store.WithAuthor(ctx, user.ID), nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
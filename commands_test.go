@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"establishment/v1/establishment/backup"
+	"establishment/v1/establishment/memory"
+	"establishment/v1/establishment/models"
+)
+
+func TestCommandsRefuseMemoryBackend(t *testing.T) {
+	t.Setenv("STORE_BACKEND", "memory")
+	dir := t.TempDir()
+	persons := filepath.Join(dir, "persons.csv")
+	if err := os.WriteFile(persons, []byte("id,name\na,Alice\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"backup", "-out", filepath.Join(dir, "backup.ndjson.gz")}, false},
+		{[]string{"restore", "-in", filepath.Join(dir, "backup.ndjson.gz")}, false},
+		{[]string{"import-csv", "-persons", persons}, false},
+		{[]string{"import-csv", "-persons", persons, "-dry-run"}, true},
+	}
+	for _, tt := range tests {
+		err := runCommand(context.Background(), tt.args[0], tt.args[1:])
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok = %v", strings.Join(tt.args, " "), err, tt.ok)
+		}
+	}
+}
+
+func TestRestoreFile(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore()
+	if err := st.AddPerson(ctx, models.Person{ID: "a", Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "backup.ndjson.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.Write(ctx, st, file); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := memory.NewStore()
+	if _, err := restoreFile(ctx, restored, path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if person, err := restored.GetPerson(ctx, "a"); err != nil || person.Name != "Alice" {
+		t.Errorf("restored person = %+v, %v", person, err)
+	}
+	if _, err := restoreFile(ctx, restored, path, ""); err == nil {
+		t.Error("restoring into a store that is not empty succeeded")
+	}
+}
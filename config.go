@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationEnv reads a positive duration such as "10m" from the environment
+// variable name, or returns def when it is unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
+
+// intEnv reads a positive integer from the environment variable name, or
+// returns def when it is unset.
+func intEnv(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return n, nil
+}
+
+// rateEnv reads a rate limit written as "<requests>/<period>", e.g. "300/1m",
+// from the environment variable name, or returns def when it is unset. "off"
+// disables the limit and is returned as a zero limit.
+func rateEnv(name string, def rateLimit) (rateLimit, error) {
+	value := os.Getenv(name)
+	switch value {
+	case "":
+		return def, nil
+	case "off":
+		return rateLimit{}, nil
+	}
+	count, period, _ := strings.Cut(value, "/")
+	n, err := strconv.Atoi(count)
+	if err == nil && n <= 0 {
+		err = fmt.Errorf("request count must be positive")
+	}
+	var d time.Duration
+	if err == nil {
+		d, err = time.ParseDuration(period)
+	}
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("period must be positive")
+	}
+	if err != nil {
+		return rateLimit{}, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return rateLimit{requests: n, period: d}, nil
+}
@@ -0,0 +1,503 @@
+// Package backup dumps the persons, relationships, users and sources of a
+// store to a portable archive and restores them into an empty store of any
+// backend.
+//
+// An archive is gzip-compressed NDJSON: a header line with the format
+// version, one line per record, section by section, and a trailer line with
+// the number of records and the SHA-256 checksum of the lines of each
+// section. Records are sorted by ID, so that a restored store dumps to the
+// same lines and checksums as the archive it came from. Revision history,
+// proposals, sessions, tokens, settings and the audit log are not backed up.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+const (
+	// Format identifies backup archives in their header.
+	Format = "establishment-backup"
+	// Version is the version of the archive format written by Write; Restore
+	// reads archives up to this version.
+	Version = 1
+)
+
+// restoreBatchSize is the number of persons and relationships restored per
+// transaction.
+const restoreBatchSize = 500
+
+// Section names, in the order they are written and restored in.
+const (
+	SectionSources       = "sources"
+	SectionUsers         = "users"
+	SectionPersons       = "persons"
+	SectionRelationships = "relationships"
+)
+
+// sections pairs every section with the kind of its record lines.
+var sections = []struct {
+	name string
+	kind string
+}{
+	{SectionSources, "source"},
+	{SectionUsers, "user"},
+	{SectionPersons, "person"},
+	{SectionRelationships, "relationship"},
+}
+
+const (
+	kindHeader  = "header"
+	kindTrailer = "trailer"
+)
+
+// ErrNotEmpty is returned by Restore for stores that already hold data.
+var ErrNotEmpty = errors.New("the store is not empty")
+
+// Manifest summarises an archive.
+type Manifest struct {
+	Version   int   `json:"version"`
+	CreatedAt int64 `json:"created_at"`
+	// Counts and Checksums are keyed by section name. Checksums are the
+	// hex-encoded SHA-256 of the record lines of the section, newlines
+	// included.
+	Counts    map[string]int    `json:"counts"`
+	Checksums map[string]string `json:"checksums"`
+}
+
+// line is one line of an archive. Which fields are set depends on Kind.
+type line struct {
+	Kind string `json:"kind"`
+
+	// Header fields.
+	Format    string `json:"format,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+
+	Record json.RawMessage `json:"record,omitempty"`
+
+	// Trailer fields.
+	Counts    map[string]int    `json:"counts,omitempty"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// user is the archived form of a models.User, including the password hash
+// and the other secrets models.User keeps out of JSON.
+type user struct {
+	ID            string   `json:"id"`
+	Login         string   `json:"login"`
+	Email         string   `json:"email"`
+	PasswordHash  string   `json:"password_hash,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	TOTPSecret    string   `json:"totp_secret,omitempty"`
+	TOTPEnabled   bool     `json:"totp_enabled,omitempty"`
+	TOTPCounter   int64    `json:"totp_counter,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	OIDCIdentity  string   `json:"oidc_identity,omitempty"`
+}
+
+func fromUser(u models.User) user {
+	return user{
+		ID:            u.ID,
+		Login:         u.Login,
+		Email:         u.Email,
+		PasswordHash:  u.Password,
+		Roles:         u.Roles,
+		EmailVerified: u.EmailVerified,
+		TOTPSecret:    u.TOTPSecret,
+		TOTPEnabled:   u.TOTPEnabled,
+		TOTPCounter:   u.TOTPCounter,
+		RecoveryCodes: u.RecoveryCodes,
+		OIDCIdentity:  u.OIDCIdentity,
+	}
+}
+
+func (u user) toUser() models.User {
+	return models.User{
+		ID:            u.ID,
+		Login:         u.Login,
+		Email:         u.Email,
+		Password:      u.PasswordHash,
+		Roles:         u.Roles,
+		EmailVerified: u.EmailVerified,
+		TOTPSecret:    u.TOTPSecret,
+		TOTPEnabled:   u.TOTPEnabled,
+		TOTPCounter:   u.TOTPCounter,
+		RecoveryCodes: u.RecoveryCodes,
+		OIDCIdentity:  u.OIDCIdentity,
+	}
+}
+
+// Write dumps st to w as an archive and returns its manifest.
+func Write(ctx context.Context, st store.Store, w io.Writer) (Manifest, error) {
+	lines, err := dump(ctx, st)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := summarize(lines)
+	manifest.Version = Version
+	manifest.CreatedAt = time.Now().Unix()
+
+	gz := gzip.NewWriter(w)
+	header, err := json.Marshal(line{Kind: kindHeader, Format: Format, Version: Version, CreatedAt: manifest.CreatedAt})
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := gz.Write(append(header, '\n')); err != nil {
+		return Manifest{}, err
+	}
+	for _, section := range sections {
+		for _, l := range lines[section.name] {
+			if _, err := gz.Write(l); err != nil {
+				return Manifest{}, err
+			}
+		}
+	}
+	trailer, err := json.Marshal(line{Kind: kindTrailer, Counts: manifest.Counts, Checksums: manifest.Checksums})
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := gz.Write(append(trailer, '\n')); err != nil {
+		return Manifest{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// Restore loads an archive into st, which must be empty, and returns its
+// manifest. The archive is checked against the counts and checksums of its
+// trailer before anything is written, and st is checked against them once
+// everything is. A restore that fails part way leaves what it wrote so far,
+// so st must be emptied before trying again.
+//
+// The revision history is not archived, so every restored person and
+// relationship starts a new one with a "created" revision. It is attributed
+// to the archived user with the login author, or to nobody if author is "".
+func Restore(ctx context.Context, st store.Store, r io.Reader, author string) (Manifest, error) {
+	manifest, lines, err := read(r)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if author != "" {
+		authorID, err := archivedUserID(lines, author)
+		if err != nil {
+			return Manifest{}, err
+		}
+		ctx = store.WithAuthor(ctx, authorID)
+	}
+	if err := checkEmpty(ctx, st); err != nil {
+		return Manifest{}, err
+	}
+
+	if err := load(ctx, st, lines); err != nil {
+		return Manifest{}, err
+	}
+
+	restored, err := dump(ctx, st)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read back the restored data: %w", err)
+	}
+	if err := compare(manifest, summarize(restored)); err != nil {
+		return Manifest{}, fmt.Errorf("restored data does not match the archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// dump encodes the records of every section as archive lines, sorted by ID.
+func dump(ctx context.Context, st store.Store) (map[string][][]byte, error) {
+	sources, err := st.GetSources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources: %w", err)
+	}
+	users, err := st.GetUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	graph, err := st.GetGraph(ctx, models.GraphFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	slices.SortFunc(sources, func(a, b models.Source) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(users, func(a, b models.User) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(graph.Nodes, func(a, b models.Person) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(graph.Edges, func(a, b models.Relationship) int { return strings.Compare(a.ID, b.ID) })
+
+	lines := make(map[string][][]byte, len(sections))
+	add := func(section string, record interface{}) error {
+		l, err := recordLine(section, record)
+		if err != nil {
+			return err
+		}
+		lines[section] = append(lines[section], l)
+		return nil
+	}
+	for _, source := range sources {
+		if err := add(SectionSources, source); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range users {
+		if err := add(SectionUsers, fromUser(u)); err != nil {
+			return nil, err
+		}
+	}
+	for _, person := range graph.Nodes {
+		if err := add(SectionPersons, person); err != nil {
+			return nil, err
+		}
+	}
+	for _, rel := range graph.Edges {
+		if err := add(SectionRelationships, rel); err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// recordLine encodes record as a line of the given section, newline
+// included.
+func recordLine(section string, record interface{}) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	l, err := json.Marshal(line{Kind: kindOf(section), Record: data})
+	if err != nil {
+		return nil, err
+	}
+	return append(l, '\n'), nil
+}
+
+func kindOf(section string) string {
+	for _, s := range sections {
+		if s.name == section {
+			return s.kind
+		}
+	}
+	return ""
+}
+
+func sectionOf(kind string) string {
+	for _, s := range sections {
+		if s.kind == kind {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// summarize counts and checksums the lines of every section.
+func summarize(lines map[string][][]byte) Manifest {
+	manifest := Manifest{Counts: make(map[string]int), Checksums: make(map[string]string)}
+	for _, section := range sections {
+		hash := sha256.New()
+		for _, l := range lines[section.name] {
+			hash.Write(l)
+		}
+		manifest.Counts[section.name] = len(lines[section.name])
+		manifest.Checksums[section.name] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return manifest
+}
+
+// compare reports the first section whose count or checksum in got differs
+// from want.
+func compare(want, got Manifest) error {
+	for _, section := range sections {
+		if got.Counts[section.name] != want.Counts[section.name] {
+			return fmt.Errorf("%s: expected %d records, found %d", section.name, want.Counts[section.name], got.Counts[section.name])
+		}
+		if got.Checksums[section.name] != want.Checksums[section.name] {
+			return fmt.Errorf("%s: checksum mismatch", section.name)
+		}
+	}
+	return nil
+}
+
+// read reads and checks a whole archive, returning its manifest and the
+// record lines of every section.
+func read(r io.Reader) (Manifest, map[string][][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	reader := bufio.NewReader(gz)
+
+	var manifest Manifest
+	lines := make(map[string][][]byte, len(sections))
+	for n := 1; ; n++ {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(raw) == 0 {
+			return Manifest{}, nil, errors.New("the archive is truncated: no trailer")
+		}
+		if err != nil && err != io.EOF {
+			return Manifest{}, nil, fmt.Errorf("failed to read line %d: %w", n, err)
+		}
+
+		var l line
+		if err := json.Unmarshal(raw, &l); err != nil {
+			return Manifest{}, nil, fmt.Errorf("invalid line %d: %w", n, err)
+		}
+		switch {
+		case n == 1:
+			if l.Kind != kindHeader || l.Format != Format {
+				return Manifest{}, nil, errors.New("not a backup archive: missing header")
+			}
+			if l.Version < 1 || l.Version > Version {
+				return Manifest{}, nil, fmt.Errorf("unsupported archive version %d, expected at most %d", l.Version, Version)
+			}
+			manifest.Version, manifest.CreatedAt = l.Version, l.CreatedAt
+		case l.Kind == kindTrailer:
+			if _, err := reader.ReadByte(); err != io.EOF {
+				return Manifest{}, nil, fmt.Errorf("unexpected data after the trailer on line %d", n)
+			}
+			manifest.Counts, manifest.Checksums = l.Counts, l.Checksums
+			if err := compare(manifest, summarize(lines)); err != nil {
+				return Manifest{}, nil, fmt.Errorf("the archive is corrupt: %w", err)
+			}
+			return manifest, lines, nil
+		default:
+			section := sectionOf(l.Kind)
+			if section == "" {
+				return Manifest{}, nil, fmt.Errorf("unknown record kind %q on line %d", l.Kind, n)
+			}
+			lines[section] = append(lines[section], raw)
+		}
+	}
+}
+
+func checkEmpty(ctx context.Context, st store.Store) error {
+	sources, err := st.GetSources(ctx)
+	if err != nil {
+		return err
+	}
+	users, err := st.GetUsers(ctx)
+	if err != nil {
+		return err
+	}
+	graph, err := st.GetGraph(ctx, models.GraphFilter{})
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 || len(users) > 0 || len(graph.Nodes) > 0 || len(graph.Edges) > 0 {
+		return fmt.Errorf("%w: it holds %d persons, %d relationships, %d users and %d sources",
+			ErrNotEmpty, len(graph.Nodes), len(graph.Edges), len(users), len(sources))
+	}
+	return nil
+}
+
+// load writes the records to st: sources first, since persons and
+// relationships cite them, then users, persons and relationships.
+func load(ctx context.Context, st store.Store, lines map[string][][]byte) error {
+	for _, raw := range lines[SectionSources] {
+		var source models.Source
+		if err := decodeRecord(raw, &source); err != nil {
+			return err
+		}
+		if err := st.AddSource(ctx, source); err != nil {
+			return fmt.Errorf("failed to restore source %s: %w", source.ID, err)
+		}
+	}
+
+	for _, raw := range lines[SectionUsers] {
+		var u user
+		if err := decodeRecord(raw, &u); err != nil {
+			return err
+		}
+		if err := restoreUser(ctx, st, u.toUser()); err != nil {
+			return fmt.Errorf("failed to restore user %s: %w", u.Login, err)
+		}
+	}
+
+	persons := make([]models.Person, len(lines[SectionPersons]))
+	for i, raw := range lines[SectionPersons] {
+		if err := decodeRecord(raw, &persons[i]); err != nil {
+			return err
+		}
+	}
+	rels := make([]models.Relationship, len(lines[SectionRelationships]))
+	for i, raw := range lines[SectionRelationships] {
+		if err := decodeRecord(raw, &rels[i]); err != nil {
+			return err
+		}
+	}
+
+	// Persons go first so that every relationship finds its ends in the
+	// batches committed before it.
+	for start := 0; start < len(persons)+len(rels); start += restoreBatchSize {
+		end := min(start+restoreBatchSize, len(persons)+len(rels))
+		batch := store.Batch{
+			Persons:       persons[min(start, len(persons)):min(end, len(persons))],
+			Relationships: rels[max(start-len(persons), 0):max(end-len(persons), 0)],
+		}
+		if err := st.ImportBatch(ctx, batch); err != nil {
+			return fmt.Errorf("failed to restore records %d to %d of the graph: %w", start+1, end, err)
+		}
+	}
+	return nil
+}
+
+// archivedUserID returns the ID of the user with the given login in the
+// users section of an archive.
+func archivedUserID(lines map[string][][]byte, login string) (string, error) {
+	for _, raw := range lines[SectionUsers] {
+		var u user
+		if err := decodeRecord(raw, &u); err != nil {
+			return "", err
+		}
+		if u.Login == login {
+			return u.ID, nil
+		}
+	}
+	return "", fmt.Errorf("author %s: no such user in the archive", login)
+}
+
+// restoreUser adds u with its two-factor state, which AddUser does not
+// store on every backend.
+func restoreUser(ctx context.Context, st store.Store, u models.User) error {
+	if err := st.AddUser(ctx, u); err != nil {
+		return err
+	}
+	if u.TOTPSecret != "" || len(u.RecoveryCodes) > 0 {
+		if err := st.SetTOTP(ctx, u.ID, u.TOTPSecret, u.TOTPEnabled, u.RecoveryCodes); err != nil {
+			return err
+		}
+	}
+	// ErrCodeUsed means the counter was already stored with the user.
+	if u.TOTPCounter > 0 {
+		if err := st.AcceptTOTPCounter(ctx, u.ID, u.TOTPCounter); err != nil && err != store.ErrCodeUsed {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeRecord(raw []byte, record interface{}) error {
+	var l line
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(l.Record, record); err != nil {
+		return fmt.Errorf("invalid %s record: %w", l.Kind, err)
+	}
+	return nil
+}
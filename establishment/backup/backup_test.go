@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"establishment/v1/establishment/memory"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// newTestStore returns a store with a source, two users, one of them with
+// two-factor authentication, two persons and a relationship.
+func newTestStore(t *testing.T) *memory.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := memory.NewStore()
+	if err := st.AddSource(ctx, models.Source{ID: "s1", Title: "Gazette"}); err != nil {
+		t.Fatal(err)
+	}
+	users := []models.User{
+		{ID: "u1", Login: "admin", Email: "admin@example.com", Password: "hash", Roles: []string{"admin"}, EmailVerified: true},
+		{ID: "u2", Login: "viewer", Email: "viewer@example.com", Password: "hash", Roles: []string{"viewer"}},
+	}
+	for _, u := range users {
+		if err := st.AddUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SetTOTP(ctx, "u1", "SECRET", true, []string{"code-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AcceptTOTPCounter(ctx, "u1", 42); err != nil {
+		t.Fatal(err)
+	}
+	for _, person := range []models.Person{
+		{ID: "a", Name: "Alice", SourceIDs: []string{"s1"}, CreatedAt: 1},
+		{ID: "b", Name: "Bob", CreatedAt: 2},
+	} {
+		if err := st.AddPerson(ctx, person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.AddRelationship(ctx, models.Relationship{ID: "r1", From: "a", To: "b", Type: "knows", StartDate: "1990"}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// archive returns the archive of st.
+func archive(t *testing.T, st store.Store) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Write(context.Background(), st, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rewrite returns data, an archive, with its uncompressed lines passed
+// through edit.
+func rewrite(t *testing.T, data []byte, edit func(string) string) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(edit(string(raw)))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	original := newTestStore(t)
+	data := archive(t, original)
+
+	restored := memory.NewStore()
+	manifest, err := Restore(ctx, restored, bytes.NewReader(data), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{SectionSources: 1, SectionUsers: 2, SectionPersons: 2, SectionRelationships: 1}
+	for section, n := range want {
+		if manifest.Counts[section] != n {
+			t.Errorf("%s: %d records restored, want %d", section, manifest.Counts[section], n)
+		}
+	}
+
+	// The restored store archives to the same records.
+	if err := compare(manifest, mustRead(t, archive(t, restored))); err != nil {
+		t.Errorf("restored store differs from the original: %v", err)
+	}
+
+	u, err := restored.GetUserByLogin(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Password != "hash" || !u.TOTPEnabled || u.TOTPSecret != "SECRET" || u.TOTPCounter != 42 || len(u.RecoveryCodes) != 1 {
+		t.Errorf("restored user lost its secrets: %+v", u)
+	}
+}
+
+// mustRead returns the manifest of an archive.
+func mustRead(t *testing.T, data []byte) Manifest {
+	t.Helper()
+	manifest, _, err := read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestRestoreAuthor(t *testing.T) {
+	ctx := context.Background()
+	data := archive(t, newTestStore(t))
+
+	restored := memory.NewStore()
+	if _, err := Restore(ctx, restored, bytes.NewReader(data), "admin"); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := restored.GetRevisions(ctx, models.EntityRef{Type: models.EntityPerson, ID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Action != models.ActionCreate || revisions[0].AuthorID != "u1" {
+		t.Errorf("revisions of a restored person = %+v", revisions)
+	}
+
+	if _, err := Restore(ctx, memory.NewStore(), bytes.NewReader(data), "nobody"); err == nil {
+		t.Error("Restore accepted an author missing from the archive")
+	}
+}
+
+func TestRestoreRefusesNonEmptyStore(t *testing.T) {
+	data := archive(t, newTestStore(t))
+	st := memory.NewStore()
+	if err := st.AddSource(context.Background(), models.Source{ID: "other", Title: "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(context.Background(), st, bytes.NewReader(data), ""); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Restore into a non-empty store = %v, want ErrNotEmpty", err)
+	}
+}
+
+func TestRestoreRejectsDamagedArchives(t *testing.T) {
+	data := archive(t, newTestStore(t))
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not gzip", []byte("plain text"), "not a backup archive"},
+		{"no header", rewrite(t, data, func(s string) string { return s[strings.Index(s, "\n")+1:] }), "missing header"},
+		{"no trailer", rewrite(t, data, func(s string) string {
+			return s[:strings.LastIndex(strings.TrimSuffix(s, "\n"), "\n")+1]
+		}), "no trailer"},
+		{"edited record", rewrite(t, data, func(s string) string { return strings.Replace(s, "Alice", "Alicia", 1) }), "checksum mismatch"},
+		{"missing record", rewrite(t, data, func(s string) string {
+			start := strings.Index(s, `{"kind":"person"`)
+			return s[:start] + s[start+strings.Index(s[start:], "\n")+1:]
+		}), "expected 2 records, found 1"},
+		{"data after trailer", rewrite(t, data, func(s string) string { return s + "{}\n" }), "after the trailer"},
+		{"newer version", rewrite(t, data, func(s string) string { return strings.Replace(s, `"version":1`, `"version":2`, 1) }), "unsupported archive version"},
+	}
+	for _, tt := range tests {
+		st := memory.NewStore()
+		_, err := Restore(context.Background(), st, bytes.NewReader(tt.data), "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Restore = %v, want an error containing %q", tt.name, err, tt.want)
+			continue
+		}
+		if graph, _ := st.GetGraph(context.Background(), models.GraphFilter{}); len(graph.Nodes) > 0 {
+			t.Errorf("%s: a damaged archive was partly restored", tt.name)
+		}
+	}
+}
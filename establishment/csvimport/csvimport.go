@@ -0,0 +1,433 @@
+// Package csvimport loads persons and relationships from CSV files. Every
+// row is validated before anything is written, and valid files are then
+// committed in batches, each in its own transaction.
+package csvimport
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+const DefaultBatchSize = 500
+
+// Files named in row reports.
+const (
+	FilePersons       = "persons"
+	FileRelationships = "relationships"
+)
+
+// Row statuses.
+const (
+	StatusValid    = "valid"
+	StatusInvalid  = "invalid"
+	StatusImported = "imported"
+)
+
+// PersonFields and RelationshipFields list the fields that can be read
+// from CSV columns. source_ids holds semicolon-separated source IDs.
+var (
+	PersonFields       = []string{"id", "name", "occupation", "image_url", "twitter", "description", "source_ids"}
+	RelationshipFields = []string{"id", "source_id", "target_id", "type", "details", "start_date", "end_date", "source_ids"}
+)
+
+// Mapping maps field names to the CSV column headers they are read from.
+// Fields it leaves out are read from the column named like the field, if
+// there is one.
+type Mapping map[string]string
+
+// ParseMapping reads a mapping written as "field=Column,field=Column".
+func ParseMapping(spec string) (Mapping, error) {
+	mapping := Mapping{}
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid mapping %q: use field=Column", pair)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+type Options struct {
+	PersonMapping       Mapping
+	RelationshipMapping Mapping
+	// DryRun only validates the rows.
+	DryRun    bool
+	BatchSize int
+}
+
+// Report describes the outcome of an import row by row.
+type Report struct {
+	DryRun bool `json:"dry_run"`
+	// Valid reports whether every row passed validation. Nothing is
+	// imported unless they all did.
+	Valid                 bool `json:"valid"`
+	PersonsImported       int  `json:"persons_imported"`
+	RelationshipsImported int  `json:"relationships_imported"`
+	// Error describes the batch that failed to commit. The batches before
+	// it stay imported; their rows have the status "imported".
+	Error string `json:"error,omitempty"`
+	Rows  []Row  `json:"rows"`
+}
+
+type Row struct {
+	File string `json:"file"`
+	// Line is the line of the row in its file, counting the header as 1.
+	Line   int      `json:"line"`
+	ID     string   `json:"id,omitempty"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Import reads persons and relationships, either of which may be nil, and
+// adds them to st unless opts.DryRun is set. Relationships may connect
+// persons from the same import. It only returns an error if a file cannot
+// be read at all; problems with single rows and failed batches are
+// described in the report.
+func Import(ctx context.Context, st store.Store, persons, relationships io.Reader, opts Options) (Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	report := Report{DryRun: opts.DryRun, Rows: []Row{}}
+
+	var personRecords, relRecords []record
+	var err error
+	if persons != nil {
+		if personRecords, err = readRecords(persons, PersonFields, opts.PersonMapping, "id", "name"); err != nil {
+			return Report{}, fmt.Errorf("persons: %w", err)
+		}
+	}
+	if relationships != nil {
+		if relRecords, err = readRecords(relationships, RelationshipFields, opts.RelationshipMapping, "source_id", "target_id"); err != nil {
+			return Report{}, fmt.Errorf("relationships: %w", err)
+		}
+	}
+
+	v, err := newValidator(ctx, st, personRecords, relRecords)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now().Unix()
+	var newPersons []models.Person
+	var newRels []models.Relationship
+	for _, rec := range personRecords {
+		person := rec.person(now)
+		row := Row{File: FilePersons, Line: rec.line, ID: person.ID, Errors: v.checkPerson(rec, person)}
+		if len(row.Errors) == 0 {
+			newPersons = append(newPersons, person)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	for _, rec := range relRecords {
+		rel := rec.relationship()
+		// Generated IDs are not reported, since a later run would generate
+		// different ones.
+		row := Row{File: FileRelationships, Line: rec.line, ID: rec.values["id"], Errors: v.checkRelationship(rec, rel)}
+		if len(row.Errors) == 0 {
+			newRels = append(newRels, rel)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	report.Valid = true
+	for i := range report.Rows {
+		report.Rows[i].Status = StatusValid
+		if len(report.Rows[i].Errors) > 0 {
+			report.Rows[i].Status = StatusInvalid
+			report.Valid = false
+		}
+	}
+	if !report.Valid || opts.DryRun {
+		return report, nil
+	}
+
+	// Persons go first so that every relationship finds its ends in the
+	// batches committed before it. Rows are reported in the same order.
+	for start := 0; start < len(newPersons)+len(newRels); start += opts.BatchSize {
+		end := min(start+opts.BatchSize, len(newPersons)+len(newRels))
+		batchPersons := newPersons[min(start, len(newPersons)):min(end, len(newPersons))]
+		batchRels := newRels[max(start-len(newPersons), 0):max(end-len(newPersons), 0)]
+		if err := st.ImportBatch(ctx, store.Batch{Persons: batchPersons, Relationships: batchRels}); err != nil {
+			report.Error = fmt.Sprintf("batch of rows %d to %d failed: %v", start+1, end, err)
+			return report, nil
+		}
+		for i := start; i < end; i++ {
+			report.Rows[i].Status = StatusImported
+		}
+		report.PersonsImported += len(batchPersons)
+		report.RelationshipsImported += len(batchRels)
+	}
+	return report, nil
+}
+
+// record is one CSV row with its values by field name.
+type record struct {
+	line   int
+	values map[string]string
+	// missing lists the mapped columns the row is too short to have.
+	missing []string
+}
+
+func (rec record) person(createdAt int64) models.Person {
+	return models.Person{
+		ID:          rec.values["id"],
+		Name:        rec.values["name"],
+		Occupation:  rec.values["occupation"],
+		ImageURL:    rec.values["image_url"],
+		Twitter:     rec.values["twitter"],
+		Description: rec.values["description"],
+		CreatedAt:   createdAt,
+		SourceIDs:   splitIDs(rec.values["source_ids"]),
+	}
+}
+
+func (rec record) relationship() models.Relationship {
+	id := rec.values["id"]
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return models.Relationship{
+		ID:        id,
+		From:      rec.values["source_id"],
+		To:        rec.values["target_id"],
+		Type:      rec.values["type"],
+		Details:   rec.values["details"],
+		StartDate: rec.values["start_date"],
+		EndDate:   rec.values["end_date"],
+		SourceIDs: splitIDs(rec.values["source_ids"]),
+	}
+}
+
+// readRecords reads a CSV file with a header row, keeping the columns that
+// fields are mapped to. The required fields must be mapped to a column.
+func readRecords(r io.Reader, fields []string, mapping Mapping, required ...string) ([]record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		positions[column] = i
+	}
+
+	for field := range mapping {
+		if !slices.Contains(fields, field) {
+			return nil, fmt.Errorf("unknown field %q in mapping, expected one of %s", field, strings.Join(fields, ", "))
+		}
+	}
+	columns := make(map[string]int)
+	for _, field := range fields {
+		column, mapped := mapping[field]
+		if !mapped {
+			column = field
+		}
+		if i, ok := positions[column]; ok {
+			columns[field] = i
+		} else if mapped {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the header", column, field)
+		}
+	}
+	for _, field := range required {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no column for the required field %s", field)
+		}
+	}
+
+	var records []record
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(values) == 1 && strings.TrimSpace(values[0]) == "" {
+			continue
+		}
+		rec := record{line: line, values: make(map[string]string, len(columns))}
+		for field, i := range columns {
+			if i >= len(values) {
+				rec.missing = append(rec.missing, field)
+				continue
+			}
+			rec.values[field] = strings.TrimSpace(values[i])
+		}
+		slices.Sort(rec.missing)
+		records = append(records, rec)
+	}
+}
+
+// splitIDs splits a semicolon-separated list, dropping empty entries.
+func splitIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ";") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// validator checks rows against each other and against the store.
+type validator struct {
+	// existing holds the IDs of persons already in the store, and
+	// existingRels those of relationships.
+	existing     map[string]bool
+	existingRels map[string]bool
+	sources      map[string]bool
+	// imported holds the IDs of valid person rows, which relationships
+	// may connect; personLines finds duplicates among all person rows.
+	imported    map[string]bool
+	personLines map[string]int
+	relLines    map[string]int
+}
+
+// newValidator looks up every person, relationship and source the rows refer
+// to in one query each.
+func newValidator(ctx context.Context, st store.Store, persons, rels []record) (*validator, error) {
+	var personIDs, relIDs, sourceIDs []string
+	for _, rec := range persons {
+		personIDs = append(personIDs, rec.values["id"])
+		sourceIDs = append(sourceIDs, splitIDs(rec.values["source_ids"])...)
+	}
+	for _, rec := range rels {
+		personIDs = append(personIDs, rec.values["source_id"], rec.values["target_id"])
+		if id := rec.values["id"]; id != "" {
+			relIDs = append(relIDs, id)
+		}
+		sourceIDs = append(sourceIDs, splitIDs(rec.values["source_ids"])...)
+	}
+
+	v := &validator{
+		existing:     make(map[string]bool),
+		existingRels: make(map[string]bool),
+		sources:      make(map[string]bool),
+		imported:     make(map[string]bool),
+		personLines:  make(map[string]int),
+		relLines:     make(map[string]int),
+	}
+	if len(personIDs) > 0 {
+		found, err := st.GetPersonsByIDs(ctx, personIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, person := range found {
+			v.existing[person.ID] = true
+		}
+	}
+	if len(relIDs) > 0 {
+		found, err := st.GetRelationshipsByIDs(ctx, relIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range found {
+			v.existingRels[rel.ID] = true
+		}
+	}
+	if len(sourceIDs) > 0 {
+		found, err := st.GetSourcesByIDs(ctx, sourceIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range found {
+			v.sources[source.ID] = true
+		}
+	}
+	return v, nil
+}
+
+func (v *validator) checkPerson(rec record, person models.Person) []string {
+	var problems []string
+	for _, field := range rec.missing {
+		problems = append(problems, "missing column for "+field)
+	}
+	if person.ID == "" {
+		problems = append(problems, "missing id")
+	} else if line, ok := v.personLines[person.ID]; ok {
+		problems = append(problems, fmt.Sprintf("duplicate id %s, first used on line %d", person.ID, line))
+	} else {
+		v.personLines[person.ID] = rec.line
+		if v.existing[person.ID] {
+			problems = append(problems, fmt.Sprintf("person %s already exists", person.ID))
+		}
+	}
+	if person.Name == "" {
+		problems = append(problems, "missing name")
+	}
+	problems = append(problems, v.checkSources(person.SourceIDs)...)
+
+	if len(problems) == 0 {
+		v.imported[person.ID] = true
+	}
+	return problems
+}
+
+func (v *validator) checkRelationship(rec record, rel models.Relationship) []string {
+	var problems []string
+	for _, field := range rec.missing {
+		problems = append(problems, "missing column for "+field)
+	}
+	if rec.values["id"] != "" {
+		if line, ok := v.relLines[rel.ID]; ok {
+			problems = append(problems, fmt.Sprintf("duplicate id %s, first used on line %d", rel.ID, line))
+		} else {
+			v.relLines[rel.ID] = rec.line
+			if v.existingRels[rel.ID] {
+				problems = append(problems, fmt.Sprintf("relationship %s already exists", rel.ID))
+			}
+		}
+	}
+
+	for _, end := range []struct{ field, id string }{{"source_id", rel.From}, {"target_id", rel.To}} {
+		switch {
+		case end.id == "":
+			problems = append(problems, "missing "+end.field)
+		case !v.existing[end.id] && !v.imported[end.id]:
+			problems = append(problems, fmt.Sprintf("unknown person %s in %s", end.id, end.field))
+		}
+	}
+	if rel.From != "" && rel.From == rel.To {
+		problems = append(problems, store.ErrInvalidRelationship.Error())
+	}
+	if err := rel.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return append(problems, v.checkSources(rel.SourceIDs)...)
+}
+
+func (v *validator) checkSources(ids []string) []string {
+	var problems []string
+	for _, id := range ids {
+		if !v.sources[id] {
+			problems = append(problems, "unknown source "+id)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,220 @@
+package csvimport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"establishment/v1/establishment/memory"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// newTestStore returns a store with person "a", source "s1" and the
+// relationship "r1" from a to b.
+func newTestStore(t *testing.T) *memory.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := memory.NewStore()
+	for _, id := range []string{"a", "b"} {
+		if err := st.AddPerson(ctx, models.Person{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.AddRelationship(ctx, models.Relationship{ID: "r1", From: "a", To: "b", Type: "knows"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddSource(ctx, models.Source{ID: "s1", Title: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// reader returns a reader of a non-empty CSV file and nil otherwise.
+func reader(file string) io.Reader {
+	if file == "" {
+		return nil
+	}
+	return strings.NewReader(file)
+}
+
+func TestImportValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		persons       string
+		relationships string
+		// errors holds the errors expected for each row, in report order.
+		errors [][]string
+	}{
+		{
+			name:    "valid persons and relationships",
+			persons: "id,name,source_ids\nc,Carol,s1\nd,Dave,\n",
+			relationships: "source_id,target_id,type,start_date,end_date\n" +
+				"c,d,knows,2001,2002\na,c,works with,,\n",
+			errors: [][]string{nil, nil, nil, nil},
+		},
+		{
+			name:    "invalid persons",
+			persons: "id,name,source_ids\na,Again,\nc,,s2\nd,Dave,\nd,Dave again,\n,Nobody,\n",
+			errors: [][]string{
+				{"person a already exists"},
+				{"missing name", "unknown source s2"},
+				nil,
+				{"duplicate id d, first used on line 4"},
+				{"missing id"},
+			},
+		},
+		{
+			name: "invalid relationships",
+			relationships: "id,source_id,target_id,type,start_date,end_date\n" +
+				"r1,a,b,knows,,\n" +
+				"r2,a,a,knows,,\n" +
+				"r3,a,x,knows,,\n" +
+				"r3,a,b,knows,,\n" +
+				"r4,a,b,knows,2002,2001\n" +
+				"r5,a\n",
+			errors: [][]string{
+				{"relationship r1 already exists"},
+				{store.ErrInvalidRelationship.Error()},
+				{"unknown person x in target_id"},
+				{"duplicate id r3, first used on line 4"},
+				{models.ErrInvalidDateRange.Error()},
+				{"missing column for end_date", "missing column for start_date", "missing column for target_id", "missing column for type", "missing target_id"},
+			},
+		},
+		{
+			name:          "relationship to an invalid person row",
+			persons:       "id,name\nc,\n",
+			relationships: "source_id,target_id\na,c\n",
+			errors:        [][]string{{"missing name"}, {"unknown person c in target_id"}},
+		},
+	}
+	for _, tt := range tests {
+		report, err := Import(context.Background(), newTestStore(t), reader(tt.persons), reader(tt.relationships), Options{DryRun: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(report.Rows) != len(tt.errors) {
+			t.Fatalf("%s: %d rows reported, want %d: %+v", tt.name, len(report.Rows), len(tt.errors), report.Rows)
+		}
+		valid := true
+		for i, row := range report.Rows {
+			if !reflect.DeepEqual(row.Errors, tt.errors[i]) {
+				t.Errorf("%s: row %d (line %d) errors = %q, want %q", tt.name, i, row.Line, row.Errors, tt.errors[i])
+			}
+			valid = valid && tt.errors[i] == nil
+		}
+		if report.Valid != valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, report.Valid, valid)
+		}
+	}
+}
+
+func TestImportCommitsInBatches(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	persons := "Person ID,Full name,occupation\nc,Carol,judge\nd,Dave,mayor\ne,Eve,\n"
+	relationships := "id,source_id,target_id,type\nr2,c,d,knows\nr3,e,a,knows\n"
+	mapping, err := ParseMapping("id=Person ID, name=Full name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Import(ctx, st, reader(persons), reader(relationships), Options{PersonMapping: mapping, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Error != "" || report.PersonsImported != 3 || report.RelationshipsImported != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, row := range report.Rows {
+		if row.Status != StatusImported {
+			t.Errorf("row %s:%d has status %s", row.File, row.Line, row.Status)
+		}
+	}
+	person, err := st.GetPerson(ctx, "c")
+	if err != nil || person.Name != "Carol" || person.Occupation != "judge" {
+		t.Errorf("imported person c = %+v, %v", person, err)
+	}
+	if _, err := st.GetRelationship(ctx, "r3"); err != nil {
+		t.Errorf("relationship r3 was not imported: %v", err)
+	}
+}
+
+func TestImportNothingWhenInvalid(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	report, err := Import(ctx, st, reader("id,name\nc,Carol\nd,\n"), nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || report.PersonsImported != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if _, err := st.GetPerson(ctx, "c"); err != store.ErrNoSuchPerson {
+		t.Errorf("valid row of an invalid file was imported: %v", err)
+	}
+}
+
+func TestImportFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		persons string
+		mapping Mapping
+		want    string
+	}{
+		{"empty", "", nil, "the file is empty"},
+		{"no name column", "id,occupation\n", nil, "no column for the required field name"},
+		{"unknown field", "id,name\n", Mapping{"age": "Age"}, `unknown field "age"`},
+		{"unknown column", "id,name\n", Mapping{"name": "Full name"}, `column "Full name" mapped to name is not in the header`},
+	}
+	for _, tt := range tests {
+		_, err := Import(context.Background(), newTestStore(t), strings.NewReader(tt.persons), nil, Options{PersonMapping: tt.mapping})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Import = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// failingStore fails to look up relationships.
+type failingStore struct {
+	*memory.Store
+}
+
+var errLookup = errors.New("lookup failed")
+
+func (failingStore) GetRelationshipsByIDs(ctx context.Context, ids []string) ([]models.Relationship, error) {
+	return nil, errLookup
+}
+
+func TestImportReportsStoreErrors(t *testing.T) {
+	st := failingStore{newTestStore(t)}
+	_, err := Import(context.Background(), st, nil, reader("id,source_id,target_id\nr2,a,b\n"), Options{DryRun: true})
+	if !errors.Is(err, errLookup) {
+		t.Errorf("Import = %v, want the store's error", err)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Mapping
+		ok   bool
+	}{
+		{"", Mapping{}, true},
+		{"id=Person ID", Mapping{"id": "Person ID"}, true},
+		{" id = ID , name=Name", Mapping{"id": "ID", "name": "Name"}, true},
+		{"id", nil, false},
+		{"id=", nil, false},
+		{"=ID", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseMapping(tt.spec)
+		if (err == nil) != tt.ok || (tt.ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("ParseMapping(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package graphfile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"establishment/v1/establishment/models"
+)
+
+const (
+	gexfNamespace = "http://gexf.net/1.3"
+	gexfVersion   = "1.3"
+)
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Meta    gexfMeta  `xml:"meta"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	LastModified string `xml:"lastmodifieddate,attr"`
+	Creator      string `xml:"creator"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+// gexfAttributes declares the attributes of either nodes or edges.
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+	// Default is the value of nodes or edges without one of their own.
+	Default string `xml:"default,omitempty"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// WriteGEXF writes graph as a static, directed GEXF 1.3 document. Persons
+// are labelled with their names and relationships with their types; empty
+// attributes are left out.
+func WriteGEXF(w io.Writer, graph models.Graph) error {
+	doc := gexf{
+		Xmlns:   gexfNamespace,
+		Version: gexfVersion,
+		Meta: gexfMeta{
+			LastModified: time.Now().UTC().Format(time.DateOnly),
+			Creator:      "establishment",
+		},
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: gexfAttributeList(personAttributes)},
+				{Class: "edge", Attributes: gexfAttributeList(relationshipAttributes)},
+			},
+			Nodes: make([]gexfNode, 0, len(graph.Nodes)),
+			Edges: make([]gexfEdge, 0, len(graph.Edges)),
+		},
+	}
+
+	for _, person := range graph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:        person.ID,
+			Label:     person.Name,
+			AttValues: gexfAttValues(personAttributes, personValues(person)),
+		})
+	}
+	for _, rel := range graph.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:        rel.ID,
+			Source:    rel.From,
+			Target:    rel.To,
+			Label:     rel.Type,
+			AttValues: gexfAttValues(relationshipAttributes, relationshipValues(rel)),
+		})
+	}
+
+	return encode(w, doc)
+}
+
+func gexfAttributeList(attrs []attribute) []gexfAttribute {
+	list := make([]gexfAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		list = append(list, gexfAttribute{ID: attr.name, Title: attr.name, Type: attr.typ})
+	}
+	return list
+}
+
+// gexfAttValues lists the non-empty values in the order of attrs.
+func gexfAttValues(attrs []attribute, values map[string]string) []gexfAttValue {
+	var attValues []gexfAttValue
+	for _, attr := range attrs {
+		if value := values[attr.name]; value != "" {
+			attValues = append(attValues, gexfAttValue{For: attr.name, Value: value})
+		}
+	}
+	return attValues
+}
+
+// ReadGEXF reads a GEXF document of any version. Attributes are matched to
+// fields by their title, or their id if they have none. Labels stand in for
+// the names of persons and the types of relationships that have no such
+// attribute.
+func ReadGEXF(r io.Reader) (Document, error) {
+	var doc gexf
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return Document{}, fmt.Errorf("invalid GEXF: %w", err)
+	}
+
+	nodeAttributes := make(map[string]gexfAttribute)
+	edgeAttributes := make(map[string]gexfAttribute)
+	for _, attrs := range doc.Graph.Attributes {
+		for _, attr := range attrs.Attributes {
+			if attr.Title == "" {
+				attr.Title = attr.ID
+			}
+			switch attrs.Class {
+			case "node":
+				nodeAttributes[attr.ID] = attr
+			case "edge":
+				edgeAttributes[attr.ID] = attr
+			}
+		}
+	}
+
+	m := newMapper()
+	var result Document
+	for _, node := range doc.Graph.Nodes {
+		values := gexfValues(nodeAttributes, node.AttValues)
+		if node.Label != "" {
+			values[labelAttribute] = node.Label
+		}
+		result.Nodes = append(result.Nodes, Node{ID: node.ID, Person: m.person(values)})
+	}
+	for _, edge := range doc.Graph.Edges {
+		values := gexfValues(edgeAttributes, edge.AttValues)
+		if edge.Label != "" {
+			values[labelAttribute] = edge.Label
+		}
+		result.Edges = append(result.Edges, Edge{
+			ID:           edge.ID,
+			Source:       edge.Source,
+			Target:       edge.Target,
+			Relationship: m.relationship(values),
+		})
+	}
+	m.report(&result)
+	return result, nil
+}
+
+// gexfValues returns the value of every attribute by title, using the
+// default of attributes without a value.
+func gexfValues(attrs map[string]gexfAttribute, attValues []gexfAttValue) map[string]string {
+	values := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		values[attr.Title] = attr.Default
+	}
+	for _, v := range attValues {
+		if attr, ok := attrs[v.For]; ok {
+			values[attr.Title] = v.Value
+		}
+	}
+	return values
+}
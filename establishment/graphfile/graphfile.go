@@ -0,0 +1,248 @@
+// Package graphfile writes and reads graphs in the GraphML and GEXF file
+// formats of network analysis tools such as Gephi and yEd. Every field of
+// persons and relationships is written as a typed node or edge attribute
+// named after its JSON field, and read back from attributes named the same
+// way.
+package graphfile
+
+import (
+	"encoding/xml"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"establishment/v1/establishment/models"
+)
+
+// Attribute types, named as in both GraphML and GEXF.
+const (
+	typeString = "string"
+	typeLong   = "long"
+)
+
+// labelAttribute holds the name of a person or the type of a relationship,
+// which tools display as the label of nodes and edges.
+const labelAttribute = "label"
+
+// attribute describes one field written as node or edge data.
+type attribute struct {
+	name string
+	typ  string
+}
+
+var personAttributes = []attribute{
+	{"name", typeString},
+	{"occupation", typeString},
+	{"image_url", typeString},
+	{"twitter", typeString},
+	{"description", typeString},
+	{"created_at", typeLong},
+	{"source_ids", typeString},
+}
+
+var relationshipAttributes = []attribute{
+	{"type", typeString},
+	{"details", typeString},
+	{"start_date", typeString},
+	{"end_date", typeString},
+	{"source_ids", typeString},
+}
+
+// personValues returns the values of the personAttributes of person.
+func personValues(person models.Person) map[string]string {
+	return map[string]string{
+		"name":        person.Name,
+		"occupation":  person.Occupation,
+		"image_url":   person.ImageURL,
+		"twitter":     person.Twitter,
+		"description": person.Description,
+		"created_at":  strconv.FormatInt(person.CreatedAt, 10),
+		"source_ids":  joinIDs(person.SourceIDs),
+	}
+}
+
+// relationshipValues returns the values of the relationshipAttributes of rel.
+func relationshipValues(rel models.Relationship) map[string]string {
+	return map[string]string{
+		"type":       rel.Type,
+		"details":    rel.Details,
+		"start_date": rel.StartDate,
+		"end_date":   rel.EndDate,
+		"source_ids": joinIDs(rel.SourceIDs),
+	}
+}
+
+// readOnlyAttributes are exported but never imported, since the server sets
+// them.
+var readOnlyAttributes = map[string]bool{
+	"created_at": true,
+}
+
+// Document is a graph read from a file.
+type Document struct {
+	Nodes []Node
+	Edges []Edge
+	// UnmappedNodeAttributes and UnmappedEdgeAttributes list the attributes
+	// in the file that match no field and were ignored, sorted by name.
+	UnmappedNodeAttributes []string
+	UnmappedEdgeAttributes []string
+}
+
+// Node is a node read from a file. Person sets every field that has an
+// attribute in the file, to the empty value where a node has no value for
+// it; fields without an attribute are left nil.
+type Node struct {
+	ID     string
+	Person models.PersonUpdate
+}
+
+// Edge is an edge read from a file. Relationship sets fields like
+// Node.Person does. ID is empty if the file gives none.
+type Edge struct {
+	ID           string
+	Source       string
+	Target       string
+	Relationship models.RelationshipUpdate
+}
+
+// mapper turns attribute values into updates, collecting the attributes it
+// cannot map.
+type mapper struct {
+	unmappedNode map[string]bool
+	unmappedEdge map[string]bool
+}
+
+func newMapper() *mapper {
+	return &mapper{unmappedNode: make(map[string]bool), unmappedEdge: make(map[string]bool)}
+}
+
+// fieldName normalises an attribute name such as "Image URL" to the field
+// name it may stand for.
+func fieldName(attribute string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(attribute)))
+}
+
+func (m *mapper) person(values map[string]string) models.PersonUpdate {
+	var update models.PersonUpdate
+	var label *string
+	for _, name := range attributeNames(values) {
+		value := values[name]
+		switch fieldName(name) {
+		case "name":
+			update.Name = &value
+		case "occupation":
+			update.Occupation = &value
+		case "image_url":
+			update.ImageURL = &value
+		case "twitter":
+			update.Twitter = &value
+		case "description":
+			update.Description = &value
+		case "source_ids":
+			ids := splitIDs(value)
+			update.SourceIDs = &ids
+		case labelAttribute:
+			label = &value
+		default:
+			if !readOnlyAttributes[fieldName(name)] {
+				m.unmappedNode[name] = true
+			}
+		}
+	}
+	if label != nil && (update.Name == nil || *update.Name == "") {
+		update.Name = label
+	}
+	return update
+}
+
+func (m *mapper) relationship(values map[string]string) models.RelationshipUpdate {
+	var update models.RelationshipUpdate
+	var label *string
+	for _, name := range attributeNames(values) {
+		value := values[name]
+		switch fieldName(name) {
+		case "type":
+			update.Type = &value
+		case "details":
+			update.Details = &value
+		case "start_date":
+			update.StartDate = &value
+		case "end_date":
+			update.EndDate = &value
+		case "source_ids":
+			ids := splitIDs(value)
+			update.SourceIDs = &ids
+		case labelAttribute:
+			label = &value
+		default:
+			if !readOnlyAttributes[fieldName(name)] {
+				m.unmappedEdge[name] = true
+			}
+		}
+	}
+	if label != nil && (update.Type == nil || *update.Type == "") {
+		update.Type = label
+	}
+	return update
+}
+
+// report lists the unmapped attributes in doc.
+func (m *mapper) report(doc *Document) {
+	doc.UnmappedNodeAttributes = sortedKeys(m.unmappedNode)
+	doc.UnmappedEdgeAttributes = sortedKeys(m.unmappedEdge)
+}
+
+// attributeNames sorts the names of values, so that the last of several
+// attributes standing for the same field wins consistently.
+func attributeNames(values map[string]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// joinIDs writes a list of source IDs as one semicolon-separated string,
+// as in CSV imports.
+func joinIDs(ids []string) string {
+	return strings.Join(ids, ";")
+}
+
+// encode writes v as an indented XML document.
+func encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// splitIDs splits a semicolon-separated list, dropping empty entries.
+func splitIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ";") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,173 @@
+package graphfile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"establishment/v1/establishment/models"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+	// Default is the value of nodes or edges without data for the key.
+	Default string `xml:"default,omitempty"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// GraphML key IDs are prefixed by what they apply to, since persons and
+// relationships could share attribute names.
+const (
+	graphMLNodeKey = "n_"
+	graphMLEdgeKey = "e_"
+)
+
+// WriteGraphML writes graph as a directed GraphML document. Empty attributes
+// are left out.
+func WriteGraphML(w io.Writer, graph models.Graph) error {
+	doc := graphML{
+		Xmlns: graphMLNamespace,
+		Keys:  graphMLKeys(),
+		Graph: graphMLGraph{
+			ID:          "G",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, 0, len(graph.Nodes)),
+			Edges:       make([]graphMLEdge, 0, len(graph.Edges)),
+		},
+	}
+
+	for _, person := range graph.Nodes {
+		node := graphMLNode{ID: person.ID}
+		node.Data = appendGraphMLData(node.Data, graphMLNodeKey+labelAttribute, person.Name)
+		values := personValues(person)
+		for _, attr := range personAttributes {
+			node.Data = appendGraphMLData(node.Data, graphMLNodeKey+attr.name, values[attr.name])
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, rel := range graph.Edges {
+		edge := graphMLEdge{ID: rel.ID, Source: rel.From, Target: rel.To}
+		edge.Data = appendGraphMLData(edge.Data, graphMLEdgeKey+labelAttribute, rel.Type)
+		values := relationshipValues(rel)
+		for _, attr := range relationshipAttributes {
+			edge.Data = appendGraphMLData(edge.Data, graphMLEdgeKey+attr.name, values[attr.name])
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	return encode(w, doc)
+}
+
+func graphMLKeys() []graphMLKey {
+	keys := []graphMLKey{{ID: graphMLNodeKey + labelAttribute, For: "node", Name: labelAttribute, Type: typeString}}
+	for _, attr := range personAttributes {
+		keys = append(keys, graphMLKey{ID: graphMLNodeKey + attr.name, For: "node", Name: attr.name, Type: attr.typ})
+	}
+	keys = append(keys, graphMLKey{ID: graphMLEdgeKey + labelAttribute, For: "edge", Name: labelAttribute, Type: typeString})
+	for _, attr := range relationshipAttributes {
+		keys = append(keys, graphMLKey{ID: graphMLEdgeKey + attr.name, For: "edge", Name: attr.name, Type: attr.typ})
+	}
+	return keys
+}
+
+func appendGraphMLData(data []graphMLData, key, value string) []graphMLData {
+	if value == "" {
+		return data
+	}
+	return append(data, graphMLData{Key: key, Value: value})
+}
+
+// ReadGraphML reads the first graph of a GraphML document. Keys are matched
+// to fields by their attr.name, or their id if they have none.
+func ReadGraphML(r io.Reader) (Document, error) {
+	var doc graphML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return Document{}, fmt.Errorf("invalid GraphML: %w", err)
+	}
+
+	nodeKeys := make(map[string]graphMLKey)
+	edgeKeys := make(map[string]graphMLKey)
+	for _, key := range doc.Keys {
+		if key.Name == "" {
+			key.Name = key.ID
+		}
+		switch key.For {
+		case "node":
+			nodeKeys[key.ID] = key
+		case "edge":
+			edgeKeys[key.ID] = key
+		case "all":
+			nodeKeys[key.ID] = key
+			edgeKeys[key.ID] = key
+		}
+	}
+
+	m := newMapper()
+	var result Document
+	for _, node := range doc.Graph.Nodes {
+		result.Nodes = append(result.Nodes, Node{
+			ID:     node.ID,
+			Person: m.person(graphMLValues(nodeKeys, node.Data)),
+		})
+	}
+	for _, edge := range doc.Graph.Edges {
+		result.Edges = append(result.Edges, Edge{
+			ID:           edge.ID,
+			Source:       edge.Source,
+			Target:       edge.Target,
+			Relationship: m.relationship(graphMLValues(edgeKeys, edge.Data)),
+		})
+	}
+	m.report(&result)
+	return result, nil
+}
+
+// graphMLValues returns the value of every key by attribute name, using the
+// default of keys without data.
+func graphMLValues(keys map[string]graphMLKey, data []graphMLData) map[string]string {
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		values[key.Name] = key.Default
+	}
+	for _, d := range data {
+		if key, ok := keys[d.Key]; ok {
+			values[key.Name] = d.Value
+		}
+	}
+	return values
+}
@@ -0,0 +1,415 @@
+// Package graphimport brings graphs edited in tools such as Gephi back from
+// GraphML or GEXF files. Nodes and edges are upserted by ID: those that
+// exist are updated and the others created. As with CSV imports, every
+// node and edge is validated before anything is written, and valid files
+// are then committed in batches, each in its own transaction.
+package graphimport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"establishment/v1/establishment/graphfile"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+const DefaultBatchSize = 500
+
+// File formats accepted by Read.
+const (
+	FormatGraphML = "graphml"
+	FormatGEXF    = "gexf"
+)
+
+// Kinds of items in a report.
+const (
+	KindNode = "node"
+	KindEdge = "edge"
+)
+
+// Actions that valid items call for.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+// Item statuses.
+const (
+	StatusValid    = "valid"
+	StatusInvalid  = "invalid"
+	StatusImported = "imported"
+)
+
+type Options struct {
+	// DryRun only validates the nodes and edges.
+	DryRun    bool
+	BatchSize int
+}
+
+// Report describes the outcome of an import node by node and edge by edge.
+type Report struct {
+	DryRun bool `json:"dry_run"`
+	// Valid reports whether every node and edge passed validation. Nothing
+	// is imported unless they all did.
+	Valid                bool `json:"valid"`
+	PersonsCreated       int  `json:"persons_created"`
+	PersonsUpdated       int  `json:"persons_updated"`
+	RelationshipsCreated int  `json:"relationships_created"`
+	RelationshipsUpdated int  `json:"relationships_updated"`
+	// UnmappedNodeAttributes and UnmappedEdgeAttributes list the attributes
+	// in the file that match no field and were ignored.
+	UnmappedNodeAttributes []string `json:"unmapped_node_attributes"`
+	UnmappedEdgeAttributes []string `json:"unmapped_edge_attributes"`
+	// Error describes the batch that failed to commit. The batches before
+	// it stay imported; their items have the status "imported".
+	Error string `json:"error,omitempty"`
+	Items []Item `json:"items"`
+}
+
+type Item struct {
+	Kind string `json:"kind"`
+	// ID is the ID given in the file, if any.
+	ID string `json:"id,omitempty"`
+	// Action is only set for valid items.
+	Action string   `json:"action,omitempty"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Read reads a file in the given format.
+func Read(format string, r io.Reader) (graphfile.Document, error) {
+	switch format {
+	case FormatGraphML:
+		return graphfile.ReadGraphML(r)
+	case FormatGEXF:
+		return graphfile.ReadGEXF(r)
+	default:
+		return graphfile.Document{}, fmt.Errorf("unknown format %q: use %s or %s", format, FormatGraphML, FormatGEXF)
+	}
+}
+
+// Import upserts the nodes of doc as persons and its edges as relationships
+// into st unless opts.DryRun is set. Fields without an attribute in the file
+// are left unchanged, and items that would not change are skipped. Problems
+// with single items and failed batches are described in the report.
+func Import(ctx context.Context, st store.Store, doc graphfile.Document, opts Options) (Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	report := Report{
+		DryRun:                 opts.DryRun,
+		UnmappedNodeAttributes: doc.UnmappedNodeAttributes,
+		UnmappedEdgeAttributes: doc.UnmappedEdgeAttributes,
+		Items:                  []Item{},
+	}
+
+	v, err := newValidator(ctx, st, doc)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now().Unix()
+	var changes []change
+	for _, node := range doc.Nodes {
+		item, c := v.checkNode(node, now)
+		if item.Action == ActionCreate || item.Action == ActionUpdate {
+			c.item = len(report.Items)
+			changes = append(changes, c)
+		}
+		report.Items = append(report.Items, item)
+	}
+	for _, edge := range doc.Edges {
+		item, c, err := v.checkEdge(ctx, edge)
+		if err != nil {
+			return Report{}, err
+		}
+		if item.Action == ActionCreate || item.Action == ActionUpdate {
+			c.item = len(report.Items)
+			changes = append(changes, c)
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	report.Valid = true
+	for i := range report.Items {
+		report.Items[i].Status = StatusValid
+		if len(report.Items[i].Errors) > 0 {
+			report.Items[i].Status = StatusInvalid
+			report.Items[i].Action = ""
+			report.Valid = false
+		}
+	}
+	if !report.Valid || opts.DryRun {
+		return report, nil
+	}
+
+	// Nodes come before edges, so that every new relationship finds its
+	// ends in its own batch or the ones committed before it.
+	for start := 0; start < len(changes); start += opts.BatchSize {
+		end := min(start+opts.BatchSize, len(changes))
+		var batch store.Batch
+		for _, c := range changes[start:end] {
+			c.add(&batch)
+		}
+		if err := st.ImportBatch(ctx, batch); err != nil {
+			report.Error = fmt.Sprintf("batch of changes %d to %d failed: %v", start+1, end, err)
+			return report, nil
+		}
+		report.PersonsCreated += len(batch.Persons)
+		report.PersonsUpdated += len(batch.PersonUpdates)
+		report.RelationshipsCreated += len(batch.Relationships)
+		report.RelationshipsUpdated += len(batch.RelationshipUpdates)
+		for _, c := range changes[start:end] {
+			report.Items[c.item].Status = StatusImported
+		}
+	}
+	return report, nil
+}
+
+// change is the write a valid item calls for.
+type change struct {
+	// item is the index of the item in the report.
+	item int
+	add  func(*store.Batch)
+}
+
+// validator checks nodes and edges against each other and against the
+// store.
+type validator struct {
+	st store.Store
+	// existing holds the persons in the store that the file refers to, and
+	// existingRels the relationships.
+	existing     map[string]models.Person
+	existingRels map[string]models.Relationship
+	sources      map[string]bool
+	// valid holds the IDs of valid nodes, which new edges may connect.
+	valid map[string]bool
+	nodes map[string]bool
+	edges map[string]bool
+	// outgoing caches the relationships of persons that edges without an
+	// ID start at.
+	outgoing map[string][]models.Relationship
+}
+
+// newValidator looks up every person, relationship and source the file refers
+// to in one query each.
+func newValidator(ctx context.Context, st store.Store, doc graphfile.Document) (*validator, error) {
+	var personIDs, relIDs, sourceIDs []string
+	for _, node := range doc.Nodes {
+		personIDs = append(personIDs, node.ID)
+		if node.Person.SourceIDs != nil {
+			sourceIDs = append(sourceIDs, *node.Person.SourceIDs...)
+		}
+	}
+	for _, edge := range doc.Edges {
+		personIDs = append(personIDs, edge.Source, edge.Target)
+		if edge.ID != "" {
+			relIDs = append(relIDs, edge.ID)
+		}
+		if edge.Relationship.SourceIDs != nil {
+			sourceIDs = append(sourceIDs, *edge.Relationship.SourceIDs...)
+		}
+	}
+
+	v := &validator{
+		st:           st,
+		existing:     make(map[string]models.Person),
+		existingRels: make(map[string]models.Relationship),
+		sources:      make(map[string]bool),
+		valid:        make(map[string]bool),
+		nodes:        make(map[string]bool),
+		edges:        make(map[string]bool),
+		outgoing:     make(map[string][]models.Relationship),
+	}
+	if len(personIDs) > 0 {
+		found, err := st.GetPersonsByIDs(ctx, personIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, person := range found {
+			v.existing[person.ID] = person
+		}
+	}
+	if len(relIDs) > 0 {
+		found, err := st.GetRelationshipsByIDs(ctx, relIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range found {
+			v.existingRels[rel.ID] = rel
+		}
+	}
+	if len(sourceIDs) > 0 {
+		found, err := st.GetSourcesByIDs(ctx, sourceIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range found {
+			v.sources[source.ID] = true
+		}
+	}
+	return v, nil
+}
+
+func (v *validator) checkNode(node graphfile.Node, now int64) (Item, change) {
+	item := Item{Kind: KindNode, ID: node.ID}
+	var c change
+	switch {
+	case node.ID == "":
+		item.Errors = append(item.Errors, "missing id")
+	case v.nodes[node.ID]:
+		item.Errors = append(item.Errors, "duplicate id "+node.ID)
+	default:
+		v.nodes[node.ID] = true
+	}
+
+	existing, exists := v.existing[node.ID]
+	var person models.Person
+	if exists {
+		person = node.Person.Apply(existing)
+	} else {
+		person = node.Person.Apply(models.Person{ID: node.ID, CreatedAt: now})
+	}
+	if person.Name == "" {
+		item.Errors = append(item.Errors, "missing name")
+	}
+	if node.Person.SourceIDs != nil {
+		item.Errors = append(item.Errors, v.checkSources(*node.Person.SourceIDs)...)
+	}
+	if len(item.Errors) > 0 {
+		return item, c
+	}
+
+	v.valid[node.ID] = true
+	switch {
+	case !exists:
+		item.Action = ActionCreate
+		c.add = func(batch *store.Batch) { batch.Persons = append(batch.Persons, person) }
+	case samePerson(person, existing):
+		item.Action = ActionUnchanged
+	default:
+		item.Action = ActionUpdate
+		patch := store.PersonPatch{ID: node.ID, Update: node.Person}
+		c.add = func(batch *store.Batch) { batch.PersonUpdates = append(batch.PersonUpdates, patch) }
+	}
+	return item, c
+}
+
+func (v *validator) checkEdge(ctx context.Context, edge graphfile.Edge) (Item, change, error) {
+	item := Item{Kind: KindEdge, ID: edge.ID}
+	var c change
+
+	var existing models.Relationship
+	exists := false
+	if edge.ID != "" {
+		if v.edges[edge.ID] {
+			item.Errors = append(item.Errors, "duplicate id "+edge.ID)
+		}
+		v.edges[edge.ID] = true
+		existing, exists = v.existingRels[edge.ID]
+	}
+
+	if edge.ID == "" {
+		var err error
+		existing, exists, err = v.match(ctx, edge)
+		if err != nil {
+			return Item{}, change{}, err
+		}
+	}
+
+	var rel models.Relationship
+	if exists {
+		if edge.Source != existing.From || edge.Target != existing.To {
+			item.Errors = append(item.Errors, fmt.Sprintf("relationship %s connects %s to %s; its ends cannot be changed", edge.ID, existing.From, existing.To))
+		}
+		rel = edge.Relationship.Apply(existing)
+	} else {
+		id := edge.ID
+		if id == "" {
+			id = uuid.New().String()
+		}
+		rel = edge.Relationship.Apply(models.Relationship{ID: id, From: edge.Source, To: edge.Target})
+		for _, end := range []struct{ name, id string }{{"source", edge.Source}, {"target", edge.Target}} {
+			_, found := v.existing[end.id]
+			switch {
+			case end.id == "":
+				item.Errors = append(item.Errors, "missing "+end.name)
+			case !found && !v.valid[end.id]:
+				item.Errors = append(item.Errors, fmt.Sprintf("unknown person %s in %s", end.id, end.name))
+			}
+		}
+		if rel.From != "" && rel.From == rel.To {
+			item.Errors = append(item.Errors, store.ErrInvalidRelationship.Error())
+		}
+	}
+	if err := rel.Validate(); err != nil {
+		item.Errors = append(item.Errors, err.Error())
+	}
+	if edge.Relationship.SourceIDs != nil {
+		item.Errors = append(item.Errors, v.checkSources(*edge.Relationship.SourceIDs)...)
+	}
+	if len(item.Errors) > 0 {
+		return item, c, nil
+	}
+
+	switch {
+	case !exists:
+		item.Action = ActionCreate
+		c.add = func(batch *store.Batch) { batch.Relationships = append(batch.Relationships, rel) }
+	case sameRelationship(rel, existing):
+		item.Action = ActionUnchanged
+	default:
+		item.Action = ActionUpdate
+		patch := store.RelationshipPatch{ID: existing.ID, Update: edge.Relationship}
+		c.add = func(batch *store.Batch) { batch.RelationshipUpdates = append(batch.RelationshipUpdates, patch) }
+	}
+	return item, c, nil
+}
+
+// match finds the relationship an edge without an ID stands for: the one
+// between the same persons, in the same direction and of the same type.
+// Without this, importing a file again would duplicate such edges.
+func (v *validator) match(ctx context.Context, edge graphfile.Edge) (models.Relationship, bool, error) {
+	if _, found := v.existing[edge.Source]; !found || edge.Relationship.Type == nil {
+		return models.Relationship{}, false, nil
+	}
+	rels, cached := v.outgoing[edge.Source]
+	if !cached {
+		var err error
+		if rels, err = v.st.GetPersonRelationships(ctx, edge.Source); err != nil {
+			return models.Relationship{}, false, err
+		}
+		v.outgoing[edge.Source] = rels
+	}
+	for _, rel := range rels {
+		if rel.From == edge.Source && rel.To == edge.Target && rel.Type == *edge.Relationship.Type {
+			return rel, true, nil
+		}
+	}
+	return models.Relationship{}, false, nil
+}
+
+func (v *validator) checkSources(ids []string) []string {
+	var problems []string
+	for _, id := range ids {
+		if !v.sources[id] {
+			problems = append(problems, "unknown source "+id)
+		}
+	}
+	return problems
+}
+
+func samePerson(a, b models.Person) bool {
+	return a.Name == b.Name && a.Occupation == b.Occupation && a.ImageURL == b.ImageURL &&
+		a.Twitter == b.Twitter && a.Description == b.Description && slices.Equal(a.SourceIDs, b.SourceIDs)
+}
+
+func sameRelationship(a, b models.Relationship) bool {
+	return a.Type == b.Type && a.Details == b.Details && a.StartDate == b.StartDate &&
+		a.EndDate == b.EndDate && slices.Equal(a.SourceIDs, b.SourceIDs)
+}
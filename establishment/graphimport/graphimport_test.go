@@ -0,0 +1,237 @@
+package graphimport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"establishment/v1/establishment/graphfile"
+	"establishment/v1/establishment/memory"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// newTestStore returns a store with persons a and b, the relationship r1
+// from a to b and source s1.
+func newTestStore(t *testing.T) *memory.Store {
+	t.Helper()
+	ctx := context.Background()
+	st := memory.NewStore()
+	for _, person := range []models.Person{
+		{ID: "a", Name: "Alice", Occupation: "judge"},
+		{ID: "b", Name: "Bob", Twitter: "@bob"},
+	} {
+		if err := st.AddPerson(ctx, person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.AddRelationship(ctx, models.Relationship{ID: "r1", From: "a", To: "b", Type: "knows", StartDate: "1990"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddSource(ctx, models.Source{ID: "s1", Title: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestImportExportedFile(t *testing.T) {
+	tests := []struct {
+		format string
+		write  func(io.Writer, models.Graph) error
+	}{
+		{FormatGraphML, graphfile.WriteGraphML},
+		{FormatGEXF, graphfile.WriteGEXF},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		st := newTestStore(t)
+		graph, err := st.GetGraph(ctx, models.GraphFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tt.write(&buf, graph); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		doc, err := Read(tt.format, &buf)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+
+		report, err := Import(ctx, st, doc, Options{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if !report.Valid || len(report.Items) != 3 {
+			t.Fatalf("%s: report = %+v", tt.format, report)
+		}
+		for _, item := range report.Items {
+			if item.Action != ActionUnchanged {
+				t.Errorf("%s: %s %s has action %s, want %s", tt.format, item.Kind, item.ID, item.Action, ActionUnchanged)
+			}
+		}
+	}
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	if _, err := Read("dot", bytes.NewReader(nil)); err == nil {
+		t.Error("Read accepted an unknown format")
+	}
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  graphfile.Document
+		// items holds the action, or the errors, expected for each item.
+		items []any
+	}{
+		{
+			name: "creates and updates",
+			doc: graphfile.Document{
+				Nodes: []graphfile.Node{
+					{ID: "a", Person: models.PersonUpdate{Occupation: ptr("mayor")}},
+					{ID: "b", Person: models.PersonUpdate{Name: ptr("Bob")}},
+					{ID: "c", Person: models.PersonUpdate{Name: ptr("Carol"), SourceIDs: &[]string{"s1"}}},
+				},
+				Edges: []graphfile.Edge{
+					{ID: "r1", Source: "a", Target: "b", Relationship: models.RelationshipUpdate{EndDate: ptr("1999")}},
+					{ID: "r2", Source: "b", Target: "c", Relationship: models.RelationshipUpdate{Type: ptr("knows")}},
+					{Source: "a", Target: "b", Relationship: models.RelationshipUpdate{Type: ptr("knows")}},
+					{Source: "a", Target: "c", Relationship: models.RelationshipUpdate{Type: ptr("knows")}},
+				},
+			},
+			items: []any{ActionUpdate, ActionUnchanged, ActionCreate, ActionUpdate, ActionCreate, ActionUnchanged, ActionCreate},
+		},
+		{
+			name: "invalid items",
+			doc: graphfile.Document{
+				Nodes: []graphfile.Node{
+					{Person: models.PersonUpdate{Name: ptr("Nobody")}},
+					{ID: "c", Person: models.PersonUpdate{Occupation: ptr("judge"), SourceIDs: &[]string{"s2"}}},
+					{ID: "d", Person: models.PersonUpdate{Name: ptr("Dave")}},
+					{ID: "d", Person: models.PersonUpdate{Name: ptr("Dave")}},
+				},
+				Edges: []graphfile.Edge{
+					{ID: "r1", Source: "b", Target: "a"},
+					{ID: "r2", Source: "a", Target: "a"},
+					{ID: "r3", Source: "a", Target: "c"},
+					{ID: "r4", Source: "a", Target: "b", Relationship: models.RelationshipUpdate{StartDate: ptr("2002"), EndDate: ptr("2001")}},
+					{ID: "r4", Source: "a", Target: "b"},
+				},
+			},
+			items: []any{
+				[]string{"missing id"},
+				[]string{"missing name", "unknown source s2"},
+				ActionCreate,
+				[]string{"duplicate id d"},
+				[]string{"relationship r1 connects a to b; its ends cannot be changed"},
+				[]string{store.ErrInvalidRelationship.Error()},
+				[]string{"unknown person c in target"},
+				[]string{models.ErrInvalidDateRange.Error()},
+				[]string{"duplicate id r4"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		st := newTestStore(t)
+		report, err := Import(ctx, st, tt.doc, Options{BatchSize: 2})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(report.Items) != len(tt.items) {
+			t.Fatalf("%s: %d items reported, want %d: %+v", tt.name, len(report.Items), len(tt.items), report.Items)
+		}
+		valid := true
+		for i, item := range report.Items {
+			switch want := tt.items[i].(type) {
+			case string:
+				if item.Action != want || item.Errors != nil {
+					t.Errorf("%s: item %d (%s %s) = %s %q, want %s", tt.name, i, item.Kind, item.ID, item.Action, item.Errors, want)
+				}
+			case []string:
+				valid = false
+				if !reflect.DeepEqual(item.Errors, want) {
+					t.Errorf("%s: item %d (%s %s) errors = %q, want %q", tt.name, i, item.Kind, item.ID, item.Errors, want)
+				}
+			}
+		}
+		if report.Valid != valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, report.Valid, valid)
+		}
+		if !valid {
+			if _, err := st.GetPerson(ctx, "d"); err != store.ErrNoSuchPerson {
+				t.Errorf("%s: valid node of an invalid file was imported: %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestImportCommits(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	doc := graphfile.Document{
+		Nodes: []graphfile.Node{
+			{ID: "a", Person: models.PersonUpdate{Occupation: ptr("mayor")}},
+			{ID: "c", Person: models.PersonUpdate{Name: ptr("Carol")}},
+		},
+		Edges: []graphfile.Edge{
+			{ID: "r1", Source: "a", Target: "b", Relationship: models.RelationshipUpdate{EndDate: ptr("1999")}},
+			{Source: "c", Target: "a", Relationship: models.RelationshipUpdate{Type: ptr("knows")}},
+		},
+	}
+	report, err := Import(ctx, st, doc, Options{BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PersonsCreated != 1 || report.PersonsUpdated != 1 || report.RelationshipsCreated != 1 || report.RelationshipsUpdated != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, item := range report.Items {
+		if item.Status != StatusImported {
+			t.Errorf("%s %s has status %s", item.Kind, item.ID, item.Status)
+		}
+	}
+	if person, err := st.GetPerson(ctx, "a"); err != nil || person.Name != "Alice" || person.Occupation != "mayor" {
+		t.Errorf("updated person a = %+v, %v", person, err)
+	}
+	if rel, err := st.GetRelationship(ctx, "r1"); err != nil || rel.StartDate != "1990" || rel.EndDate != "1999" {
+		t.Errorf("updated relationship r1 = %+v, %v", rel, err)
+	}
+
+	// The edge without an ID now matches the relationship it created.
+	report, err = Import(ctx, st, doc, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range report.Items {
+		if item.Action != ActionUnchanged || item.Status != StatusValid {
+			t.Errorf("second import: %s %s is %s and %s", item.Kind, item.ID, item.Action, item.Status)
+		}
+	}
+}
+
+// failingStore fails to look up relationships.
+type failingStore struct {
+	*memory.Store
+}
+
+var errLookup = errors.New("lookup failed")
+
+func (failingStore) GetRelationshipsByIDs(ctx context.Context, ids []string) ([]models.Relationship, error) {
+	return nil, errLookup
+}
+
+func TestImportReportsStoreErrors(t *testing.T) {
+	st := failingStore{newTestStore(t)}
+	doc := graphfile.Document{Edges: []graphfile.Edge{{ID: "r2", Source: "a", Target: "b"}}}
+	if _, err := Import(context.Background(), st, doc, Options{DryRun: true}); !errors.Is(err, errLookup) {
+		t.Errorf("Import = %v, want the store's error", err)
+	}
+}
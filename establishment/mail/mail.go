@@ -0,0 +1,139 @@
+// Package mail sends the emails of account flows such as address
+// verification and password resets. SMTPMailer delivers them; FileMailer and
+// LogMailer keep them local for development and tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP server, using STARTTLS when
+// the server offers it.
+type SMTPMailer struct {
+	// Addr is the host:port of the server.
+	Addr string
+	From string
+	// Auth may be nil for servers that accept mail without logging in.
+	Auth smtp.Auth
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// FileMailer writes each message as an .eml file into Dir.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	if err := os.WriteFile(filepath.Join(m.Dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogMailer only logs messages, links included, so it must not be used in
+// production.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FromEnv picks the mailer named by MAILER:
+//
+//   - "smtp" sends through SMTP_ADDR, logging in with SMTP_USERNAME and
+//     SMTP_PASSWORD if set;
+//   - "file" writes into MAIL_DIR;
+//   - "log" (the default) logs messages.
+//
+// MAIL_FROM is the sender address.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch kind := os.Getenv("MAILER"); kind {
+	case "", "log":
+		return LogMailer{}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("MAIL_DIR is required for MAILER=file")
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create MAIL_DIR: %w", err)
+		}
+		return FileMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_ADDR %q: %w", addr, err)
+		}
+		mailer := SMTPMailer{Addr: addr, From: from}
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mailer, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
+
+// format renders msg as an RFC 5322 message from the given sender.
+func format(from string, msg Message) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("invalid mail header %q", header)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+
+	"establishment/v1/establishment/models"
+)
+
+func (s *Store) AddAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.Target != nil {
+		target := *entry.Target
+		entry.Target = &target
+	}
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *Store) GetAuditEntries(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Entries are appended in order, so walking backwards yields the
+	// newest first.
+	entries := []models.AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < query.Limit; i-- {
+		entry := s.audit[i]
+		if (query.User == "" || entry.UserID == query.User || entry.Login == query.User) &&
+			(query.Action == "" || entry.Action == query.Action) &&
+			(query.Since == 0 || entry.CreatedAt >= query.Since) &&
+			(query.Until == 0 || entry.CreatedAt <= query.Until) {
+			if entry.Target != nil {
+				target := *entry.Target
+				entry.Target = &target
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// hop is one step from a person to a neighbour over a relationship,
+// regardless of the relationship's stored direction.
+type hop struct {
+	to  string
+	rel models.Relationship
+}
+
+// adjacency returns the undirected neighbour lists of the relationships
+// accepted by keep. Callers must hold s.mu.
+func (s *Store) adjacency(keep func(models.Relationship) bool) map[string][]hop {
+	adj := make(map[string][]hop)
+	for _, rel := range s.relationships {
+		if !keep(rel) {
+			continue
+		}
+		adj[rel.From] = append(adj[rel.From], hop{to: rel.To, rel: rel})
+		adj[rel.To] = append(adj[rel.To], hop{to: rel.From, rel: rel})
+	}
+	return adj
+}
+
+func typeFilter(types []string) func(models.Relationship) bool {
+	if len(types) == 0 {
+		return func(models.Relationship) bool { return true }
+	}
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[t] = true
+	}
+	return func(rel models.Relationship) bool { return allowed[rel.Type] }
+}
+
+func (s *Store) ShortestPaths(ctx context.Context, query models.PathQuery) (models.PathResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, fromOk := s.persons[query.From]
+	_, toOk := s.persons[query.To]
+	if !fromOk || !toOk {
+		return models.PathResult{}, store.ErrNoSuchPerson
+	}
+
+	depth := min(max(query.MaxDepth, 1), store.MaxTraversalDepth)
+	adj := s.adjacency(typeFilter(query.Types))
+
+	// Breadth-first search recording, for every person reached, all hops
+	// that reach it at its shortest distance.
+	dist := map[string]int{query.From: 0}
+	parents := make(map[string][]hop)
+	frontier := []string{query.From}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		if _, found := dist[query.To]; found {
+			break
+		}
+		var next []string
+		for _, id := range frontier {
+			for _, h := range adj[id] {
+				seen, ok := dist[h.to]
+				if !ok {
+					dist[h.to] = d
+					next = append(next, h.to)
+				} else if seen != d {
+					continue
+				}
+				parents[h.to] = append(parents[h.to], hop{to: id, rel: h.rel})
+			}
+		}
+		frontier = next
+	}
+
+	result := models.PathResult{Graph: models.Graph{Nodes: []models.Person{}, Edges: []models.Relationship{}}, Paths: []models.Path{}}
+	if _, found := dist[query.To]; !found || query.From == query.To {
+		return result, nil
+	}
+
+	limit := store.MaxPaths
+	if !query.All {
+		limit = 1
+	}
+
+	// Walk the parent links back from the target to enumerate the paths.
+	var walk func(id string, nodes []string, hops []models.Relationship)
+	walk = func(id string, nodes []string, hops []models.Relationship) {
+		if len(result.Paths) >= limit {
+			return
+		}
+		if id == query.From {
+			path := models.Path{Nodes: make([]string, 0, len(nodes)), Hops: make([]models.Relationship, 0, len(hops))}
+			for i := len(nodes) - 1; i >= 0; i-- {
+				path.Nodes = append(path.Nodes, nodes[i])
+			}
+			for i := len(hops) - 1; i >= 0; i-- {
+				path.Hops = append(path.Hops, hops[i])
+			}
+			result.Paths = append(result.Paths, path)
+			return
+		}
+		for _, p := range parents[id] {
+			walk(p.to, append(nodes, p.to), append(hops, p.rel))
+		}
+	}
+	walk(query.To, []string{query.To}, nil)
+
+	seenNodes := make(map[string]bool)
+	seenEdges := make(map[string]bool)
+	for _, path := range result.Paths {
+		for _, id := range path.Nodes {
+			if !seenNodes[id] {
+				seenNodes[id] = true
+				result.Nodes = append(result.Nodes, s.persons[id])
+			}
+		}
+		for _, rel := range path.Hops {
+			if !seenEdges[rel.ID] {
+				seenEdges[rel.ID] = true
+				result.Edges = append(result.Edges, rel)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) GetNetwork(ctx context.Context, query models.NetworkQuery) (models.Graph, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	center, ok := s.persons[query.PersonID]
+	if !ok {
+		return models.Graph{}, store.ErrNoSuchPerson
+	}
+
+	depth := min(max(query.Depth, 1), store.MaxTraversalDepth)
+	keep := typeFilter(query.Types)
+	neighbours := make(map[string][]hop)
+	for _, rel := range s.relationships {
+		if !keep(rel) || (query.At != "" && !rel.ActiveAt(query.At)) {
+			continue
+		}
+		if query.Direction != models.DirectionIn {
+			neighbours[rel.From] = append(neighbours[rel.From], hop{to: rel.To, rel: rel})
+		}
+		if query.Direction != models.DirectionOut {
+			neighbours[rel.To] = append(neighbours[rel.To], hop{to: rel.From, rel: rel})
+		}
+	}
+
+	graph := models.Graph{Nodes: []models.Person{center}, Edges: []models.Relationship{}}
+	visited := map[string]bool{center.ID: true}
+	seenEdges := make(map[string]bool)
+	frontier := []string{center.ID}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []string
+		for _, id := range frontier {
+			for _, h := range neighbours[id] {
+				if !seenEdges[h.rel.ID] {
+					seenEdges[h.rel.ID] = true
+					graph.Edges = append(graph.Edges, h.rel)
+				}
+				if !visited[h.to] {
+					visited[h.to] = true
+					graph.Nodes = append(graph.Nodes, s.persons[h.to])
+					next = append(next, h.to)
+				}
+			}
+		}
+		frontier = next
+	}
+	return graph, nil
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// nodeIDs returns the sorted IDs of the persons in graph.
+func nodeIDs(graph models.Graph) []string {
+	ids := make([]string, 0, len(graph.Nodes))
+	for _, person := range graph.Nodes {
+		ids = append(ids, person.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestShortestPaths(t *testing.T) {
+	// a - b - d and a - c - d are the two shortest routes from a to d;
+	// e is only reached through d, and f is not connected at all.
+	s := newTestStore(t, "a", "b", "c", "d", "e", "f")
+	addRelationships(t, s,
+		[2]string{"a", "b"}, [2]string{"b", "d"},
+		[2]string{"c", "a"}, [2]string{"d", "c"},
+		[2]string{"d", "e"})
+
+	tests := []struct {
+		name      string
+		query     models.PathQuery
+		wantPaths [][]string
+	}{
+		{"direct", models.PathQuery{From: "a", To: "b", MaxDepth: 3}, [][]string{{"a", "b"}}},
+		{"one of two", models.PathQuery{From: "a", To: "d", MaxDepth: 3}, [][]string{{"a", "b", "d"}}},
+		{"all", models.PathQuery{From: "a", To: "d", MaxDepth: 3, All: true}, [][]string{{"a", "b", "d"}, {"a", "c", "d"}}},
+		{"against direction", models.PathQuery{From: "e", To: "a", MaxDepth: 3, All: true}, [][]string{{"e", "d", "b", "a"}, {"e", "d", "c", "a"}}},
+		{"too deep", models.PathQuery{From: "a", To: "e", MaxDepth: 2}, [][]string{}},
+		{"not connected", models.PathQuery{From: "a", To: "f", MaxDepth: 5}, [][]string{}},
+		{"same person", models.PathQuery{From: "a", To: "a", MaxDepth: 3}, [][]string{}},
+		{"type filter", models.PathQuery{From: "a", To: "b", MaxDepth: 3, Types: []string{"other"}}, [][]string{}},
+	}
+	for _, tt := range tests {
+		result, err := s.ShortestPaths(context.Background(), tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var paths [][]string
+		for _, path := range result.Paths {
+			if len(path.Hops) != len(path.Nodes)-1 {
+				t.Errorf("%s: path %v has %d hops", tt.name, path.Nodes, len(path.Hops))
+			}
+			paths = append(paths, path.Nodes)
+		}
+		sort.Slice(paths, func(i, j int) bool { return slices.Compare(paths[i], paths[j]) < 0 })
+		if len(paths) != len(tt.wantPaths) {
+			t.Errorf("%s: paths = %v, want %v", tt.name, paths, tt.wantPaths)
+			continue
+		}
+		for i := range paths {
+			if !slices.Equal(paths[i], tt.wantPaths[i]) {
+				t.Errorf("%s: paths = %v, want %v", tt.name, paths, tt.wantPaths)
+				break
+			}
+		}
+	}
+
+	if _, err := s.ShortestPaths(context.Background(), models.PathQuery{From: "a", To: "missing", MaxDepth: 3}); err != store.ErrNoSuchPerson {
+		t.Errorf("ShortestPaths to a missing person = %v, want ErrNoSuchPerson", err)
+	}
+}
+
+func TestGetNetwork(t *testing.T) {
+	// a -> b -> c -> d, and e -> a.
+	s := newTestStore(t, "a", "b", "c", "d", "e")
+	addRelationships(t, s, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"}, [2]string{"e", "a"})
+
+	tests := []struct {
+		name  string
+		query models.NetworkQuery
+		want  []string
+		edges int
+	}{
+		{"depth 1", models.NetworkQuery{PersonID: "a", Depth: 1, Direction: models.DirectionBoth}, []string{"a", "b", "e"}, 2},
+		{"depth 2", models.NetworkQuery{PersonID: "a", Depth: 2, Direction: models.DirectionBoth}, []string{"a", "b", "c", "e"}, 3},
+		{"outgoing", models.NetworkQuery{PersonID: "a", Depth: 3, Direction: models.DirectionOut}, []string{"a", "b", "c", "d"}, 3},
+		{"incoming", models.NetworkQuery{PersonID: "a", Depth: 3, Direction: models.DirectionIn}, []string{"a", "e"}, 1},
+		{"type filter", models.NetworkQuery{PersonID: "a", Depth: 3, Direction: models.DirectionBoth, Types: []string{"other"}}, []string{"a"}, 0},
+	}
+	for _, tt := range tests {
+		graph, err := s.GetNetwork(context.Background(), tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := nodeIDs(graph); !slices.Equal(got, tt.want) || len(graph.Edges) != tt.edges {
+			t.Errorf("%s: nodes %v with %d edges, want %v with %d", tt.name, got, len(graph.Edges), tt.want, tt.edges)
+		}
+	}
+
+	if _, err := s.GetNetwork(context.Background(), models.NetworkQuery{PersonID: "missing", Depth: 1}); err != store.ErrNoSuchPerson {
+		t.Errorf("GetNetwork of a missing person = %v, want ErrNoSuchPerson", err)
+	}
+}
+
+func TestGetGraphAt(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "a", "b")
+	rels := []models.Relationship{
+		{ID: "always", From: "a", To: "b"},
+		{ID: "nineties", From: "a", To: "b", StartDate: "1990", EndDate: "1999"},
+		{ID: "may-2001", From: "a", To: "b", StartDate: "2001-05", EndDate: "2001-05"},
+	}
+	for _, rel := range rels {
+		if err := s.AddRelationship(ctx, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		at   string
+		want []string
+	}{
+		{"", []string{"always", "nineties", "may-2001"}},
+		{"1999-12-31", []string{"always", "nineties"}},
+		{"2000-01-01", []string{"always"}},
+		{"2001-05-31", []string{"always", "may-2001"}},
+	}
+	for _, tt := range tests {
+		graph, err := s.GetGraph(ctx, models.GraphFilter{At: tt.at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, rel := range graph.Edges {
+			got = append(got, rel.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetGraph at %q = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
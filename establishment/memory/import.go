@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) ImportBatch(ctx context.Context, batch store.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check everything before changing anything, so that a failing batch
+	// leaves no trace.
+	added := make(map[string]bool, len(batch.Persons))
+	for _, person := range batch.Persons {
+		if _, ok := s.persons[person.ID]; ok || added[person.ID] {
+			return fmt.Errorf("person %s: %w", person.ID, store.ErrPersonExists)
+		}
+		added[person.ID] = true
+	}
+	for _, patch := range batch.PersonUpdates {
+		if _, ok := s.persons[patch.ID]; !ok && !added[patch.ID] {
+			return fmt.Errorf("person %s: %w", patch.ID, store.ErrNoSuchPerson)
+		}
+	}
+	for _, rel := range batch.Relationships {
+		if rel.From == rel.To {
+			return fmt.Errorf("relationship %s: %w", rel.ID, store.ErrInvalidRelationship)
+		}
+		_, fromOk := s.persons[rel.From]
+		_, toOk := s.persons[rel.To]
+		if !(fromOk || added[rel.From]) || !(toOk || added[rel.To]) {
+			return fmt.Errorf("relationship %s: %w", rel.ID, store.ErrPersonsNotFound)
+		}
+	}
+	for _, patch := range batch.RelationshipUpdates {
+		if s.relationshipIndex(patch.ID) < 0 && !slices.ContainsFunc(batch.Relationships, func(rel models.Relationship) bool { return rel.ID == patch.ID }) {
+			return fmt.Errorf("relationship %s: %w", patch.ID, store.ErrNoSuchRelationship)
+		}
+	}
+
+	for _, person := range batch.Persons {
+		if err := s.record(ctx, personRef(person.ID), nil, person); err != nil {
+			return err
+		}
+		s.persons[person.ID] = person
+	}
+	for _, patch := range batch.PersonUpdates {
+		person := s.persons[patch.ID]
+		updated := patch.Update.Apply(person)
+		if err := s.record(ctx, personRef(patch.ID), person, updated); err != nil {
+			return err
+		}
+		s.persons[patch.ID] = updated
+	}
+	for _, rel := range batch.Relationships {
+		if err := s.record(ctx, relationshipRef(rel.ID), nil, rel); err != nil {
+			return err
+		}
+		s.relationships = append(s.relationships, rel)
+	}
+	for _, patch := range batch.RelationshipUpdates {
+		i := s.relationshipIndex(patch.ID)
+		updated := patch.Update.Apply(s.relationships[i])
+		if err := s.record(ctx, relationshipRef(patch.ID), s.relationships[i], updated); err != nil {
+			return err
+		}
+		s.relationships[i] = updated
+	}
+	return nil
+}
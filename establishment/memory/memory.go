@@ -0,0 +1,463 @@
+// Package memory implements store.Store entirely in process memory. It is
+// meant for local development and tests; nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// Store keeps all data in maps guarded by a single RWMutex.
+type Store struct {
+	mu            sync.RWMutex
+	persons       map[string]models.Person
+	relationships []models.Relationship
+	sources       map[string]models.Source
+	revisions     map[models.EntityRef][]models.Revision
+	proposals     map[string]models.Proposal
+	users         map[string]models.User
+	sessions      map[string]models.Session
+	tokens        map[string]models.APIToken
+	oneTimeTokens map[string]models.OneTimeToken
+	settings      models.Settings
+	audit         []models.AuditEntry
+}
+
+var _ store.Store = (*Store)(nil)
+
+func NewStore() *Store {
+	return &Store{
+		persons:       make(map[string]models.Person),
+		sources:       make(map[string]models.Source),
+		revisions:     make(map[models.EntityRef][]models.Revision),
+		proposals:     make(map[string]models.Proposal),
+		users:         make(map[string]models.User),
+		sessions:      make(map[string]models.Session),
+		tokens:        make(map[string]models.APIToken),
+		oneTimeTokens: make(map[string]models.OneTimeToken),
+	}
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) AddPerson(ctx context.Context, person models.Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.persons[person.ID]; ok {
+		return store.ErrPersonExists
+	}
+	if err := s.record(ctx, personRef(person.ID), nil, person); err != nil {
+		return err
+	}
+	s.persons[person.ID] = person
+	return nil
+}
+
+func (s *Store) GetPerson(ctx context.Context, id string) (models.Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	person, ok := s.persons[id]
+	if !ok {
+		return models.Person{}, store.ErrNoSuchPerson
+	}
+	return person, nil
+}
+
+func (s *Store) GetPersons(ctx context.Context) ([]models.Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedPersons(), nil
+}
+
+func (s *Store) GetPersonsByIDs(ctx context.Context, ids []string) ([]models.Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	persons := []models.Person{}
+	for _, id := range ids {
+		if person, ok := s.persons[id]; ok && !slices.ContainsFunc(persons, func(found models.Person) bool { return found.ID == id }) {
+			persons = append(persons, person)
+		}
+	}
+	return persons, nil
+}
+
+func (s *Store) UpdatePerson(ctx context.Context, id string, update models.PersonUpdate) (models.Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	person, ok := s.persons[id]
+	if !ok {
+		return models.Person{}, store.ErrNoSuchPerson
+	}
+	updated := update.Apply(person)
+	if err := s.record(ctx, personRef(id), person, updated); err != nil {
+		return models.Person{}, err
+	}
+	s.persons[id] = updated
+	return updated, nil
+}
+
+func (s *Store) DeletePerson(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	person, ok := s.persons[id]
+	if !ok {
+		return store.ErrNoSuchPerson
+	}
+	if err := s.record(ctx, personRef(id), person, nil); err != nil {
+		return err
+	}
+	for _, rel := range s.relationships {
+		if rel.From != id && rel.To != id {
+			continue
+		}
+		if err := s.record(ctx, relationshipRef(rel.ID), rel, nil); err != nil {
+			return err
+		}
+	}
+	delete(s.persons, id)
+
+	kept := s.relationships[:0]
+	for _, rel := range s.relationships {
+		if rel.From != id && rel.To != id {
+			kept = append(kept, rel)
+		}
+	}
+	s.relationships = kept
+	return nil
+}
+
+func (s *Store) AddRelationship(ctx context.Context, rel models.Relationship) error {
+	if rel.From == rel.To {
+		return store.ErrInvalidRelationship
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, fromOk := s.persons[rel.From]
+	_, toOk := s.persons[rel.To]
+	if !fromOk || !toOk {
+		return store.ErrPersonsNotFound
+	}
+
+	if err := s.record(ctx, relationshipRef(rel.ID), nil, rel); err != nil {
+		return err
+	}
+	s.relationships = append(s.relationships, rel)
+	return nil
+}
+
+func (s *Store) GetRelationship(ctx context.Context, id string) (models.Relationship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.relationshipIndex(id)
+	if i < 0 {
+		return models.Relationship{}, store.ErrNoSuchRelationship
+	}
+	return s.relationships[i], nil
+}
+
+func (s *Store) GetRelationshipsByIDs(ctx context.Context, ids []string) ([]models.Relationship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rels := []models.Relationship{}
+	for _, id := range ids {
+		if i := s.relationshipIndex(id); i >= 0 && !slices.ContainsFunc(rels, func(found models.Relationship) bool { return found.ID == id }) {
+			rels = append(rels, s.relationships[i])
+		}
+	}
+	return rels, nil
+}
+
+func (s *Store) UpdateRelationship(ctx context.Context, id string, update models.RelationshipUpdate) (models.Relationship, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.relationshipIndex(id)
+	if i < 0 {
+		return models.Relationship{}, store.ErrNoSuchRelationship
+	}
+	updated := update.Apply(s.relationships[i])
+	if err := s.record(ctx, relationshipRef(id), s.relationships[i], updated); err != nil {
+		return models.Relationship{}, err
+	}
+	s.relationships[i] = updated
+	return s.relationships[i], nil
+}
+
+func (s *Store) DeleteRelationship(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.relationshipIndex(id)
+	if i < 0 {
+		return store.ErrNoSuchRelationship
+	}
+	if err := s.record(ctx, relationshipRef(id), s.relationships[i], nil); err != nil {
+		return err
+	}
+	s.relationships = append(s.relationships[:i], s.relationships[i+1:]...)
+	return nil
+}
+
+func (s *Store) GetPersonRelationships(ctx context.Context, personID string) ([]models.Relationship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.persons[personID]; !ok {
+		return nil, store.ErrNoSuchPerson
+	}
+
+	rels := []models.Relationship{}
+	for _, rel := range s.relationships {
+		if rel.From == personID || rel.To == personID {
+			rels = append(rels, rel)
+		}
+	}
+	return rels, nil
+}
+
+func (s *Store) GetGraph(ctx context.Context, filter models.GraphFilter) (models.Graph, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	edges := make([]models.Relationship, 0, len(s.relationships))
+	for _, rel := range s.relationships {
+		if filter.At == "" || rel.ActiveAt(filter.At) {
+			edges = append(edges, rel)
+		}
+	}
+	return models.Graph{Nodes: s.sortedPersons(), Edges: edges}, nil
+}
+
+func (s *Store) AddUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Login == user.Login || existing.Email == user.Email ||
+			(user.OIDCIdentity != "" && existing.OIDCIdentity == user.OIDCIdentity) {
+			return store.ErrUserExists
+		}
+	}
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+	return models.User{}, store.ErrNoSuchUser
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, store.ErrNoSuchUser
+	}
+	return user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, store.ErrNoSuchUser
+}
+
+func (s *Store) GetUserByOIDCIdentity(ctx context.Context, identity string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.OIDCIdentity == identity {
+			return user, nil
+		}
+	}
+	return models.User{}, store.ErrNoSuchUser
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+	return users, nil
+}
+
+func (s *Store) GrantRole(ctx context.Context, userID, role string) (models.User, error) {
+	return s.updateRoles(userID, func(roles []string) []string {
+		if slices.Contains(roles, role) {
+			return roles
+		}
+		return append(slices.Clone(roles), role)
+	})
+}
+
+func (s *Store) RevokeRole(ctx context.Context, userID, role string) (models.User, error) {
+	return s.updateRoles(userID, func(roles []string) []string {
+		return slices.DeleteFunc(slices.Clone(roles), func(held string) bool { return held == role })
+	})
+}
+
+func (s *Store) updateRoles(userID string, change func(roles []string) []string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, store.ErrNoSuchUser
+	}
+	user.Roles = change(user.Roles)
+	s.users[userID] = user
+	return user, nil
+}
+
+func (s *Store) SetPassword(ctx context.Context, userID, hash string) error {
+	return s.updateUser(userID, func(user *models.User) { user.Password = hash })
+}
+
+func (s *Store) SetEmailVerified(ctx context.Context, userID string) error {
+	return s.updateUser(userID, func(user *models.User) { user.EmailVerified = true })
+}
+
+func (s *Store) updateUser(userID string, change func(user *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return store.ErrNoSuchUser
+	}
+	change(&user)
+	s.users[userID] = user
+	return nil
+}
+
+func (s *Store) SetTOTP(ctx context.Context, userID, secret string, enabled bool, recoveryCodes []string) error {
+	return s.updateUser(userID, func(user *models.User) {
+		user.TOTPSecret = secret
+		user.TOTPEnabled = enabled
+		user.RecoveryCodes = slices.Clone(recoveryCodes)
+	})
+}
+
+func (s *Store) AcceptTOTPCounter(ctx context.Context, userID string, counter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return store.ErrNoSuchUser
+	}
+	if counter <= user.TOTPCounter {
+		return store.ErrCodeUsed
+	}
+	user.TOTPCounter = counter
+	s.users[userID] = user
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return store.ErrNoSuchUser
+	}
+	i := slices.Index(user.RecoveryCodes, hash)
+	if i < 0 {
+		return store.ErrCodeUsed
+	}
+	user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+	s.users[userID] = user
+	return nil
+}
+
+func (s *Store) SetOIDCIdentity(ctx context.Context, userID, identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return store.ErrNoSuchUser
+	}
+	for _, existing := range s.users {
+		if existing.ID != userID && existing.OIDCIdentity == identity {
+			return store.ErrUserExists
+		}
+	}
+	user.OIDCIdentity = identity
+	s.users[userID] = user
+	return nil
+}
+
+func (s *Store) GetSettings(ctx context.Context) (models.Settings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.settings, nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings models.Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings = settings
+	return nil
+}
+
+// relationshipIndex returns the position of the relationship with the given
+// ID in s.relationships, or -1. Callers must hold s.mu.
+func (s *Store) relationshipIndex(id string) int {
+	for i, rel := range s.relationships {
+		if rel.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortedPersons returns all persons ordered by ID. Callers must hold s.mu.
+func (s *Store) sortedPersons() []models.Person {
+	persons := make([]models.Person, 0, len(s.persons))
+	for _, person := range s.persons {
+		persons = append(persons, person)
+	}
+	sort.Slice(persons, func(i, j int) bool { return persons[i].ID < persons[j].ID })
+	return persons
+}
@@ -0,0 +1,409 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// newTestStore returns a store holding the persons with the given IDs, each
+// named after its ID.
+func newTestStore(t *testing.T, ids ...string) *Store {
+	t.Helper()
+	s := NewStore()
+	for _, id := range ids {
+		if err := s.AddPerson(context.Background(), models.Person{ID: id, Name: id}); err != nil {
+			t.Fatalf("AddPerson(%s): %v", id, err)
+		}
+	}
+	return s
+}
+
+// addRelationships adds a relationship of type "knows" for every pair of
+// IDs in ends, named r1, r2 and so on.
+func addRelationships(t *testing.T, s *Store, ends ...[2]string) {
+	t.Helper()
+	for i, end := range ends {
+		rel := models.Relationship{ID: "r" + string(rune('1'+i)), From: end[0], To: end[1], Type: "knows"}
+		if err := s.AddRelationship(context.Background(), rel); err != nil {
+			t.Fatalf("AddRelationship(%s -> %s): %v", end[0], end[1], err)
+		}
+	}
+}
+
+func TestPersons(t *testing.T) {
+	ctx := store.WithAuthor(context.Background(), "u1")
+	s := newTestStore(t, "b", "a")
+
+	if err := s.AddPerson(ctx, models.Person{ID: "a", Name: "again"}); err != store.ErrPersonExists {
+		t.Errorf("AddPerson of an existing ID = %v, want ErrPersonExists", err)
+	}
+	if _, err := s.GetPerson(ctx, "missing"); err != store.ErrNoSuchPerson {
+		t.Errorf("GetPerson of a missing ID = %v, want ErrNoSuchPerson", err)
+	}
+	persons, err := s.GetPersons(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(persons) != 2 || persons[0].ID != "a" || persons[1].ID != "b" {
+		t.Errorf("GetPersons = %+v, want a then b", persons)
+	}
+
+	name := "Alice"
+	updated, err := s.UpdatePerson(ctx, "a", models.PersonUpdate{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Alice" {
+		t.Errorf("UpdatePerson returned name %q", updated.Name)
+	}
+	if _, err := s.UpdatePerson(ctx, "missing", models.PersonUpdate{Name: &name}); err != store.ErrNoSuchPerson {
+		t.Errorf("UpdatePerson of a missing ID = %v, want ErrNoSuchPerson", err)
+	}
+
+	found, err := s.GetPersonsByIDs(ctx, []string{"a", "missing", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != "a" {
+		t.Errorf("GetPersonsByIDs = %v, want only a, once", found)
+	}
+
+	revisions, err := s.GetRevisions(ctx, models.EntityRef{Type: models.EntityPerson, ID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[1].Action != models.ActionUpdate || revisions[1].Version != 2 || revisions[1].AuthorID != "u1" {
+		t.Errorf("revisions after create and update = %+v", revisions)
+	}
+}
+
+func TestDeletePersonRemovesRelationships(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "a", "b", "c")
+	addRelationships(t, s, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "a"})
+
+	if err := s.DeletePerson(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeletePerson(ctx, "b"); err != store.ErrNoSuchPerson {
+		t.Errorf("second DeletePerson = %v, want ErrNoSuchPerson", err)
+	}
+	graph, err := s.GetGraph(ctx, models.GraphFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 || graph.Edges[0].ID != "r3" {
+		t.Errorf("graph after deleting b = %+v", graph)
+	}
+	revisions, err := s.GetRevisions(ctx, models.EntityRef{Type: models.EntityRelationship, ID: "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[1].Action != models.ActionDelete {
+		t.Errorf("revisions of a relationship deleted with its person = %+v", revisions)
+	}
+}
+
+func TestRelationships(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, "a", "b")
+
+	tests := []struct {
+		name string
+		rel  models.Relationship
+		want error
+	}{
+		{"valid", models.Relationship{ID: "r1", From: "a", To: "b", Type: "knows"}, nil},
+		{"same ends", models.Relationship{ID: "r2", From: "a", To: "a"}, store.ErrInvalidRelationship},
+		{"unknown target", models.Relationship{ID: "r3", From: "a", To: "missing"}, store.ErrPersonsNotFound},
+		{"unknown source", models.Relationship{ID: "r4", From: "missing", To: "b"}, store.ErrPersonsNotFound},
+	}
+	for _, tt := range tests {
+		if err := s.AddRelationship(ctx, tt.rel); err != tt.want {
+			t.Errorf("%s: AddRelationship = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	details := "since school"
+	rel, err := s.UpdateRelationship(ctx, "r1", models.RelationshipUpdate{Details: &details})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Details != details || rel.From != "a" || rel.To != "b" {
+		t.Errorf("UpdateRelationship = %+v", rel)
+	}
+
+	found, err := s.GetRelationshipsByIDs(ctx, []string{"r1", "r3", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Details != details {
+		t.Errorf("GetRelationshipsByIDs = %+v, want only r1, once", found)
+	}
+
+	rels, err := s.GetPersonRelationships(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rels) != 1 {
+		t.Errorf("GetPersonRelationships(b) = %+v", rels)
+	}
+
+	if err := s.DeleteRelationship(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRelationship(ctx, "r1"); err != store.ErrNoSuchRelationship {
+		t.Errorf("GetRelationship after delete = %v, want ErrNoSuchRelationship", err)
+	}
+	if _, err := s.UpdateRelationship(ctx, "r1", models.RelationshipUpdate{Details: &details}); err != store.ErrNoSuchRelationship {
+		t.Errorf("UpdateRelationship after delete = %v, want ErrNoSuchRelationship", err)
+	}
+}
+
+func TestImportBatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	name := "renamed"
+
+	tests := []struct {
+		name  string
+		batch store.Batch
+		want  error
+	}{
+		{
+			"existing person",
+			store.Batch{Persons: []models.Person{{ID: "new", Name: "new"}, {ID: "a", Name: "a"}}},
+			store.ErrPersonExists,
+		},
+		{
+			"duplicate in batch",
+			store.Batch{Persons: []models.Person{{ID: "new", Name: "new"}, {ID: "new", Name: "new"}}},
+			store.ErrPersonExists,
+		},
+		{
+			"unknown end",
+			store.Batch{
+				Persons:       []models.Person{{ID: "new", Name: "new"}},
+				Relationships: []models.Relationship{{ID: "r9", From: "new", To: "missing"}},
+			},
+			store.ErrPersonsNotFound,
+		},
+		{
+			"unknown update",
+			store.Batch{
+				Persons:       []models.Person{{ID: "new", Name: "new"}},
+				PersonUpdates: []store.PersonPatch{{ID: "missing", Update: models.PersonUpdate{Name: &name}}},
+			},
+			store.ErrNoSuchPerson,
+		},
+		{
+			"unknown relationship update",
+			store.Batch{
+				Persons:             []models.Person{{ID: "new", Name: "new"}},
+				RelationshipUpdates: []store.RelationshipPatch{{ID: "missing", Update: models.RelationshipUpdate{Details: &name}}},
+			},
+			store.ErrNoSuchRelationship,
+		},
+	}
+	for _, tt := range tests {
+		s := newTestStore(t, "a", "b")
+		if err := s.ImportBatch(ctx, tt.batch); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ImportBatch = %v, want %v", tt.name, err, tt.want)
+		}
+		if _, err := s.GetPerson(ctx, "new"); err != store.ErrNoSuchPerson {
+			t.Errorf("%s: failed batch left person new behind", tt.name)
+		}
+	}
+
+	s := newTestStore(t, "a", "b")
+	batch := store.Batch{
+		Persons:             []models.Person{{ID: "c", Name: "c"}},
+		Relationships:       []models.Relationship{{ID: "r1", From: "a", To: "c", Type: "knows"}},
+		PersonUpdates:       []store.PersonPatch{{ID: "c", Update: models.PersonUpdate{Name: &name}}},
+		RelationshipUpdates: []store.RelationshipPatch{{ID: "r1", Update: models.RelationshipUpdate{Details: &name}}},
+	}
+	if err := s.ImportBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	person, err := s.GetPerson(ctx, "c")
+	if err != nil || person.Name != name {
+		t.Errorf("imported person = %+v, %v", person, err)
+	}
+	rel, err := s.GetRelationship(ctx, "r1")
+	if err != nil || rel.Details != name {
+		t.Errorf("imported relationship = %+v, %v", rel, err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	if err := s.AddUser(ctx, models.User{ID: "u1", Login: "alice", Email: "alice@example.test", OIDCIdentity: "issuer alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		user models.User
+	}{
+		{"same login", models.User{ID: "u2", Login: "alice", Email: "other@example.test"}},
+		{"same email", models.User{ID: "u2", Login: "other", Email: "alice@example.test"}},
+		{"same OIDC identity", models.User{ID: "u2", Login: "other", Email: "other@example.test", OIDCIdentity: "issuer alice"}},
+	}
+	for _, tt := range tests {
+		if err := s.AddUser(ctx, tt.user); err != store.ErrUserExists {
+			t.Errorf("%s: AddUser = %v, want ErrUserExists", tt.name, err)
+		}
+	}
+
+	if user, err := s.GetUserByLogin(ctx, "alice"); err != nil || user.ID != "u1" {
+		t.Errorf("GetUserByLogin = %+v, %v", user, err)
+	}
+	if _, err := s.GetUserByID(ctx, "u2"); err != store.ErrNoSuchUser {
+		t.Errorf("GetUserByID of an unknown ID = %v, want ErrNoSuchUser", err)
+	}
+
+	if err := s.AddUser(ctx, models.User{ID: "u2", Login: "bob", Email: "bob@example.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetOIDCIdentity(ctx, "u2", "issuer alice"); err != store.ErrUserExists {
+		t.Errorf("SetOIDCIdentity to a linked identity = %v, want ErrUserExists", err)
+	}
+	if user, err := s.GetUserByOIDCIdentity(ctx, "issuer alice"); err != nil || user.ID != "u1" {
+		t.Errorf("GetUserByOIDCIdentity = %+v, %v", user, err)
+	}
+	if _, err := s.GetUserByEmail(ctx, "nobody@example.test"); err != store.ErrNoSuchUser {
+		t.Errorf("GetUserByEmail of an unknown address = %v, want ErrNoSuchUser", err)
+	}
+
+	user, err := s.GrantRole(ctx, "u2", models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = s.GrantRole(ctx, "u2", models.RoleEditor); err != nil || len(user.Roles) != 1 {
+		t.Errorf("granting a held role = %+v, %v", user.Roles, err)
+	}
+	if user, err = s.RevokeRole(ctx, "u2", models.RoleEditor); err != nil || len(user.Roles) != 0 {
+		t.Errorf("RevokeRole = %+v, %v", user.Roles, err)
+	}
+}
+
+func TestSecondFactorsWorkOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	if err := s.AddUser(ctx, models.User{ID: "u1", Login: "alice", Email: "alice@example.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTOTP(ctx, "u1", "SECRET", true, []string{"h1", "h2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		counter int64
+		want    error
+	}{
+		{10, nil},
+		{10, store.ErrCodeUsed},
+		{9, store.ErrCodeUsed},
+		{11, nil},
+	}
+	for _, tt := range tests {
+		if err := s.AcceptTOTPCounter(ctx, "u1", tt.counter); err != tt.want {
+			t.Errorf("AcceptTOTPCounter(%d) = %v, want %v", tt.counter, err, tt.want)
+		}
+	}
+
+	if err := s.UseRecoveryCode(ctx, "u1", "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseRecoveryCode(ctx, "u1", "h1"); err != store.ErrCodeUsed {
+		t.Errorf("reusing a recovery code = %v, want ErrCodeUsed", err)
+	}
+	user, err := s.GetUserByID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.RecoveryCodes) != 1 || user.RecoveryCodes[0] != "h2" {
+		t.Errorf("remaining recovery codes = %v, want [h2]", user.RecoveryCodes)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	sessions := []models.Session{
+		{ID: "s1", UserID: "u1", ExpiresAt: 200, LastSeenAt: 10},
+		{ID: "s2", UserID: "u1", ExpiresAt: 200, LastSeenAt: 20},
+		{ID: "s3", UserID: "u1", ExpiresAt: 50, LastSeenAt: 30},
+		{ID: "s4", UserID: "u2", ExpiresAt: 200, LastSeenAt: 40},
+	}
+	for _, session := range sessions {
+		if err := s.CreateSession(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := s.GetUserSessions(ctx, "u1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 || active[0].ID != "s2" || active[1].ID != "s1" {
+		t.Errorf("GetUserSessions = %+v, want s2 then s1", active)
+	}
+
+	if err := s.TouchSession(ctx, "s1", 90, 300); err != nil {
+		t.Fatal(err)
+	}
+	if session, err := s.GetSession(ctx, "s1"); err != nil || session.LastSeenAt != 90 || session.ExpiresAt != 300 {
+		t.Errorf("session after TouchSession = %+v, %v", session, err)
+	}
+	if err := s.TouchSession(ctx, "missing", 90, 300); err != store.ErrNoSuchSession {
+		t.Errorf("TouchSession of a missing session = %v, want ErrNoSuchSession", err)
+	}
+
+	if n, err := s.DeleteExpiredSessions(ctx, 100); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredSessions = %d, %v, want 1", n, err)
+	}
+	if n, err := s.DeleteUserSessions(ctx, "u1", "s1"); err != nil || n != 1 {
+		t.Errorf("DeleteUserSessions = %d, %v, want 1", n, err)
+	}
+	for id, want := range map[string]error{"s1": nil, "s2": store.ErrNoSuchSession, "s3": store.ErrNoSuchSession, "s4": nil} {
+		if _, err := s.GetSession(ctx, id); err != want {
+			t.Errorf("GetSession(%s) = %v, want %v", id, err, want)
+		}
+	}
+}
+
+func TestOneTimeTokens(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	tokens := []models.OneTimeToken{
+		{Hash: "h1", UserID: "u1", Purpose: models.PurposeResetPassword, ExpiresAt: 100},
+		{Hash: "h2", UserID: "u1", Purpose: models.PurposeResetPassword, ExpiresAt: 10},
+		{Hash: "h3", UserID: "u1", Purpose: models.PurposeVerifyEmail, ExpiresAt: 100},
+	}
+	for _, token := range tokens {
+		if err := s.AddOneTimeToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name, hash, purpose string
+		want                error
+	}{
+		{"wrong purpose", "h3", models.PurposeResetPassword, store.ErrNoSuchOneTimeToken},
+		{"valid", "h1", models.PurposeResetPassword, nil},
+		{"used", "h1", models.PurposeResetPassword, store.ErrNoSuchOneTimeToken},
+		{"expired", "h2", models.PurposeResetPassword, store.ErrNoSuchOneTimeToken},
+		{"unknown", "h4", models.PurposeResetPassword, store.ErrNoSuchOneTimeToken},
+	}
+	for _, tt := range tests {
+		if _, err := s.UseOneTimeToken(ctx, tt.hash, tt.purpose, 50); err != tt.want {
+			t.Errorf("%s: UseOneTimeToken = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
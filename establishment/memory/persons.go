@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"sort"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) ListPersons(ctx context.Context, query models.PersonQuery) (models.PersonPage, error) {
+	var cursor *store.PersonCursor
+	if query.Cursor != "" {
+		c, err := store.DecodeCursor(query.Cursor)
+		if err != nil {
+			return models.PersonPage{}, err
+		}
+		cursor = &c
+	}
+
+	// compare orders a before b by the sort key, then by ID.
+	compare := func(a, b store.PersonCursor) int {
+		switch {
+		case query.Sort == models.SortByCreatedAt && a.CreatedAt != b.CreatedAt:
+			return cmp.Compare(a.CreatedAt, b.CreatedAt)
+		case query.Sort != models.SortByCreatedAt && a.Name != b.Name:
+			return cmp.Compare(a.Name, b.Name)
+		default:
+			return cmp.Compare(a.ID, b.ID)
+		}
+	}
+	if query.Order == models.OrderDesc {
+		asc := compare
+		compare = func(a, b store.PersonCursor) int { return -asc(a, b) }
+	}
+
+	s.mu.RLock()
+	var matching []models.Person
+	for _, person := range s.persons {
+		if query.Occupation != "" && person.Occupation != query.Occupation {
+			continue
+		}
+		if query.HasTwitter != nil && (person.Twitter != "") != *query.HasTwitter {
+			continue
+		}
+		if query.CreatedAfter != 0 && person.CreatedAt <= query.CreatedAfter {
+			continue
+		}
+		matching = append(matching, person)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matching, func(i, j int) bool {
+		return compare(store.CursorFor(matching[i]), store.CursorFor(matching[j])) < 0
+	})
+
+	page := models.PersonPage{Items: []models.Person{}, Total: int64(len(matching))}
+	for _, person := range matching {
+		if cursor != nil && compare(store.CursorFor(person), *cursor) <= 0 {
+			continue
+		}
+		if len(page.Items) == query.Limit {
+			page.NextCursor = store.EncodeCursor(store.CursorFor(page.Items[len(page.Items)-1]))
+			break
+		}
+		page.Items = append(page.Items, person)
+	}
+	return page, nil
+}
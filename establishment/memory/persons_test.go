@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func TestListPersonsPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+	persons := []models.Person{
+		{ID: "1", Name: "Carol", Occupation: "judge", CreatedAt: 30},
+		{ID: "2", Name: "alice", Occupation: "judge", CreatedAt: 10, Twitter: "@alice"},
+		{ID: "3", Name: "Bob", Occupation: "mayor", CreatedAt: 20},
+		{ID: "4", Name: "Bob", Occupation: "judge", CreatedAt: 40},
+		{ID: "5", Name: "Dave", Occupation: "mayor", CreatedAt: 50, Twitter: "@dave"},
+	}
+	for _, person := range persons {
+		if err := s.AddPerson(ctx, person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	yes := true
+
+	tests := []struct {
+		name  string
+		query models.PersonQuery
+		want  []string
+	}{
+		{"by name", models.PersonQuery{Limit: 2}, []string{"3", "4", "1", "5", "2"}},
+		{"by name descending", models.PersonQuery{Limit: 2, Order: models.OrderDesc}, []string{"2", "5", "1", "4", "3"}},
+		{"by creation", models.PersonQuery{Limit: 3, Sort: models.SortByCreatedAt}, []string{"2", "3", "1", "4", "5"}},
+		{"occupation", models.PersonQuery{Limit: 1, Occupation: "judge"}, []string{"4", "1", "2"}},
+		{"has twitter", models.PersonQuery{Limit: 10, HasTwitter: &yes}, []string{"5", "2"}},
+		{"created after", models.PersonQuery{Limit: 10, Sort: models.SortByCreatedAt, CreatedAfter: 30}, []string{"4", "5"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		query := tt.query
+		for pages := 0; ; pages++ {
+			if pages > len(persons) {
+				t.Fatalf("%s: cursor does not advance", tt.name)
+			}
+			page, err := s.ListPersons(ctx, query)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if page.Total != int64(len(tt.want)) {
+				t.Errorf("%s: total = %d, want %d", tt.name, page.Total, len(tt.want))
+			}
+			if len(page.Items) > query.Limit {
+				t.Errorf("%s: page of %d items exceeds the limit", tt.name, len(page.Items))
+			}
+			for _, person := range page.Items {
+				got = append(got, person.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: pages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListPersonsInvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"!", "e30", store.EncodeCursor(store.PersonCursor{Name: "x"})} {
+		if _, err := NewStore().ListPersons(context.Background(), models.PersonQuery{Limit: 1, Cursor: cursor}); err != store.ErrInvalidCursor {
+			t.Errorf("ListPersons with cursor %q = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) AddProposal(ctx context.Context, proposal models.Proposal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.proposals[proposal.ID] = copyProposal(proposal)
+	return nil
+}
+
+func (s *Store) GetProposal(ctx context.Context, id string) (models.Proposal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	proposal, ok := s.proposals[id]
+	if !ok {
+		return models.Proposal{}, store.ErrNoSuchProposal
+	}
+	return copyProposal(proposal), nil
+}
+
+func (s *Store) GetProposals(ctx context.Context, query models.ProposalQuery) ([]models.Proposal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	proposals := []models.Proposal{}
+	for _, proposal := range s.proposals {
+		if (query.Status == "" || proposal.Status == query.Status) &&
+			(query.AuthorID == "" || proposal.AuthorID == query.AuthorID) {
+			proposals = append(proposals, copyProposal(proposal))
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].CreatedAt != proposals[j].CreatedAt {
+			return proposals[i].CreatedAt < proposals[j].CreatedAt
+		}
+		return proposals[i].ID < proposals[j].ID
+	})
+	return proposals, nil
+}
+
+func (s *Store) UpdateProposal(ctx context.Context, proposal models.Proposal, fromStatus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.proposals[proposal.ID]
+	if !ok {
+		return store.ErrNoSuchProposal
+	}
+	if current.Status != fromStatus {
+		return store.ErrProposalChanged
+	}
+	s.proposals[proposal.ID] = copyProposal(proposal)
+	return nil
+}
+
+// copyProposal keeps callers from changing stored proposals through the
+// Person and Relationship pointers.
+func copyProposal(proposal models.Proposal) models.Proposal {
+	if proposal.Person != nil {
+		person := *proposal.Person
+		proposal.Person = &person
+	}
+	if proposal.Relationship != nil {
+		rel := *proposal.Relationship
+		proposal.Relationship = &rel
+	}
+	return proposal
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) GetRevisions(ctx context.Context, target models.EntityRef) ([]models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.Revision{}, s.revisions[target]...), nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, target models.EntityRef, version int64) (models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := s.revisions[target]
+	if version < 1 || version > int64(len(revisions)) {
+		return models.Revision{}, store.ErrNoSuchRevision
+	}
+	return revisions[version-1], nil
+}
+
+// record appends a revision of target to its history. It is called before
+// the change is applied, so that a failure leaves the entity untouched.
+// Callers must hold s.mu for writing.
+func (s *Store) record(ctx context.Context, target models.EntityRef, before, after interface{}) error {
+	rev, err := store.NewRevision(ctx, target, before, after)
+	if err != nil {
+		return err
+	}
+	rev.Version = int64(len(s.revisions[target])) + 1
+	s.revisions[target] = append(s.revisions[target], rev)
+	return nil
+}
+
+func personRef(id string) models.EntityRef {
+	return models.EntityRef{Type: models.EntityPerson, ID: id}
+}
+
+func relationshipRef(id string) models.EntityRef {
+	return models.EntityRef{Type: models.EntityRelationship, ID: id}
+}
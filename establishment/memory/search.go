@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/search"
+)
+
+// Field weights roughly mirror how a Lucene index ranks short name fields
+// above long descriptions.
+const (
+	nameWeight        = 3
+	occupationWeight  = 2
+	descriptionWeight = 1
+)
+
+func (s *Store) SearchPersons(ctx context.Context, query string, limit int) ([]models.SearchResult, error) {
+	terms := search.Tokenize(query)
+	results := []models.SearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, person := range s.sortedPersons() {
+		fields := []struct {
+			words  []string
+			weight float64
+		}{
+			{search.Tokenize(person.Name), nameWeight},
+			{search.Tokenize(person.Occupation), occupationWeight},
+			{search.Tokenize(person.Description), descriptionWeight},
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			for _, field := range fields {
+				score += bestMatch(term, field.words) * field.weight
+			}
+		}
+		if score > 0 {
+			results = append(results, models.SearchResult{Person: person, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *Store) SuggestPersons(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	terms := search.Tokenize(prefix)
+	suggestions := []models.Suggestion{}
+	if len(terms) == 0 {
+		return suggestions, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type scored struct {
+		person models.Person
+		score  float64
+	}
+	var matches []scored
+	for _, person := range s.sortedPersons() {
+		words := search.Tokenize(person.Name)
+		score := 0.0
+		for i, term := range terms {
+			var best float64
+			if i == len(terms)-1 {
+				for _, word := range words {
+					if strings.HasPrefix(word, term) {
+						best = max(best, 1)
+					}
+				}
+			} else {
+				best = bestMatch(term, words)
+			}
+			if best == 0 {
+				score = 0
+				break
+			}
+			score += best
+		}
+		if score > 0 {
+			matches = append(matches, scored{person, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].person.Name < matches[j].person.Name
+	})
+	for _, m := range matches {
+		if len(suggestions) == limit {
+			break
+		}
+		suggestions = append(suggestions, models.Suggestion{ID: m.person.ID, Name: m.person.Name, Occupation: m.person.Occupation})
+	}
+	return suggestions, nil
+}
+
+// bestMatch returns the highest search.Match score of term against words.
+func bestMatch(term string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		best = max(best, search.Match(term, word))
+	}
+	return best
+}
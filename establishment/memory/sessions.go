@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) CreateSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *Store) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return models.Session{}, store.ErrNoSuchSession
+	}
+	return session, nil
+}
+
+func (s *Store) GetUserSessions(ctx context.Context, userID string, now int64) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.ExpiresAt > now {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastSeenAt != sessions[j].LastSeenAt {
+			return sessions[i].LastSeenAt > sessions[j].LastSeenAt
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (s *Store) TouchSession(ctx context.Context, sessionID string, lastSeenAt, expiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return store.ErrNoSuchSession
+	}
+	session.LastSeenAt = lastSeenAt
+	session.ExpiresAt = expiresAt
+	s.sessions[sessionID] = session
+	return nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func (s *Store) DeleteUserSessions(ctx context.Context, userID, exceptID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != exceptID {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) DeleteExpiredSessions(ctx context.Context, now int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if session.ExpiresAt < now {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,177 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) AddSource(ctx context.Context, source models.Source) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources[source.ID] = source
+	return nil
+}
+
+func (s *Store) GetSource(ctx context.Context, id string) (models.Source, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	source, ok := s.sources[id]
+	if !ok {
+		return models.Source{}, store.ErrNoSuchSource
+	}
+	return source, nil
+}
+
+func (s *Store) GetSources(ctx context.Context) ([]models.Source, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sources := make([]models.Source, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, source)
+	}
+	sortSources(sources)
+	return sources, nil
+}
+
+func (s *Store) GetSourcesByIDs(ctx context.Context, ids []string) ([]models.Source, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sources := []models.Source{}
+	for _, id := range ids {
+		if source, ok := s.sources[id]; ok && !slices.ContainsFunc(sources, func(found models.Source) bool { return found.ID == id }) {
+			sources = append(sources, source)
+		}
+	}
+	sortSources(sources)
+	return sources, nil
+}
+
+func (s *Store) UpdateSource(ctx context.Context, id string, update models.SourceUpdate) (models.Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, ok := s.sources[id]
+	if !ok {
+		return models.Source{}, store.ErrNoSuchSource
+	}
+	source = update.Apply(source)
+	s.sources[id] = source
+	return source, nil
+}
+
+func (s *Store) DeleteSource(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sources[id]; !ok {
+		return store.ErrNoSuchSource
+	}
+	for _, person := range s.persons {
+		if slices.Contains(person.SourceIDs, id) {
+			return store.ErrSourceInUse
+		}
+	}
+	for _, rel := range s.relationships {
+		if slices.Contains(rel.SourceIDs, id) {
+			return store.ErrSourceInUse
+		}
+	}
+	delete(s.sources, id)
+	return nil
+}
+
+func (s *Store) CiteSource(ctx context.Context, target models.EntityRef, sourceID string) error {
+	return s.updateCitation(ctx, target, sourceID, true, func(ids []string) []string {
+		if slices.Contains(ids, sourceID) {
+			return ids
+		}
+		return append(slices.Clone(ids), sourceID)
+	})
+}
+
+func (s *Store) UnciteSource(ctx context.Context, target models.EntityRef, sourceID string) error {
+	return s.updateCitation(ctx, target, sourceID, false, func(ids []string) []string {
+		return slices.DeleteFunc(slices.Clone(ids), func(id string) bool { return id == sourceID })
+	})
+}
+
+// updateCitation replaces the source IDs of target with change(ids). The
+// source itself must exist when needSource is set.
+func (s *Store) updateCitation(ctx context.Context, target models.EntityRef, sourceID string, needSource bool, change func(ids []string) []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch target.Type {
+	case models.EntityPerson:
+		person, ok := s.persons[target.ID]
+		if !ok {
+			return store.ErrNoSuchPerson
+		}
+		if _, ok := s.sources[sourceID]; needSource && !ok {
+			return store.ErrNoSuchSource
+		}
+		updated := person
+		updated.SourceIDs = change(person.SourceIDs)
+		if err := s.record(ctx, target, person, updated); err != nil {
+			return err
+		}
+		s.persons[target.ID] = updated
+	case models.EntityRelationship:
+		i := s.relationshipIndex(target.ID)
+		if i < 0 {
+			return store.ErrNoSuchRelationship
+		}
+		if _, ok := s.sources[sourceID]; needSource && !ok {
+			return store.ErrNoSuchSource
+		}
+		updated := s.relationships[i]
+		updated.SourceIDs = change(updated.SourceIDs)
+		if err := s.record(ctx, target, s.relationships[i], updated); err != nil {
+			return err
+		}
+		s.relationships[i] = updated
+	default:
+		return fmt.Errorf("cannot cite sources from %q", target.Type)
+	}
+	return nil
+}
+
+func (s *Store) GetCitations(ctx context.Context, sourceID string) (models.Citations, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.sources[sourceID]; !ok {
+		return models.Citations{}, store.ErrNoSuchSource
+	}
+
+	citations := models.Citations{Persons: []models.Person{}, Relationships: []models.Relationship{}}
+	for _, person := range s.sortedPersons() {
+		if slices.Contains(person.SourceIDs, sourceID) {
+			citations.Persons = append(citations.Persons, person)
+		}
+	}
+	for _, rel := range s.relationships {
+		if slices.Contains(rel.SourceIDs, sourceID) {
+			citations.Relationships = append(citations.Relationships, rel)
+		}
+	}
+	return citations, nil
+}
+
+func sortSources(sources []models.Source) {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Title != sources[j].Title {
+			return sources[i].Title < sources[j].Title
+		}
+		return sources[i].ID < sources[j].ID
+	})
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func (s *Store) AddToken(ctx context.Context, token models.APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token.Scopes = slices.Clone(token.Scopes)
+	s.tokens[token.ID] = token
+	return nil
+}
+
+func (s *Store) GetTokenByHash(ctx context.Context, hash string) (models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return models.APIToken{}, store.ErrNoSuchToken
+}
+
+func (s *Store) GetTokens(ctx context.Context, userID string) ([]models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []models.APIToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].CreatedAt != tokens[j].CreatedAt {
+			return tokens[i].CreatedAt > tokens[j].CreatedAt
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+func (s *Store) TouchToken(ctx context.Context, id string, usedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return store.ErrNoSuchToken
+	}
+	token.LastUsedAt = usedAt
+	s.tokens[id] = token
+	return nil
+}
+
+func (s *Store) DeleteToken(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || token.UserID != userID {
+		return store.ErrNoSuchToken
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+func (s *Store) AddOneTimeToken(ctx context.Context, token models.OneTimeToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.oneTimeTokens[token.Hash] = token
+	return nil
+}
+
+func (s *Store) UseOneTimeToken(ctx context.Context, hash, purpose string, now int64) (models.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.oneTimeTokens[hash]
+	if !ok || token.Purpose != purpose {
+		return models.OneTimeToken{}, store.ErrNoSuchOneTimeToken
+	}
+	delete(s.oneTimeTokens, hash)
+	if token.ExpiresAt < now {
+		return models.OneTimeToken{}, store.ErrNoSuchOneTimeToken
+	}
+	return token, nil
+}
+
+func (s *Store) DeleteOneTimeTokens(ctx context.Context, userID, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.oneTimeTokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(s.oneTimeTokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredOneTimeTokens(ctx context.Context, now int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for hash, token := range s.oneTimeTokens {
+		if token.ExpiresAt < now {
+			delete(s.oneTimeTokens, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
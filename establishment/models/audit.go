@@ -0,0 +1,41 @@
+package models
+
+// Audit outcomes, derived from the response status.
+const (
+	OutcomeSuccess = "success"
+	// OutcomeDenied covers requests refused for lack of authentication,
+	// permission or rate, which are the interesting ones when looking for
+	// abuse.
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// AuditEntry records one request that changed something or signed a user in
+// or out. Entries are never changed or removed once stored.
+type AuditEntry struct {
+	ID string `json:"id"`
+	// CreatedAt is a Unix timestamp in seconds.
+	CreatedAt int64 `json:"created_at"`
+	// UserID is empty if the user is unknown, as for failed logins.
+	UserID string `json:"user_id,omitempty"`
+	// Login is the login of the user or, for failed logins, the one tried.
+	Login string `json:"login,omitempty"`
+	// Action is the method and route, such as "DELETE /person/:id".
+	Action    string     `json:"action"`
+	Target    *EntityRef `json:"target,omitempty"`
+	IP        string     `json:"ip"`
+	RequestID string     `json:"request_id"`
+	Outcome   string     `json:"outcome"`
+	Status    int        `json:"status"`
+}
+
+// AuditQuery filters GetAuditEntries; empty fields match everything.
+type AuditQuery struct {
+	// User matches either the user ID or the login of an entry.
+	User   string
+	Action string
+	// Since and Until bound CreatedAt, inclusively.
+	Since int64
+	Until int64
+	Limit int
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidDate      = errors.New("dates must be YYYY, YYYY-MM or YYYY-MM-DD")
+	ErrInvalidDateRange = errors.New("end_date must not be before start_date")
+)
+
+// partialDateLayouts are the accepted precisions of relationship dates.
+var partialDateLayouts = map[int]string{
+	len("2006"):       "2006",
+	len("2006-01"):    "2006-01",
+	len("2006-01-02"): time.DateOnly,
+}
+
+// ValidatePartialDate checks that date is empty or a year, a year and month,
+// or a full date. Dates of these forms compare correctly as strings, which
+// both stores rely on.
+func ValidatePartialDate(date string) error {
+	if date == "" {
+		return nil
+	}
+	layout, ok := partialDateLayouts[len(date)]
+	if !ok {
+		return ErrInvalidDate
+	}
+	if _, err := time.Parse(layout, date); err != nil {
+		return ErrInvalidDate
+	}
+	return nil
+}
+
+// Validate checks the dates of rel. A range is valid when the end can fall on
+// or after the start at their respective precisions, so 2001-05 to 2001 is
+// accepted.
+func (rel Relationship) Validate() error {
+	if err := ValidatePartialDate(rel.StartDate); err != nil {
+		return err
+	}
+	if err := ValidatePartialDate(rel.EndDate); err != nil {
+		return err
+	}
+	if rel.StartDate != "" && rel.EndDate != "" &&
+		rel.StartDate > rel.EndDate && !strings.HasPrefix(rel.StartDate, rel.EndDate) {
+		return ErrInvalidDateRange
+	}
+	return nil
+}
+
+// ActiveAt reports whether rel held on date, a full YYYY-MM-DD date. Missing
+// bounds are open, and a partial end date covers its whole year or month.
+func (rel Relationship) ActiveAt(date string) bool {
+	if rel.StartDate != "" && rel.StartDate > date {
+		return false
+	}
+	if rel.EndDate != "" && rel.EndDate < date && !strings.HasPrefix(date, rel.EndDate) {
+		return false
+	}
+	return true
+}
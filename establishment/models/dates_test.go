@@ -0,0 +1,74 @@
+package models
+
+import "testing"
+
+func TestValidatePartialDate(t *testing.T) {
+	tests := []struct {
+		date string
+		ok   bool
+	}{
+		{"", true},
+		{"1999", true},
+		{"1999-12", true},
+		{"1999-12-31", true},
+		{"1999-13", false},
+		{"1999-02-30", false},
+		{"99", false},
+		{"1999/12/31", false},
+		{"1999-12-31T00:00:00Z", false},
+	}
+	for _, tt := range tests {
+		if err := ValidatePartialDate(tt.date); (err == nil) != tt.ok {
+			t.Errorf("ValidatePartialDate(%q) = %v, want ok=%v", tt.date, err, tt.ok)
+		}
+	}
+}
+
+func TestRelationshipValidate(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       error
+	}{
+		{"", "", nil},
+		{"2001", "2002", nil},
+		{"2001-05", "2001", nil},
+		{"2001-05-10", "2001-05", nil},
+		{"2001-05-10", "2001-05-10", nil},
+		{"2002", "2001", ErrInvalidDateRange},
+		{"2001-06", "2001-05", ErrInvalidDateRange},
+		{"2001-5", "", ErrInvalidDate},
+		{"", "2001-02-29", ErrInvalidDate},
+	}
+	for _, tt := range tests {
+		rel := Relationship{StartDate: tt.start, EndDate: tt.end}
+		if err := rel.Validate(); err != tt.want {
+			t.Errorf("Validate(%q, %q) = %v, want %v", tt.start, tt.end, err, tt.want)
+		}
+	}
+}
+
+func TestRelationshipActiveAt(t *testing.T) {
+	tests := []struct {
+		start, end, at string
+		want           bool
+	}{
+		{"", "", "2000-01-01", true},
+		{"2001", "", "2000-12-31", false},
+		{"2001", "", "2001-01-01", true},
+		{"2001-05", "", "2001-04-30", false},
+		{"2001-05", "", "2001-05-01", true},
+		{"", "2001", "2001-12-31", true},
+		{"", "2001", "2002-01-01", false},
+		{"", "2001-05", "2001-05-31", true},
+		{"", "2001-05", "2001-06-01", false},
+		{"2001-05-10", "2001-05-20", "2001-05-09", false},
+		{"2001-05-10", "2001-05-20", "2001-05-20", true},
+		{"2001-05-10", "2001-05-20", "2001-05-21", false},
+	}
+	for _, tt := range tests {
+		rel := Relationship{StartDate: tt.start, EndDate: tt.end}
+		if got := rel.ActiveAt(tt.at); got != tt.want {
+			t.Errorf("ActiveAt(%q) of %q to %q = %v, want %v", tt.at, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
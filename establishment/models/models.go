@@ -7,29 +7,235 @@ type Person struct {
 	ImageURL    string `json:"image_url"`
 	Twitter     string `json:"twitter"`
 	Description string `json:"description"`
+	// CreatedAt is a Unix timestamp in seconds.
+	CreatedAt int64 `json:"created_at"`
+	// SourceIDs lists the sources backing this person's record.
+	SourceIDs []string `json:"source_ids,omitempty"`
+}
+
+// PersonDetails is a person together with the sources it cites.
+type PersonDetails struct {
+	Person
+	Sources []Source `json:"sources"`
+}
+
+// Sort keys and orders accepted by PersonQuery.
+const (
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// PersonQuery selects one page of persons. Filters left at their zero value
+// are not applied.
+type PersonQuery struct {
+	Limit int
+	// Cursor is the opaque NextCursor of the previous page, if any.
+	Cursor string
+	Sort   string
+	Order  string
+
+	Occupation   string
+	HasTwitter   *bool
+	CreatedAfter int64
+}
+
+// PersonPage is one page of a PersonQuery. Total counts every person
+// matching the filters, not just those on this page.
+type PersonPage struct {
+	Items      []Person `json:"items"`
+	Total      int64    `json:"total"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// PersonUpdate is a partial update of a Person; nil fields are left unchanged.
+type PersonUpdate struct {
+	Name        *string   `json:"name"`
+	Occupation  *string   `json:"occupation"`
+	ImageURL    *string   `json:"image_url"`
+	Twitter     *string   `json:"twitter"`
+	Description *string   `json:"description"`
+	SourceIDs   *[]string `json:"source_ids"`
+}
+
+// Apply returns a copy of person with the non-nil fields of u applied.
+func (u PersonUpdate) Apply(person Person) Person {
+	if u.Name != nil {
+		person.Name = *u.Name
+	}
+	if u.Occupation != nil {
+		person.Occupation = *u.Occupation
+	}
+	if u.ImageURL != nil {
+		person.ImageURL = *u.ImageURL
+	}
+	if u.Twitter != nil {
+		person.Twitter = *u.Twitter
+	}
+	if u.Description != nil {
+		person.Description = *u.Description
+	}
+	if u.SourceIDs != nil {
+		person.SourceIDs = *u.SourceIDs
+	}
+	return person
+}
+
+// SearchResult is a person matched by a full-text search, with a relevance
+// score that is only meaningful relative to the other results.
+type SearchResult struct {
+	Person
+	Score float64 `json:"score"`
+}
+
+// Suggestion is the lightweight form of a person used for autocomplete.
+type Suggestion struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Occupation string `json:"occupation"`
 }
 
 type Relationship struct {
+	ID      string `json:"id"`
 	From    string `json:"source_id"`
 	To      string `json:"target_id"`
 	Type    string `json:"type"`
 	Details string `json:"details"`
+	// StartDate and EndDate bound the relationship in time with year, month
+	// or day precision (YYYY, YYYY-MM or YYYY-MM-DD). Empty means open.
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+	// SourceIDs lists the sources backing this relationship.
+	SourceIDs []string `json:"source_ids,omitempty"`
+}
+
+// RelationshipUpdate is a partial update of a Relationship; nil fields are
+// left unchanged. The endpoints of a relationship cannot be changed.
+type RelationshipUpdate struct {
+	Type    *string `json:"type"`
+	Details *string `json:"details"`
+	// An empty StartDate or EndDate clears that bound.
+	StartDate *string   `json:"start_date"`
+	EndDate   *string   `json:"end_date"`
+	SourceIDs *[]string `json:"source_ids"`
+}
+
+// Apply returns a copy of rel with the non-nil fields of u applied.
+func (u RelationshipUpdate) Apply(rel Relationship) Relationship {
+	if u.Type != nil {
+		rel.Type = *u.Type
+	}
+	if u.Details != nil {
+		rel.Details = *u.Details
+	}
+	if u.StartDate != nil {
+		rel.StartDate = *u.StartDate
+	}
+	if u.EndDate != nil {
+		rel.EndDate = *u.EndDate
+	}
+	if u.SourceIDs != nil {
+		rel.SourceIDs = *u.SourceIDs
+	}
+	return rel
 }
 
 type Graph struct {
 	Nodes []Person       `json:"nodes"`
 	Edges []Relationship `json:"edges"`
+	// Sources holds every source cited by the nodes and edges, when requested.
+	Sources []Source `json:"sources,omitempty"`
+}
+
+// GraphFilter narrows down the whole graph returned by GetGraph.
+type GraphFilter struct {
+	// At, a YYYY-MM-DD date, keeps only relationships active on that day.
+	At string
+}
+
+// PathQuery describes a shortest path search between two persons.
+// Relationships are followed regardless of their direction.
+type PathQuery struct {
+	From     string
+	To       string
+	MaxDepth int
+	// Types restricts the search to these relationship types; empty means any.
+	Types []string
+	// All returns every shortest path instead of just one.
+	All bool
+}
+
+// Path is a single chain of relationships between two persons.
+type Path struct {
+	// Nodes holds the person IDs in order, starting with the source.
+	Nodes []string `json:"nodes"`
+	// Hops holds the relationships in traversal order. Each keeps its stored
+	// direction, which may point against the direction of travel.
+	Hops []Relationship `json:"hops"`
+}
+
+// PathResult carries the paths found together with the subgraph made of
+// every person and relationship they touch.
+type PathResult struct {
+	Graph
+	Paths []Path `json:"paths"`
+}
+
+// Directions in which relationships can be followed from a person.
+const (
+	DirectionOut  = "out"
+	DirectionIn   = "in"
+	DirectionBoth = "both"
+)
+
+// NetworkQuery describes the ego network of a person: everyone reachable
+// within Depth hops.
+type NetworkQuery struct {
+	PersonID string
+	Depth    int
+	// Types restricts the traversal to these relationship types; empty means any.
+	Types []string
+	// Direction is one of DirectionOut, DirectionIn or DirectionBoth.
+	Direction string
+	// At, a YYYY-MM-DD date, follows only relationships active on that day.
+	At string
 }
 
 type User struct {
-	ID       string `json:"id"`
-	Login    string `json:"login"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID    string `json:"id"`
+	Login string `json:"login"`
+	Email string `json:"email"`
+	// Password is the bcrypt hash; it is never sent to clients.
+	Password      string   `json:"-"`
+	Roles         []string `json:"roles"`
+	EmailVerified bool     `json:"email_verified"`
+
+	// TOTPSecret is the base32 secret shared with the user's authenticator
+	// app. It is set during enrollment but only asked for at login once
+	// TOTPEnabled is set.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPCounter is the last time step a code was accepted for, so that
+	// no code works twice.
+	TOTPCounter int64 `json:"-"`
+	// RecoveryCodes holds the hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"-"`
+
+	// OIDCIdentity is the issuer and subject of the OpenID Connect account
+	// the user signs in with, separated by a space, or empty if none is
+	// linked.
+	OIDCIdentity string `json:"-"`
 }
 
 type Session struct {
 	ID        string `json:"id"`
 	UserID    string `json:"userId"`
 	ExpiresAt int64  `json:"expiresAt"`
+	// CreatedAt and LastSeenAt are Unix timestamps in seconds.
+	CreatedAt  int64  `json:"createdAt"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
 }
@@ -0,0 +1,41 @@
+package models
+
+// Proposal states. Contributors can revise a proposal while it is pending or
+// has changes requested; approved and rejected proposals are final.
+const (
+	ProposalPending          = "pending"
+	ProposalApproved         = "approved"
+	ProposalRejected         = "rejected"
+	ProposalChangesRequested = "changes_requested"
+)
+
+// Proposal is a new person or relationship submitted by a contributor. It
+// stays out of the public graph until a moderator approves it.
+type Proposal struct {
+	ID string `json:"id"`
+	// Kind is EntityPerson or EntityRelationship and tells which of Person
+	// and Relationship is set.
+	Kind         string        `json:"kind"`
+	Person       *Person       `json:"person,omitempty"`
+	Relationship *Relationship `json:"relationship,omitempty"`
+	Status       string        `json:"status"`
+	AuthorID     string        `json:"author_id"`
+	ReviewerID   string        `json:"reviewer_id,omitempty"`
+	// Reason is the moderator's explanation of a rejection or of the
+	// requested changes.
+	Reason string `json:"reason,omitempty"`
+	// CreatedAt and UpdatedAt are Unix timestamps in seconds.
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Editable reports whether the author may still revise the proposal.
+func (p Proposal) Editable() bool {
+	return p.Status == ProposalPending || p.Status == ProposalChangesRequested
+}
+
+// ProposalQuery filters GetProposals; empty fields match everything.
+type ProposalQuery struct {
+	Status   string
+	AuthorID string
+}
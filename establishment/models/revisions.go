@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Revision actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Revision is an immutable record of one write to a person or relationship.
+type Revision struct {
+	ID     string    `json:"id"`
+	Entity EntityRef `json:"entity"`
+	// Version numbers the revisions of one entity from 1.
+	Version  int64  `json:"version"`
+	Action   string `json:"action"`
+	AuthorID string `json:"author_id"`
+	// CreatedAt is a Unix timestamp in seconds.
+	CreatedAt int64 `json:"created_at"`
+	// Before and After are JSON snapshots of the entity; Before is empty
+	// for creations and After for deletions.
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+	Changes []FieldChange   `json:"changes,omitempty"`
+}
+
+// FieldChange is one field that differs between the snapshots of a Revision.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff lists the fields that differ between rev.Before and rev.After, sorted
+// by name. Fields missing from a snapshot are reported as null.
+func (rev Revision) Diff() []FieldChange {
+	before, after := snapshotFields(rev.Before), snapshotFields(rev.After)
+
+	fields := make([]string, 0, len(before)+len(after))
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, FieldChange{Field: field, Before: before[field], After: after[field]})
+		}
+	}
+	return changes
+}
+
+func snapshotFields(snapshot json.RawMessage) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if len(snapshot) > 0 {
+		json.Unmarshal(snapshot, &fields)
+	}
+	return fields
+}
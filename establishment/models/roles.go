@@ -0,0 +1,35 @@
+package models
+
+import "slices"
+
+// Roles, from least to most privileged. Each role includes the permissions
+// of the ones before it.
+const (
+	RoleViewer    = "viewer"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role in order of privilege.
+var Roles = []string{RoleViewer, RoleEditor, RoleModerator, RoleAdmin}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// HasRole reports whether the user holds role or a more privileged one.
+// Every user is at least a viewer.
+func (u User) HasRole(role string) bool {
+	required := slices.Index(Roles, role)
+	if required <= 0 {
+		return required == 0
+	}
+	for _, held := range u.Roles {
+		if slices.Index(Roles, held) >= required {
+			return true
+		}
+	}
+	return false
+}
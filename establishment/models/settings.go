@@ -0,0 +1,8 @@
+package models
+
+// Settings are installation-wide options that admins change at runtime.
+type Settings struct {
+	// Require2FAForEditors keeps users with the editor role or above from
+	// using it until they have enabled two-factor authentication.
+	Require2FAForEditors bool `json:"require_2fa_for_editors"`
+}
@@ -0,0 +1,83 @@
+package models
+
+// Source is a publication backing facts about persons and relationships.
+type Source struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Publisher string `json:"publisher"`
+	// AccessedAt is the YYYY-MM-DD date the source was last read.
+	AccessedAt string `json:"accessed_at"`
+	// ArchiveURL points to an archived copy, e.g. on the Wayback Machine.
+	ArchiveURL string `json:"archive_url"`
+	// CreatedAt is a Unix timestamp in seconds.
+	CreatedAt int64 `json:"created_at"`
+}
+
+// SourceUpdate is a partial update of a Source; nil fields are left unchanged.
+type SourceUpdate struct {
+	URL        *string `json:"url"`
+	Title      *string `json:"title"`
+	Publisher  *string `json:"publisher"`
+	AccessedAt *string `json:"accessed_at"`
+	ArchiveURL *string `json:"archive_url"`
+}
+
+// Apply returns a copy of source with the non-nil fields of u applied.
+func (u SourceUpdate) Apply(source Source) Source {
+	if u.URL != nil {
+		source.URL = *u.URL
+	}
+	if u.Title != nil {
+		source.Title = *u.Title
+	}
+	if u.Publisher != nil {
+		source.Publisher = *u.Publisher
+	}
+	if u.AccessedAt != nil {
+		source.AccessedAt = *u.AccessedAt
+	}
+	if u.ArchiveURL != nil {
+		source.ArchiveURL = *u.ArchiveURL
+	}
+	return source
+}
+
+// Kinds of entities that can cite sources and be referred to by EntityRef.
+const (
+	EntityPerson       = "person"
+	EntityRelationship = "relationship"
+)
+
+// EntityRef identifies a person or a relationship.
+type EntityRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Citations lists every fact citing one source.
+type Citations struct {
+	Persons       []Person       `json:"persons"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// CitedSourceIDs returns the IDs of all sources cited in g, without duplicates.
+func (g Graph) CitedSourceIDs() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(sourceIDs []string) {
+		for _, id := range sourceIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	for _, node := range g.Nodes {
+		add(node.SourceIDs)
+	}
+	for _, edge := range g.Edges {
+		add(edge.SourceIDs)
+	}
+	return ids
+}
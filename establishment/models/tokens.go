@@ -0,0 +1,85 @@
+package models
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Token scopes, from narrowest to widest. Each scope includes the ones
+// before it.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope in order of breadth.
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// APIToken is a personal access token for scripts. It acts for its user
+// within its scopes; the user's roles still apply on top.
+type APIToken struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"user_id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Hash is the hex SHA-256 of the token; the token itself is only shown
+	// once, when it is created.
+	Hash string `json:"-"`
+	// CreatedAt, ExpiresAt and LastUsedAt are Unix timestamps in seconds;
+	// LastUsedAt is 0 for unused tokens.
+	CreatedAt  int64 `json:"created_at"`
+	ExpiresAt  int64 `json:"expires_at"`
+	LastUsedAt int64 `json:"last_used_at"`
+}
+
+// HasScope reports whether the token holds scope or a wider one.
+func (t APIToken) HasScope(scope string) bool {
+	required := slices.Index(Scopes, scope)
+	for _, held := range t.Scopes {
+		if required >= 0 && slices.Index(Scopes, held) >= required {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether the token may be used for a request with the given
+// HTTP method to a route requiring role: admin routes need the admin scope,
+// other writes the write scope and reads the read scope.
+func (t APIToken) Permits(role, method string) bool {
+	switch {
+	case role == RoleAdmin:
+		return t.HasScope(ScopeAdmin)
+	case method == http.MethodGet || method == http.MethodHead:
+		return t.HasScope(ScopeRead)
+	default:
+		return t.HasScope(ScopeWrite)
+	}
+}
+
+// Purposes of a OneTimeToken.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+	// PurposeLoginChallenge tokens stand for a correct password while the
+	// second factor is still to be entered.
+	PurposeLoginChallenge = "login_challenge"
+)
+
+// OneTimeToken is a short-lived secret handed to a user, e.g. by mail to
+// prove they control their email address. Like API tokens, only its hash is
+// stored.
+type OneTimeToken struct {
+	Hash    string
+	UserID  string
+	Purpose string
+	// CreatedAt and ExpiresAt are Unix timestamps in seconds.
+	CreatedAt int64
+	ExpiresAt int64
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"establishment/v1/establishment/models"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// auditColumns lists the columns read by auditEntryFromRecord for an entry
+// bound to a.
+const auditColumns = `a.id, a.created_at, a.user_id, a.login, a.action, a.target_type, a.target_id,
+	a.ip, a.request_id, a.outcome, a.status`
+
+func (s *Store) AddAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	var targetType, targetID string
+	if entry.Target != nil {
+		targetType, targetID = entry.Target.Type, entry.Target.ID
+	}
+	err := runAndConsume(ctx, session,
+		`CREATE (a:AuditEntry {
+			id: $id,
+			created_at: $created_at,
+			user_id: $user_id,
+			login: $login,
+			action: $action,
+			target_type: $target_type,
+			target_id: $target_id,
+			ip: $ip,
+			request_id: $request_id,
+			outcome: $outcome,
+			status: $status
+		})`,
+		map[string]interface{}{
+			"id":          entry.ID,
+			"created_at":  entry.CreatedAt,
+			"user_id":     nullIfEmpty(entry.UserID),
+			"login":       nullIfEmpty(entry.Login),
+			"action":      entry.Action,
+			"target_type": nullIfEmpty(targetType),
+			"target_id":   nullIfEmpty(targetID),
+			"ip":          entry.IP,
+			"request_id":  entry.RequestID,
+			"outcome":     entry.Outcome,
+			"status":      entry.Status,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetAuditEntries(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (a:AuditEntry)
+		 WHERE ($user = '' OR a.user_id = $user OR a.login = $user)
+		   AND ($action = '' OR a.action = $action)
+		   AND ($since = 0 OR a.created_at >= $since)
+		   AND ($until = 0 OR a.created_at <= $until)
+		 RETURN `+auditColumns+`
+		 ORDER BY a.created_at DESC, a.id
+		 LIMIT $limit`,
+		map[string]interface{}{
+			"user":   query.User,
+			"action": query.Action,
+			"since":  query.Since,
+			"until":  query.Until,
+			"limit":  query.Limit,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+
+	entries := []models.AuditEntry{}
+	for result.Next(ctx) {
+		entries = append(entries, auditEntryFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+func auditEntryFromRecord(record *neo4j.Record) models.AuditEntry {
+	entry := models.AuditEntry{
+		ID:        stringValue(record, "a.id"),
+		CreatedAt: intValue(record, "a.created_at"),
+		UserID:    stringValue(record, "a.user_id"),
+		Login:     stringValue(record, "a.login"),
+		Action:    stringValue(record, "a.action"),
+		IP:        stringValue(record, "a.ip"),
+		RequestID: stringValue(record, "a.request_id"),
+		Outcome:   stringValue(record, "a.outcome"),
+		Status:    int(intValue(record, "a.status")),
+	}
+	if targetType := stringValue(record, "a.target_type"); targetType != "" {
+		entry.Target = &models.EntityRef{Type: targetType, ID: stringValue(record, "a.target_id")}
+	}
+	return entry
+}
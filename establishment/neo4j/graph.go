@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func (s *Store) ShortestPaths(ctx context.Context, query models.PathQuery) (models.PathResult, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`OPTIONAL MATCH (a:Person {id: $from})
+		 OPTIONAL MATCH (b:Person {id: $to})
+		 RETURN a IS NOT NULL AS has_from, b IS NOT NULL AS has_to`,
+		map[string]interface{}{"from": query.From, "to": query.To})
+	if err != nil {
+		return models.PathResult{}, fmt.Errorf("failed to verify persons for path: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return models.PathResult{}, fmt.Errorf("failed to verify persons for path: %w", err)
+	}
+	hasFrom, _ := record.Get("has_from")
+	hasTo, _ := record.Get("has_to")
+	if hasFrom != true || hasTo != true {
+		return models.PathResult{}, store.ErrNoSuchPerson
+	}
+
+	pathFunction := "shortestPath"
+	if query.All {
+		pathFunction = "allShortestPaths"
+	}
+	// Variable-length bounds cannot be parameterised, so the depth is
+	// clamped and formatted into the query.
+	depth := clampDepth(query.MaxDepth)
+
+	log.Printf("Searching %s: from=%s, to=%s, max_depth=%d, types=%v", pathFunction, query.From, query.To, depth, query.Types)
+
+	result, err = session.Run(ctx,
+		fmt.Sprintf(`MATCH (a:Person {id: $from}), (b:Person {id: $to})
+		 MATCH path = %s((a)-[:RELATIONSHIP*..%d]-(b))
+		 WHERE size($types) = 0 OR all(r IN relationships(path) WHERE r.type IN $types)
+		 RETURN [n IN nodes(path) | n {`+personProjection+`}] AS persons,
+				[r IN relationships(path) | r {`+relationshipProjection+`}] AS hops
+		 LIMIT $limit`, pathFunction, depth),
+		map[string]interface{}{
+			"from":  query.From,
+			"to":    query.To,
+			"types": stringList(query.Types),
+			"limit": store.MaxPaths,
+		})
+	if err != nil {
+		log.Printf("Failed to query shortest path: %v", err)
+		return models.PathResult{}, fmt.Errorf("failed to query shortest path: %w", err)
+	}
+
+	builder := newGraphBuilder()
+	paths := []models.Path{}
+	for result.Next(ctx) {
+		personValues, _ := result.Record().Get("persons")
+		hopValues, _ := result.Record().Get("hops")
+
+		path := models.Path{}
+		for _, value := range personValues.([]interface{}) {
+			person := personFromMap(value)
+			builder.addNode(person)
+			path.Nodes = append(path.Nodes, person.ID)
+		}
+		for _, value := range hopValues.([]interface{}) {
+			rel := relationshipFromMap(value)
+			builder.addEdge(rel)
+			path.Hops = append(path.Hops, rel)
+		}
+		paths = append(paths, path)
+	}
+	if err := result.Err(); err != nil {
+		return models.PathResult{}, fmt.Errorf("failed to read shortest path: %w", err)
+	}
+
+	log.Printf("Found %d shortest path(s) between %s and %s", len(paths), query.From, query.To)
+	return models.PathResult{Graph: builder.graph(), Paths: paths}, nil
+}
+
+// networkPatterns holds the single-hop pattern from a person a to its
+// neighbour b over r for each direction.
+var networkPatterns = map[string]string{
+	models.DirectionOut:  `(a)-[r:RELATIONSHIP]->(b:Person)`,
+	models.DirectionIn:   `(a)<-[r:RELATIONSHIP]-(b:Person)`,
+	models.DirectionBoth: `(a)-[r:RELATIONSHIP]-(b:Person)`,
+}
+
+// GetNetwork expands the network one hop at a time, like a breadth-first
+// search. A single variable-length match would enumerate every path within
+// the depth, which grows exponentially on dense graphs.
+func (s *Store) GetNetwork(ctx context.Context, query models.NetworkQuery) (models.Graph, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	pattern, ok := networkPatterns[query.Direction]
+	if !ok {
+		pattern = networkPatterns[models.DirectionBoth]
+	}
+	depth := clampDepth(query.Depth)
+
+	log.Printf("Querying network: id=%s, depth=%d, direction=%s, types=%v", query.PersonID, depth, query.Direction, query.Types)
+
+	value, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		result, err := tx.Run(ctx,
+			`MATCH (p:Person {id: $id}) RETURN p {`+personProjection+`} AS center`,
+			map[string]interface{}{"id": query.PersonID})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(ctx) {
+			if err := result.Err(); err != nil {
+				return nil, err
+			}
+			return nil, store.ErrNoSuchPerson
+		}
+		center, _ := result.Record().Get("center")
+
+		builder := newGraphBuilder()
+		builder.addNode(personFromMap(center))
+		frontier := []string{query.PersonID}
+		for d := 1; d <= depth && len(frontier) > 0; d++ {
+			result, err := tx.Run(ctx,
+				`MATCH (a:Person) WHERE a.id IN $frontier
+				 MATCH `+pattern+`
+				 WHERE (size($types) = 0 OR r.type IN $types)
+				   AND ($at = '' OR `+activeAt+`)
+				 RETURN r {`+relationshipProjection+`} AS edge, b {`+personProjection+`} AS neighbour`,
+				map[string]interface{}{
+					"frontier": stringList(frontier),
+					"types":    stringList(query.Types),
+					"at":       query.At,
+				})
+			if err != nil {
+				return nil, err
+			}
+			var next []string
+			for result.Next(ctx) {
+				edge, _ := result.Record().Get("edge")
+				neighbour, _ := result.Record().Get("neighbour")
+				builder.addEdge(relationshipFromMap(edge))
+				person := personFromMap(neighbour)
+				if !builder.seenNodes[person.ID] {
+					builder.addNode(person)
+					next = append(next, person.ID)
+				}
+			}
+			if err := result.Err(); err != nil {
+				return nil, err
+			}
+			frontier = next
+		}
+		return builder.graph(), nil
+	})
+	if errors.Is(err, store.ErrNoSuchPerson) {
+		return models.Graph{}, store.ErrNoSuchPerson
+	}
+	if err != nil {
+		log.Printf("Failed to query network: %v", err)
+		return models.Graph{}, fmt.Errorf("failed to query network: %w", err)
+	}
+
+	graph := value.(models.Graph)
+	log.Printf("Returning network of %s: %d nodes, %d edges", query.PersonID, len(graph.Nodes), len(graph.Edges))
+	return graph, nil
+}
+
+// personProjection and relationshipProjection are Cypher map projections
+// matching personFromMap and relationshipFromMap. relationshipProjection
+// expects the relationship variable to be called r.
+const (
+	personProjection       = `.id, .name, .occupation, .image_url, .twitter, .description, .created_at, .source_ids`
+	relationshipProjection = `.id, .type, .details, .start_date, .end_date, .source_ids, source_id: startNode(r).id, target_id: endNode(r).id`
+)
+
+func personFromMap(value interface{}) models.Person {
+	props, _ := value.(map[string]interface{})
+	return models.Person{
+		ID:          mapString(props, "id"),
+		Name:        mapString(props, "name"),
+		Occupation:  mapString(props, "occupation"),
+		ImageURL:    mapString(props, "image_url"),
+		Twitter:     mapString(props, "twitter"),
+		Description: mapString(props, "description"),
+		CreatedAt:   mapInt(props, "created_at"),
+		SourceIDs:   toStrings(props["source_ids"]),
+	}
+}
+
+func relationshipFromMap(value interface{}) models.Relationship {
+	props, _ := value.(map[string]interface{})
+	return models.Relationship{
+		ID:        mapString(props, "id"),
+		From:      mapString(props, "source_id"),
+		To:        mapString(props, "target_id"),
+		Type:      mapString(props, "type"),
+		Details:   mapString(props, "details"),
+		StartDate: mapString(props, "start_date"),
+		EndDate:   mapString(props, "end_date"),
+		SourceIDs: toStrings(props["source_ids"]),
+	}
+}
+
+func mapString(props map[string]interface{}, key string) string {
+	str, _ := props[key].(string)
+	return str
+}
+
+func mapInt(props map[string]interface{}, key string) int64 {
+	i, _ := props[key].(int64)
+	return i
+}
+
+// stringList makes sure a nil slice is sent to Neo4j as an empty list rather
+// than null.
+func stringList(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func clampDepth(depth int) int {
+	if depth < 1 {
+		return 1
+	}
+	if depth > store.MaxTraversalDepth {
+		return store.MaxTraversalDepth
+	}
+	return depth
+}
+
+// graphBuilder collects nodes and edges from several records, dropping
+// duplicates while keeping the order in which they were first seen.
+type graphBuilder struct {
+	nodes     []models.Person
+	edges     []models.Relationship
+	seenNodes map[string]bool
+	seenEdges map[string]bool
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{seenNodes: make(map[string]bool), seenEdges: make(map[string]bool)}
+}
+
+func (b *graphBuilder) addNode(person models.Person) {
+	if b.seenNodes[person.ID] {
+		return
+	}
+	b.seenNodes[person.ID] = true
+	b.nodes = append(b.nodes, person)
+}
+
+func (b *graphBuilder) addEdge(rel models.Relationship) {
+	if b.seenEdges[rel.ID] {
+		return
+	}
+	b.seenEdges[rel.ID] = true
+	b.edges = append(b.edges, rel)
+}
+
+func (b *graphBuilder) graph() models.Graph {
+	graph := models.Graph{Nodes: b.nodes, Edges: b.edges}
+	if graph.Nodes == nil {
+		graph.Nodes = []models.Person{}
+	}
+	if graph.Edges == nil {
+		graph.Edges = []models.Relationship{}
+	}
+	return graph
+}
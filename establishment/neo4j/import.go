@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func (s *Store) ImportBatch(ctx context.Context, batch store.Batch) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Importing batch of %d new and %d updated persons, %d new and %d updated relationships",
+		len(batch.Persons), len(batch.PersonUpdates), len(batch.Relationships), len(batch.RelationshipUpdates))
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		for _, person := range batch.Persons {
+			if err := createPerson(ctx, tx, person); err != nil {
+				if isConstraintViolation(err) {
+					return nil, fmt.Errorf("person %s: %w", person.ID, store.ErrPersonExists)
+				}
+				return nil, err
+			}
+		}
+		for _, patch := range batch.PersonUpdates {
+			if _, err := updatePerson(ctx, tx, patch.ID, patch.Update); err != nil {
+				if errors.Is(err, store.ErrNoSuchPerson) {
+					return nil, fmt.Errorf("person %s: %w", patch.ID, err)
+				}
+				return nil, err
+			}
+		}
+		for _, rel := range batch.Relationships {
+			if rel.From == rel.To {
+				return nil, fmt.Errorf("relationship %s: %w", rel.ID, store.ErrInvalidRelationship)
+			}
+			if err := createRelationship(ctx, tx, rel); err != nil {
+				if errors.Is(err, store.ErrPersonsNotFound) {
+					return nil, fmt.Errorf("relationship %s: %w", rel.ID, err)
+				}
+				return nil, err
+			}
+		}
+		for _, patch := range batch.RelationshipUpdates {
+			if _, err := updateRelationship(ctx, tx, patch.ID, patch.Update); err != nil {
+				if errors.Is(err, store.ErrNoSuchRelationship) {
+					return nil, fmt.Errorf("relationship %s: %w", patch.ID, err)
+				}
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if errors.Is(err, store.ErrPersonExists) || errors.Is(err, store.ErrPersonsNotFound) || errors.Is(err, store.ErrInvalidRelationship) ||
+		errors.Is(err, store.ErrNoSuchPerson) || errors.Is(err, store.ErrNoSuchRelationship) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import batch: %w", err)
+	}
+	return nil
+}
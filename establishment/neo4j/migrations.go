@@ -0,0 +1,298 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// migration is one versioned step of the database schema. Statements are run
+// in order, each in its own auto-commit transaction, because Neo4j does not
+// allow schema changes and data writes in the same transaction.
+type migration struct {
+	version     int64
+	description string
+	statements  []string
+	// conflicts, if set, runs before the statements and returns one
+	// "conflict" row for every value that would make them fail.
+	conflicts string
+}
+
+// maxReportedConflicts caps how many conflicting values a failed migration
+// lists in its error.
+const maxReportedConflicts = 20
+
+// migrations must only ever be appended to; applied versions are recorded as
+// :SchemaMigration nodes and skipped on subsequent runs.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "unique constraints on persons, users and sessions",
+		statements: []string{
+			`CREATE CONSTRAINT schema_migration_version_unique IF NOT EXISTS
+			 FOR (m:SchemaMigration) REQUIRE m.version IS UNIQUE`,
+			`CREATE CONSTRAINT person_id_unique IF NOT EXISTS
+			 FOR (p:Person) REQUIRE p.id IS UNIQUE`,
+			`CREATE CONSTRAINT user_id_unique IF NOT EXISTS
+			 FOR (u:User) REQUIRE u.id IS UNIQUE`,
+			`CREATE CONSTRAINT user_login_unique IF NOT EXISTS
+			 FOR (u:User) REQUIRE u.login IS UNIQUE`,
+			`CREATE CONSTRAINT user_email_unique IF NOT EXISTS
+			 FOR (u:User) REQUIRE u.email IS UNIQUE`,
+			`CREATE CONSTRAINT session_id_unique IF NOT EXISTS
+			 FOR (s:Session) REQUIRE s.id IS UNIQUE`,
+		},
+		// Databases from before the constraints may hold nodes created twice
+		// with the same ID; they are reported rather than merged, since only
+		// a person can tell which copy is right. See README for the fix.
+		conflicts: `MATCH (p:Person) WHERE p.id IS NOT NULL
+			 WITH p.id AS value, count(*) AS n WHERE n > 1
+			 RETURN 'Person.id ' + value + ' (' + toString(n) + ' nodes)' AS conflict
+			 UNION ALL
+			 MATCH (u:User) WHERE u.id IS NOT NULL
+			 WITH u.id AS value, count(*) AS n WHERE n > 1
+			 RETURN 'User.id ' + value + ' (' + toString(n) + ' nodes)' AS conflict
+			 UNION ALL
+			 MATCH (u:User) WHERE u.login IS NOT NULL
+			 WITH u.login AS value, count(*) AS n WHERE n > 1
+			 RETURN 'User.login ' + value + ' (' + toString(n) + ' nodes)' AS conflict
+			 UNION ALL
+			 MATCH (u:User) WHERE u.email IS NOT NULL
+			 WITH u.email AS value, count(*) AS n WHERE n > 1
+			 RETURN 'User.email ' + value + ' (' + toString(n) + ' nodes)' AS conflict
+			 UNION ALL
+			 MATCH (s:Session) WHERE s.id IS NOT NULL
+			 WITH s.id AS value, count(*) AS n WHERE n > 1
+			 RETURN 'Session.id ' + value + ' (' + toString(n) + ' nodes)' AS conflict`,
+	},
+	{
+		version:     2,
+		description: "indexes for session lookups by user and relationship IDs",
+		statements: []string{
+			`CREATE INDEX session_user_id IF NOT EXISTS
+			 FOR (s:Session) ON (s.userId)`,
+			`CREATE INDEX relationship_id IF NOT EXISTS
+			 FOR ()-[r:RELATIONSHIP]-() ON (r.id)`,
+		},
+	},
+	{
+		version:     3,
+		description: "backfill IDs of relationships created before they had one",
+		statements: []string{
+			`MATCH ()-[r:RELATIONSHIP]->()
+			 WHERE r.id IS NULL
+			 SET r.id = randomUUID()`,
+		},
+	},
+	{
+		version:     4,
+		description: "full-text index for person search",
+		statements: []string{
+			"CREATE FULLTEXT INDEX " + personSearchIndex + ` IF NOT EXISTS
+			 FOR (p:Person) ON EACH [p.name, p.occupation, p.description]
+			 OPTIONS {indexConfig: {` + "`fulltext.analyzer`" + `: 'standard-folding'}}`,
+		},
+	},
+	{
+		version:     5,
+		description: "creation time of persons and indexes for sorted listing",
+		statements: []string{
+			`MATCH (p:Person)
+			 WHERE p.created_at IS NULL
+			 SET p.created_at = timestamp() / 1000`,
+			`CREATE INDEX person_name IF NOT EXISTS
+			 FOR (p:Person) ON (p.name)`,
+			`CREATE INDEX person_created_at IF NOT EXISTS
+			 FOR (p:Person) ON (p.created_at)`,
+		},
+	},
+	{
+		version:     6,
+		description: "unique constraint on sources",
+		statements: []string{
+			`CREATE CONSTRAINT source_id_unique IF NOT EXISTS
+			 FOR (s:Source) REQUIRE s.id IS UNIQUE`,
+		},
+	},
+	{
+		version:     7,
+		description: "revision history of persons and relationships",
+		statements: []string{
+			`CREATE CONSTRAINT revision_id_unique IF NOT EXISTS
+			 FOR (v:Revision) REQUIRE v.id IS UNIQUE`,
+			`CREATE INDEX revision_entity IF NOT EXISTS
+			 FOR (v:Revision) ON (v.entity_type, v.entity_id)`,
+		},
+	},
+	{
+		version:     8,
+		description: "roles of existing users",
+		statements: []string{
+			// Before roles existed every user could edit, so keep it that way.
+			`MATCH (u:User)
+			 WHERE u.roles IS NULL
+			 SET u.roles = ['editor']`,
+		},
+	},
+	{
+		version:     9,
+		description: "proposals awaiting moderation",
+		statements: []string{
+			`CREATE CONSTRAINT proposal_id_unique IF NOT EXISTS
+			 FOR (p:Proposal) REQUIRE p.id IS UNIQUE`,
+			`CREATE INDEX proposal_status IF NOT EXISTS
+			 FOR (p:Proposal) ON (p.status)`,
+		},
+	},
+	{
+		version:     10,
+		description: "personal API tokens",
+		statements: []string{
+			`CREATE CONSTRAINT api_token_id_unique IF NOT EXISTS
+			 FOR (t:APIToken) REQUIRE t.id IS UNIQUE`,
+			`CREATE CONSTRAINT api_token_hash_unique IF NOT EXISTS
+			 FOR (t:APIToken) REQUIRE t.hash IS UNIQUE`,
+			`CREATE INDEX api_token_user_id IF NOT EXISTS
+			 FOR (t:APIToken) ON (t.user_id)`,
+		},
+	},
+	{
+		version:     11,
+		description: "index for sweeping expired sessions",
+		statements: []string{
+			`CREATE INDEX session_expires_at IF NOT EXISTS
+			 FOR (s:Session) ON (s.expiresAt)`,
+		},
+	},
+	{
+		version:     12,
+		description: "one-time tokens for email verification and password resets",
+		statements: []string{
+			`CREATE CONSTRAINT one_time_token_hash_unique IF NOT EXISTS
+			 FOR (t:OneTimeToken) REQUIRE t.hash IS UNIQUE`,
+			`CREATE INDEX one_time_token_user_id IF NOT EXISTS
+			 FOR (t:OneTimeToken) ON (t.user_id)`,
+			`CREATE INDEX one_time_token_expires_at IF NOT EXISTS
+			 FOR (t:OneTimeToken) ON (t.expires_at)`,
+		},
+	},
+	{
+		version:     13,
+		description: "users signing in with OpenID Connect",
+		statements: []string{
+			`CREATE CONSTRAINT user_oidc_identity_unique IF NOT EXISTS
+			 FOR (u:User) REQUIRE u.oidc_identity IS UNIQUE`,
+		},
+	},
+	{
+		version:     14,
+		description: "audit log",
+		statements: []string{
+			`CREATE CONSTRAINT audit_entry_id_unique IF NOT EXISTS
+			 FOR (a:AuditEntry) REQUIRE a.id IS UNIQUE`,
+			`CREATE INDEX audit_entry_created_at IF NOT EXISTS
+			 FOR (a:AuditEntry) ON (a.created_at)`,
+			`CREATE INDEX audit_entry_user_id IF NOT EXISTS
+			 FOR (a:AuditEntry) ON (a.user_id)`,
+			`CREATE INDEX audit_entry_action IF NOT EXISTS
+			 FOR (a:AuditEntry) ON (a.action)`,
+		},
+	},
+}
+
+// Migrate applies every migration that has not yet been recorded in the
+// database. It is safe to call on every startup.
+func Migrate(ctx context.Context, driver neo4j.DriverWithContext) error {
+	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	applied, err := appliedMigrations(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.version, m.description)
+		if m.conflicts != "" {
+			if err := checkConflicts(ctx, session, m); err != nil {
+				return err
+			}
+		}
+		for _, statement := range m.statements {
+			if err := runAndConsume(ctx, session, statement, nil); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			}
+		}
+
+		err := runAndConsume(ctx, session,
+			`MERGE (m:SchemaMigration {version: $version})
+			 SET m.description = $description, m.applied_at = datetime()`,
+			map[string]interface{}{
+				"version":     m.version,
+				"description": m.description,
+			})
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+	}
+
+	log.Printf("Database schema is at version %d", migrations[len(migrations)-1].version)
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, session neo4j.SessionWithContext) (map[int64]bool, error) {
+	result, err := session.Run(ctx, `MATCH (m:SchemaMigration) RETURN m.version`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]bool)
+	for result.Next(ctx) {
+		version, _ := result.Record().Get("m.version")
+		if v, ok := version.(int64); ok {
+			applied[v] = true
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// checkConflicts runs the conflicts query of m and fails with the conflicting
+// values, so that the data can be fixed before the migration is retried.
+func checkConflicts(ctx context.Context, session neo4j.SessionWithContext, m migration) error {
+	result, err := session.Run(ctx, m.conflicts, nil)
+	if err != nil {
+		return fmt.Errorf("migration %d (%s): failed to check for conflicts: %w", m.version, m.description, err)
+	}
+
+	var conflicts []string
+	total := 0
+	for result.Next(ctx) {
+		total++
+		if len(conflicts) < maxReportedConflicts {
+			conflict, _ := result.Record().Get("conflict")
+			conflicts = append(conflicts, fmt.Sprint(conflict))
+		}
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("migration %d (%s): failed to check for conflicts: %w", m.version, m.description, err)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	if total > len(conflicts) {
+		conflicts = append(conflicts, fmt.Sprintf("and %d more", total-len(conflicts)))
+	}
+	return fmt.Errorf("migration %d (%s) cannot be applied, the database holds duplicates that must be merged or removed first (see README): %s",
+		m.version, m.description, strings.Join(conflicts, "; "))
+}
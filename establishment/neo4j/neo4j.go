@@ -8,16 +8,25 @@ import (
 	"os"
 
 	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
-var (
-	ErrNoSuchPerson        = errors.New("no such person")
-	ErrUserExists          = errors.New("user already exists")
-	ErrNoSuchSession       = errors.New("no such session")
-	ErrInvalidRelationship = errors.New("source and target IDs must be different")
-)
+// Store is the Neo4j-backed implementation of store.Store.
+type Store struct {
+	driver neo4j.DriverWithContext
+}
+
+var _ store.Store = (*Store)(nil)
+
+func NewStore(driver neo4j.DriverWithContext) *Store {
+	return &Store{driver: driver}
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	return s.driver.Close(ctx)
+}
 
 func ConnectToNeo4j(ctx context.Context) (neo4j.DriverWithContext, error) {
 	neo4jURI := os.Getenv("NEO4J_URI")
@@ -49,20 +58,39 @@ func ConnectToNeo4j(ctx context.Context) (neo4j.DriverWithContext, error) {
 	return driver, nil
 }
 
-func AddPerson(ctx context.Context, driver neo4j.DriverWithContext, person models.Person) error {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+func (s *Store) AddPerson(ctx context.Context, person models.Person) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
 	log.Printf("Adding person: id=%s, name=%s, occupation=%s", person.ID, person.Name, person.Occupation)
 
-	_, err := session.Run(ctx,
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		return nil, createPerson(ctx, tx, person)
+	})
+	if isConstraintViolation(err) {
+		log.Printf("Person already exists: id=%s", person.ID)
+		return store.ErrPersonExists
+	}
+	if err != nil {
+		log.Printf("Failed to add person: %v", err)
+		return fmt.Errorf("failed to add person: %w", err)
+	}
+	log.Println("Person added successfully")
+	return nil
+}
+
+// createPerson adds person within tx and records its revision.
+func createPerson(ctx context.Context, tx neo4j.ManagedTransaction, person models.Person) error {
+	err := execAndConsume(ctx, tx,
 		`CREATE (p:Person {
 			id: $id, 
 			name: $name, 
 			occupation: $occupation,
 			image_url: $image_url,
 			twitter: $twitter,
-			description: $description
+			description: $description,
+			created_at: $created_at,
+			source_ids: $source_ids
 		})`,
 		map[string]interface{}{
 			"id":          person.ID,
@@ -71,107 +99,380 @@ func AddPerson(ctx context.Context, driver neo4j.DriverWithContext, person model
 			"image_url":   person.ImageURL,
 			"twitter":     person.Twitter,
 			"description": person.Description,
+			"created_at":  person.CreatedAt,
+			"source_ids":  stringList(person.SourceIDs),
 		})
 	if err != nil {
-		log.Printf("Failed to add person: %v", err)
-		return fmt.Errorf("failed to add person: %w", err)
+		return err
 	}
-	log.Println("Person added successfully")
-	return nil
+	return recordRevision(ctx, tx, personRef(person.ID), nil, person)
 }
 
-func GetPerson(ctx context.Context, driver neo4j.DriverWithContext, id string) (models.Person, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) GetPerson(ctx context.Context, id string) (models.Person, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
 	result, err := session.Run(ctx,
 		`MATCH (p:Person {id: $id}) 
-		 RETURN p.id, p.name, p.occupation, p.image_url, p.twitter, p.description`,
+		 RETURN `+personColumns,
 		map[string]interface{}{"id": id})
 	if err != nil {
 		return models.Person{}, fmt.Errorf("failed to query person: %w", err)
 	}
 
 	if result.Next(ctx) {
-		record := result.Record()
-		id, _ := record.Get("p.id")
-		name, _ := record.Get("p.name")
-		occupation, _ := record.Get("p.occupation")
-		imageURL, _ := record.Get("p.image_url")
-		twitter, _ := record.Get("p.twitter")
-		description, _ := record.Get("p.description")
+		return personFromRecord(result.Record()), nil
+	}
+
+	return models.Person{}, store.ErrNoSuchPerson
+}
+
+func (s *Store) UpdatePerson(ctx context.Context, id string, update models.PersonUpdate) (models.Person, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
 
-		return models.Person{
-			ID:          id.(string),
-			Name:        name.(string),
-			Occupation:  occupation.(string),
-			ImageURL:    imageURL.(string),
-			Twitter:     twitter.(string),
-			Description: description.(string),
-		}, nil
+	log.Printf("Updating person: id=%s", id)
+
+	person, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		return updatePerson(ctx, tx, id, update)
+	})
+	if errors.Is(err, store.ErrNoSuchPerson) {
+		return models.Person{}, store.ErrNoSuchPerson
+	}
+	if err != nil {
+		log.Printf("Failed to update person: %v", err)
+		return models.Person{}, fmt.Errorf("failed to update person: %w", err)
 	}
 
-	return models.Person{}, ErrNoSuchPerson
+	log.Printf("Person updated successfully: id=%s", id)
+	return person.(models.Person), nil
 }
 
-func AddRelationship(ctx context.Context, driver neo4j.DriverWithContext, rel models.Relationship) error {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+// updatePerson applies update and records the revision within tx. It
+// returns ErrNoSuchPerson if there is no person with the given ID.
+func updatePerson(ctx context.Context, tx neo4j.ManagedTransaction, id string, update models.PersonUpdate) (models.Person, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (p:Person {id: $id})
+		 WITH p, p {`+personProjection+`} AS before
+		 SET p.name = coalesce($name, p.name),
+			 p.occupation = coalesce($occupation, p.occupation),
+			 p.image_url = coalesce($image_url, p.image_url),
+			 p.twitter = coalesce($twitter, p.twitter),
+			 p.description = coalesce($description, p.description),
+			 p.source_ids = coalesce($source_ids, p.source_ids)
+		 RETURN before, p {`+personProjection+`} AS after`,
+		map[string]interface{}{
+			"id":          id,
+			"name":        optionalString(update.Name),
+			"occupation":  optionalString(update.Occupation),
+			"image_url":   optionalString(update.ImageURL),
+			"twitter":     optionalString(update.Twitter),
+			"description": optionalString(update.Description),
+			"source_ids":  optionalStrings(update.SourceIDs),
+		})
+	if err != nil {
+		return models.Person{}, err
+	}
+	if !result.Next(ctx) {
+		if err := result.Err(); err != nil {
+			return models.Person{}, err
+		}
+		return models.Person{}, store.ErrNoSuchPerson
+	}
+	before, _ := result.Record().Get("before")
+	after, _ := result.Record().Get("after")
+	person := personFromMap(after)
+	return person, recordRevision(ctx, tx, personRef(id), personFromMap(before), person)
+}
+
+func (s *Store) DeletePerson(ctx context.Context, id string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Deleting person: id=%s", id)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		result, err := tx.Run(ctx,
+			`MATCH (p:Person {id: $id})
+			 OPTIONAL MATCH (p)-[r:RELATIONSHIP]-(:Person)
+			 WITH p, p {`+personProjection+`} AS person, collect(r {`+relationshipProjection+`}) AS rels
+			 DETACH DELETE p
+			 RETURN person, rels`,
+			map[string]interface{}{"id": id})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(ctx) {
+			if err := result.Err(); err != nil {
+				return nil, err
+			}
+			return nil, store.ErrNoSuchPerson
+		}
+		person, _ := result.Record().Get("person")
+		rels, _ := result.Record().Get("rels")
+
+		if err := recordRevision(ctx, tx, personRef(id), personFromMap(person), nil); err != nil {
+			return nil, err
+		}
+		for _, value := range rels.([]interface{}) {
+			rel := relationshipFromMap(value)
+			if err := recordRevision(ctx, tx, relationshipRef(rel.ID), rel, nil); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if errors.Is(err, store.ErrNoSuchPerson) {
+		return store.ErrNoSuchPerson
+	}
+	if err != nil {
+		log.Printf("Failed to delete person: %v", err)
+		return fmt.Errorf("failed to delete person: %w", err)
+	}
+	log.Printf("Person deleted successfully: id=%s", id)
+	return nil
+}
+
+func (s *Store) AddRelationship(ctx context.Context, rel models.Relationship) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
 	// Sprawdź, czy source_id i target_id są różne
 	if rel.From == rel.To {
 		log.Printf("Invalid relationship: source_id=%s and target_id=%s are the same", rel.From, rel.To)
-		return ErrInvalidRelationship
+		return store.ErrInvalidRelationship
 	}
 
-	log.Printf("Verifying persons for relationship: source_id=%s, target_id=%s", rel.From, rel.To)
+	log.Printf("Adding relationship: id=%s, source_id=%s, target_id=%s, type=%s, details=%s", rel.ID, rel.From, rel.To, rel.Type, rel.Details)
 
-	result, err := session.Run(ctx,
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		return nil, createRelationship(ctx, tx, rel)
+	})
+	if errors.Is(err, store.ErrPersonsNotFound) {
+		log.Printf("One or both persons not found: source_id=%s, target_id=%s", rel.From, rel.To)
+		return store.ErrPersonsNotFound
+	}
+	if err != nil {
+		log.Printf("Failed to add relationship: %v", err)
+		return fmt.Errorf("failed to add relationship: %w", err)
+	}
+	log.Printf("Relationship added successfully: %s -> %s (%s)", rel.From, rel.To, rel.Type)
+	return nil
+}
+
+// createRelationship adds rel within tx and records its revision. It
+// returns ErrPersonsNotFound if either end does not exist.
+func createRelationship(ctx context.Context, tx neo4j.ManagedTransaction, rel models.Relationship) error {
+	result, err := tx.Run(ctx,
 		`MATCH (a:Person {id: $from}), (b:Person {id: $to})
-		 RETURN a.id, b.id`,
+		 CREATE (a)-[r:RELATIONSHIP {
+			id: $id,
+			type: $type,
+			details: $details,
+			start_date: $start_date,
+			end_date: $end_date,
+			source_ids: $source_ids
+		 }]->(b)
+		 RETURN r.id`,
 		map[string]interface{}{
-			"from": rel.From,
-			"to":   rel.To,
+			"id":         rel.ID,
+			"from":       rel.From,
+			"to":         rel.To,
+			"type":       rel.Type,
+			"details":    rel.Details,
+			"start_date": rel.StartDate,
+			"end_date":   rel.EndDate,
+			"source_ids": stringList(rel.SourceIDs),
 		})
 	if err != nil {
-		log.Printf("Failed to verify persons: %v", err)
-		return fmt.Errorf("failed to verify persons for relationship: %w", err)
+		return err
 	}
 	if !result.Next(ctx) {
-		log.Printf("One or both persons not found: source_id=%s, target_id=%s", rel.From, rel.To)
-		return fmt.Errorf("one or both persons not found: source_id=%s, target_id=%s", rel.From, rel.To)
+		if err := result.Err(); err != nil {
+			return err
+		}
+		return store.ErrPersonsNotFound
 	}
+	return recordRevision(ctx, tx, relationshipRef(rel.ID), nil, rel)
+}
 
-	log.Printf("Adding relationship: source_id=%s, target_id=%s, type=%s, details=%s", rel.From, rel.To, rel.Type, rel.Details)
+func (s *Store) GetRelationship(ctx context.Context, id string) (models.Relationship, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
 
-	_, err = session.Run(ctx,
-		`MATCH (a:Person {id: $from}), (b:Person {id: $to})
-		 MERGE (a)-[r:RELATIONSHIP {type: $type, details: $details}]->(b)
-		 RETURN r`,
+	result, err := session.Run(ctx,
+		`MATCH (a:Person)-[r:RELATIONSHIP {id: $id}]->(b:Person)
+		 RETURN `+relationshipColumns,
+		map[string]interface{}{"id": id})
+	if err != nil {
+		return models.Relationship{}, fmt.Errorf("failed to query relationship: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return relationshipFromRecord(result.Record()), nil
+	}
+
+	return models.Relationship{}, store.ErrNoSuchRelationship
+}
+
+func (s *Store) GetRelationshipsByIDs(ctx context.Context, ids []string) ([]models.Relationship, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (a:Person)-[r:RELATIONSHIP]->(b:Person)
+		 WHERE r.id IN $ids
+		 RETURN `+relationshipColumns,
+		map[string]interface{}{"ids": stringList(ids)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relationships: %w", err)
+	}
+
+	rels := []models.Relationship{}
+	for result.Next(ctx) {
+		rels = append(rels, relationshipFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read relationships: %w", err)
+	}
+	return rels, nil
+}
+
+func (s *Store) UpdateRelationship(ctx context.Context, id string, update models.RelationshipUpdate) (models.Relationship, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Updating relationship: id=%s", id)
+
+	rel, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		return updateRelationship(ctx, tx, id, update)
+	})
+	if errors.Is(err, store.ErrNoSuchRelationship) {
+		return models.Relationship{}, store.ErrNoSuchRelationship
+	}
+	if err != nil {
+		log.Printf("Failed to update relationship: %v", err)
+		return models.Relationship{}, fmt.Errorf("failed to update relationship: %w", err)
+	}
+
+	log.Printf("Relationship updated successfully: id=%s", id)
+	return rel.(models.Relationship), nil
+}
+
+// updateRelationship applies update and records the revision within tx. It
+// returns ErrNoSuchRelationship if there is no relationship with the given
+// ID.
+func updateRelationship(ctx context.Context, tx neo4j.ManagedTransaction, id string, update models.RelationshipUpdate) (models.Relationship, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (:Person)-[r:RELATIONSHIP {id: $id}]->(:Person)
+		 WITH r, r {`+relationshipProjection+`} AS before
+		 SET r.type = coalesce($type, r.type),
+			 r.details = coalesce($details, r.details),
+			 r.start_date = coalesce($start_date, r.start_date),
+			 r.end_date = coalesce($end_date, r.end_date),
+			 r.source_ids = coalesce($source_ids, r.source_ids)
+		 RETURN before, r {`+relationshipProjection+`} AS after`,
 		map[string]interface{}{
-			"from":    rel.From,
-			"to":      rel.To,
-			"type":    rel.Type,
-			"details": rel.Details,
+			"id":         id,
+			"type":       optionalString(update.Type),
+			"details":    optionalString(update.Details),
+			"start_date": optionalString(update.StartDate),
+			"end_date":   optionalString(update.EndDate),
+			"source_ids": optionalStrings(update.SourceIDs),
 		})
 	if err != nil {
-		log.Printf("Failed to add relationship: %v", err)
-		return fmt.Errorf("failed to add relationship: %w", err)
+		return models.Relationship{}, err
 	}
-	log.Printf("Relationship added successfully: %s -> %s (%s)", rel.From, rel.To, rel.Type)
+	if !result.Next(ctx) {
+		if err := result.Err(); err != nil {
+			return models.Relationship{}, err
+		}
+		return models.Relationship{}, store.ErrNoSuchRelationship
+	}
+	before, _ := result.Record().Get("before")
+	after, _ := result.Record().Get("after")
+	rel := relationshipFromMap(after)
+	return rel, recordRevision(ctx, tx, relationshipRef(id), relationshipFromMap(before), rel)
+}
+
+func (s *Store) DeleteRelationship(ctx context.Context, id string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Deleting relationship: id=%s", id)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		result, err := tx.Run(ctx,
+			`MATCH ()-[r:RELATIONSHIP {id: $id}]->()
+			 WITH r, r {`+relationshipProjection+`} AS rel
+			 DELETE r
+			 RETURN rel`,
+			map[string]interface{}{"id": id})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(ctx) {
+			if err := result.Err(); err != nil {
+				return nil, err
+			}
+			return nil, store.ErrNoSuchRelationship
+		}
+		rel, _ := result.Record().Get("rel")
+		return nil, recordRevision(ctx, tx, relationshipRef(id), relationshipFromMap(rel), nil)
+	})
+	if errors.Is(err, store.ErrNoSuchRelationship) {
+		return store.ErrNoSuchRelationship
+	}
+	if err != nil {
+		log.Printf("Failed to delete relationship: %v", err)
+		return fmt.Errorf("failed to delete relationship: %w", err)
+	}
+	log.Printf("Relationship deleted successfully: id=%s", id)
 	return nil
 }
 
-func GetGraph(ctx context.Context, driver neo4j.DriverWithContext) (models.Graph, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) GetPersonRelationships(ctx context.Context, personID string) ([]models.Relationship, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (p:Person {id: $id})
+		 OPTIONAL MATCH (p)-[r:RELATIONSHIP]-(:Person)
+		 WITH p, r, startNode(r) AS a, endNode(r) AS b
+		 RETURN p.id, `+relationshipColumns,
+		map[string]interface{}{"id": personID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relationships: %w", err)
+	}
+
+	found := false
+	rels := []models.Relationship{}
+	for result.Next(ctx) {
+		found = true
+		if from, _ := result.Record().Get("a.id"); from == nil {
+			continue
+		}
+		rels = append(rels, relationshipFromRecord(result.Record()))
+	}
+	if !found {
+		return nil, store.ErrNoSuchPerson
+	}
+
+	log.Printf("Returning %d relationships for person %s", len(rels), personID)
+	return rels, nil
+}
+
+func (s *Store) GetGraph(ctx context.Context, filter models.GraphFilter) (models.Graph, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
 	result, err := session.Run(ctx,
 		`MATCH (p:Person)
 		 OPTIONAL MATCH (p)-[r:RELATIONSHIP]->(q:Person)
-		 RETURN p.id, p.name, p.occupation, p.image_url, p.twitter, p.description,
-				r.type, r.details, q.id as target_id`,
-		nil)
+		 WHERE $at = '' OR `+activeAt+`
+		 RETURN `+personColumns+`,
+				r.id, r.type, r.details, r.start_date, r.end_date, r.source_ids, q.id as target_id`,
+		map[string]interface{}{"at": filter.At})
 	if err != nil {
 		log.Printf("Failed to query graph: %v", err)
 		return models.Graph{}, fmt.Errorf("failed to query graph: %w", err)
@@ -179,32 +480,15 @@ func GetGraph(ctx context.Context, driver neo4j.DriverWithContext) (models.Graph
 
 	nodes := make(map[string]models.Person)
 	edges := []models.Relationship{}
-	recordCount := 0
 
 	for result.Next(ctx) {
-		recordCount++
-		log.Printf("Processing record %d: %v", recordCount, result.Record().Values)
-
 		id, ok := result.Record().Get("p.id")
 		if !ok || id == nil {
 			log.Println("Warning: Missing or nil p.id in graph query result")
 			continue
 		}
 
-		name, _ := result.Record().Get("p.name")
-		occupation, _ := result.Record().Get("p.occupation")
-		imageURL, _ := result.Record().Get("p.image_url")
-		twitter, _ := result.Record().Get("p.twitter")
-		description, _ := result.Record().Get("p.description")
-
-		node := models.Person{
-			ID:          id.(string),
-			Name:        name.(string),
-			Occupation:  occupation.(string),
-			ImageURL:    imageURL.(string),
-			Twitter:     twitter.(string),
-			Description: description.(string),
-		}
+		node := personFromRecord(result.Record())
 		nodes[id.(string)] = node
 
 		if targetID, ok := result.Record().Get("target_id"); ok && targetID != nil {
@@ -219,12 +503,15 @@ func GetGraph(ctx context.Context, driver neo4j.DriverWithContext) (models.Graph
 				continue
 			}
 			edge := models.Relationship{
-				From:    id.(string),
-				To:      targetID.(string),
-				Type:    relType.(string),
-				Details: details.(string),
+				ID:        stringValue(result.Record(), "r.id"),
+				From:      id.(string),
+				To:        targetID.(string),
+				Type:      relType.(string),
+				Details:   details.(string),
+				StartDate: stringValue(result.Record(), "r.start_date"),
+				EndDate:   stringValue(result.Record(), "r.end_date"),
+				SourceIDs: stringsValue(result.Record(), "r.source_ids"),
 			}
-			log.Printf("Adding edge: source_id=%s, target_id=%s, type=%s, details=%s", edge.From, edge.To, edge.Type, edge.Details)
 			edges = append(edges, edge)
 		}
 	}
@@ -252,13 +539,13 @@ func GetGraph(ctx context.Context, driver neo4j.DriverWithContext) (models.Graph
 	return graph, nil
 }
 
-func GetPersons(ctx context.Context, driver neo4j.DriverWithContext) ([]models.Person, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) GetPersons(ctx context.Context) ([]models.Person, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
 	result, err := session.Run(ctx,
 		`MATCH (p:Person) 
-		 RETURN p.id, p.name, p.occupation, p.image_url, p.twitter, p.description`,
+		 RETURN `+personColumns,
 		nil)
 	if err != nil {
 		log.Printf("Failed to query persons: %v", err)
@@ -267,175 +554,467 @@ func GetPersons(ctx context.Context, driver neo4j.DriverWithContext) ([]models.P
 
 	var persons []models.Person
 	for result.Next(ctx) {
-		record := result.Record()
-		id, _ := record.Get("p.id")
-		name, _ := record.Get("p.name")
-		occupation, _ := record.Get("p.occupation")
-		imageURL, _ := record.Get("p.image_url")
-		twitter, _ := record.Get("p.twitter")
-		description, _ := record.Get("p.description")
-
-		persons = append(persons, models.Person{
-			ID:          id.(string),
-			Name:        name.(string),
-			Occupation:  occupation.(string),
-			ImageURL:    imageURL.(string),
-			Twitter:     twitter.(string),
-			Description: description.(string),
-		})
+		persons = append(persons, personFromRecord(result.Record()))
 	}
 
 	log.Printf("Returning %d persons", len(persons))
 	return persons, nil
 }
 
-func AddUser(ctx context.Context, driver neo4j.DriverWithContext, user models.User) error {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+func (s *Store) GetPersonsByIDs(ctx context.Context, ids []string) ([]models.Person, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
 	result, err := session.Run(ctx,
-		`MATCH (u:User) WHERE u.login = $login OR u.email = $email
-		 RETURN u`,
-		map[string]interface{}{
-			"login": user.Login,
-			"email": user.Email,
-		})
+		`MATCH (p:Person)
+		 WHERE p.id IN $ids
+		 RETURN `+personColumns,
+		map[string]interface{}{"ids": stringList(ids)})
 	if err != nil {
-		return fmt.Errorf("failed to check existing user: %w", err)
+		return nil, fmt.Errorf("failed to query persons: %w", err)
 	}
-	if result.Next(ctx) {
-		return ErrUserExists
+
+	persons := []models.Person{}
+	for result.Next(ctx) {
+		persons = append(persons, personFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read persons: %w", err)
+	}
+	return persons, nil
+}
+
+// personSortKeys maps the sort keys of models.PersonQuery to Cypher
+// expressions; missing properties sort as empty values.
+var personSortKeys = map[string]string{
+	models.SortByName:      `coalesce(p.name, '')`,
+	models.SortByCreatedAt: `coalesce(p.created_at, 0)`,
+}
+
+func (s *Store) ListPersons(ctx context.Context, query models.PersonQuery) (models.PersonPage, error) {
+	key, ok := personSortKeys[query.Sort]
+	if !ok {
+		key = personSortKeys[models.SortByName]
+	}
+	direction, comparison := "ASC", ">"
+	if query.Order == models.OrderDesc {
+		direction, comparison = "DESC", "<"
 	}
 
-	_, err = session.Run(ctx,
-		`CREATE (u:User {id: $id, login: $login, email: $email, password: $password})`,
+	filters := `($occupation = '' OR p.occupation = $occupation)
+		 AND ($has_twitter IS NULL OR (coalesce(p.twitter, '') <> '') = $has_twitter)
+		 AND ($created_after = 0 OR p.created_at > $created_after)`
+	params := map[string]interface{}{
+		"occupation":    query.Occupation,
+		"has_twitter":   nil,
+		"created_after": query.CreatedAfter,
+		"limit":         query.Limit + 1,
+	}
+	if query.HasTwitter != nil {
+		params["has_twitter"] = *query.HasTwitter
+	}
+
+	cursorFilter := "true"
+	if query.Cursor != "" {
+		cursor, err := store.DecodeCursor(query.Cursor)
+		if err != nil {
+			return models.PersonPage{}, err
+		}
+		if query.Sort == models.SortByCreatedAt {
+			params["cursor_value"] = cursor.CreatedAt
+		} else {
+			params["cursor_value"] = cursor.Name
+		}
+		params["cursor_id"] = cursor.ID
+		cursorFilter = fmt.Sprintf(`(%[1]s %[2]s $cursor_value OR (%[1]s = $cursor_value AND p.id %[2]s $cursor_id))`, key, comparison)
+	}
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (p:Person)
+		 WHERE `+filters+`
+		 RETURN count(p) AS total`,
+		params)
+	if err != nil {
+		log.Printf("Failed to count persons: %v", err)
+		return models.PersonPage{}, fmt.Errorf("failed to count persons: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return models.PersonPage{}, fmt.Errorf("failed to count persons: %w", err)
+	}
+	page := models.PersonPage{Items: []models.Person{}, Total: intValue(record, "total")}
+
+	result, err = session.Run(ctx,
+		fmt.Sprintf(`MATCH (p:Person)
+		 WHERE `+filters+` AND %s
+		 RETURN `+personColumns+`
+		 ORDER BY %s %s, p.id %s
+		 LIMIT $limit`, cursorFilter, key, direction, direction),
+		params)
+	if err != nil {
+		log.Printf("Failed to query persons: %v", err)
+		return models.PersonPage{}, fmt.Errorf("failed to query persons: %w", err)
+	}
+	for result.Next(ctx) {
+		page.Items = append(page.Items, personFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return models.PersonPage{}, fmt.Errorf("failed to read persons: %w", err)
+	}
+
+	if len(page.Items) > query.Limit {
+		page.Items = page.Items[:query.Limit]
+		page.NextCursor = store.EncodeCursor(store.CursorFor(page.Items[query.Limit-1]))
+	}
+
+	log.Printf("Returning %d of %d persons", len(page.Items), page.Total)
+	return page, nil
+}
+
+func (s *Store) AddUser(ctx context.Context, user models.User) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	err := runAndConsume(ctx, session,
+		`CREATE (u:User {id: $id, login: $login, email: $email, password: $password, roles: $roles, email_verified: $email_verified,
+		                 oidc_identity: $oidc_identity})`,
 		map[string]interface{}{
-			"id":       user.ID,
-			"login":    user.Login,
-			"email":    user.Email,
-			"password": user.Password,
+			"id":             user.ID,
+			"login":          user.Login,
+			"email":          user.Email,
+			"password":       user.Password,
+			"roles":          stringList(user.Roles),
+			"email_verified": user.EmailVerified,
+			"oidc_identity":  nullIfEmpty(user.OIDCIdentity),
 		})
+	if isConstraintViolation(err) {
+		return store.ErrUserExists
+	}
 	if err != nil {
 		return fmt.Errorf("failed to add user: %w", err)
 	}
 	return nil
 }
 
-func GetUserByLogin(ctx context.Context, driver neo4j.DriverWithContext, login string) (models.User, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	return s.getUser(ctx, `MATCH (u:User {login: $value}) RETURN `+userColumns, login)
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	return s.getUser(ctx, `MATCH (u:User {id: $value}) RETURN `+userColumns, id)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return s.getUser(ctx, `MATCH (u:User {email: $value}) RETURN `+userColumns, email)
+}
+
+func (s *Store) GetUserByOIDCIdentity(ctx context.Context, identity string) (models.User, error) {
+	return s.getUser(ctx, `MATCH (u:User {oidc_identity: $value}) RETURN `+userColumns, identity)
+}
+
+func (s *Store) getUser(ctx context.Context, cypher, value string) (models.User, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
-	result, err := session.Run(ctx,
-		`MATCH (u:User {login: $login})
-		 RETURN u.id, u.login, u.email, u.password`,
-		map[string]interface{}{"login": login})
+	result, err := session.Run(ctx, cypher, map[string]interface{}{"value": value})
 	if err != nil {
 		return models.User{}, fmt.Errorf("failed to query user: %w", err)
 	}
 
 	if result.Next(ctx) {
-		record := result.Record()
-		id, _ := record.Get("u.id")
-		login, _ := record.Get("u.login")
-		email, _ := record.Get("u.email")
-		password, _ := record.Get("u.password")
+		return userFromRecord(result.Record()), nil
+	}
 
-		return models.User{
-			ID:       id.(string),
-			Login:    login.(string),
-			Email:    email.(string),
-			Password: password.(string),
-		}, nil
+	return models.User{}, store.ErrNoSuchUser
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]models.User, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (u:User)
+		 RETURN `+userColumns+`
+		 ORDER BY u.login`,
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
 
-	return models.User{}, fmt.Errorf("user not found")
+	users := []models.User{}
+	for result.Next(ctx) {
+		users = append(users, userFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *Store) GrantRole(ctx context.Context, userID, role string) (models.User, error) {
+	return s.updateRoles(ctx, userID, role,
+		`SET u.roles = CASE WHEN $role IN coalesce(u.roles, []) THEN u.roles
+		                   ELSE coalesce(u.roles, []) + $role END`)
 }
 
-func GetUserByID(ctx context.Context, driver neo4j.DriverWithContext, id string) (models.User, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) RevokeRole(ctx context.Context, userID, role string) (models.User, error) {
+	return s.updateRoles(ctx, userID, role,
+		`SET u.roles = [held IN coalesce(u.roles, []) WHERE held <> $role]`)
+}
+
+func (s *Store) updateRoles(ctx context.Context, userID, role, change string) (models.User, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
+	log.Printf("Updating roles of user %s: %s", userID, role)
+
 	result, err := session.Run(ctx,
 		`MATCH (u:User {id: $id})
-		 RETURN u.id, u.login, u.email, u.password`,
-		map[string]interface{}{"id": id})
+		 `+change+`
+		 RETURN `+userColumns,
+		map[string]interface{}{"id": userID, "role": role})
 	if err != nil {
-		return models.User{}, fmt.Errorf("failed to query user: %w", err)
+		return models.User{}, fmt.Errorf("failed to update roles: %w", err)
 	}
 
 	if result.Next(ctx) {
-		record := result.Record()
-		id, _ := record.Get("u.id")
-		login, _ := record.Get("u.login")
-		email, _ := record.Get("u.email")
-		password, _ := record.Get("u.password")
-
-		return models.User{
-			ID:       id.(string),
-			Login:    login.(string),
-			Email:    email.(string),
-			Password: password.(string),
-		}, nil
+		return userFromRecord(result.Record()), nil
 	}
+	if err := result.Err(); err != nil {
+		return models.User{}, fmt.Errorf("failed to update roles: %w", err)
+	}
+	return models.User{}, store.ErrNoSuchUser
+}
 
-	return models.User{}, fmt.Errorf("user not found")
+func (s *Store) SetPassword(ctx context.Context, userID, hash string) error {
+	return s.updateUser(ctx, userID, `SET u.password = $value`, hash)
 }
 
-func CreateSession(ctx context.Context, driver neo4j.DriverWithContext, session models.Session) error {
-	neo4jSession := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-	defer neo4jSession.Close(ctx)
+func (s *Store) SetEmailVerified(ctx context.Context, userID string) error {
+	return s.updateUser(ctx, userID, `SET u.email_verified = $value`, true)
+}
 
-	_, err := neo4jSession.Run(ctx,
-		`CREATE (s:Session {id: $id, userId: $userId, expiresAt: $expiresAt})`,
+func (s *Store) SetTOTP(ctx context.Context, userID, secret string, enabled bool, recoveryCodes []string) error {
+	return s.updateUser(ctx, userID,
+		`SET u.totp_secret = $value.secret, u.totp_enabled = $value.enabled,
+		     u.recovery_codes = $value.recovery_codes`,
 		map[string]interface{}{
-			"id":        session.ID,
-			"userId":    session.UserID,
-			"expiresAt": session.ExpiresAt,
+			"secret":         secret,
+			"enabled":        enabled,
+			"recovery_codes": stringList(recoveryCodes),
 		})
+}
+
+func (s *Store) AcceptTOTPCounter(ctx context.Context, userID string, counter int64) error {
+	return s.useSecondFactor(ctx, userID,
+		`WHERE coalesce(u.totp_counter, 0) < $value
+		 SET u.totp_counter = $value`,
+		counter)
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	return s.useSecondFactor(ctx, userID,
+		`WHERE $value IN coalesce(u.recovery_codes, [])
+		 SET u.recovery_codes = [code IN u.recovery_codes WHERE code <> $value]`,
+		hash)
+}
+
+func (s *Store) SetOIDCIdentity(ctx context.Context, userID, identity string) error {
+	err := s.updateUser(ctx, userID, `SET u.oidc_identity = $value`, identity)
+	if isConstraintViolation(err) {
+		return store.ErrUserExists
+	}
+	return err
+}
+
+// useSecondFactor applies change, which must start with a WHERE clause, to
+// the user while holding a lock on it, so that two logins cannot both use
+// the same code. It returns ErrCodeUsed if the WHERE clause does not hold.
+func (s *Store) useSecondFactor(ctx context.Context, userID, change string, value interface{}) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (u:User {id: $id})
+		 SET u._lock = true
+		 REMOVE u._lock
+		 WITH u, true AS found
+		 `+change+`
+		 RETURN found`,
+		map[string]interface{}{"id": userID, "value": value})
 	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+		return fmt.Errorf("failed to check second factor: %w", err)
+	}
+	if !result.Next(ctx) {
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("failed to check second factor: %w", err)
+		}
+		return store.ErrCodeUsed
 	}
 	return nil
 }
 
-func GetSession(ctx context.Context, driver neo4j.DriverWithContext, sessionID string) (models.Session, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+func (s *Store) updateUser(ctx context.Context, userID, change string, value interface{}) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
 	result, err := session.Run(ctx,
-		`MATCH (s:Session {id: $id})
-		 RETURN s.id, s.userId, s.expiresAt`,
-		map[string]interface{}{"id": sessionID})
+		`MATCH (u:User {id: $id})
+		 `+change+`
+		 RETURN u.id`,
+		map[string]interface{}{"id": userID, "value": value})
 	if err != nil {
-		return models.Session{}, fmt.Errorf("failed to query session: %w", err)
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if !result.Next(ctx) {
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return store.ErrNoSuchUser
 	}
+	return nil
+}
 
-	if result.Next(ctx) {
-		record := result.Record()
-		id, _ := record.Get("s.id")
-		userID, _ := record.Get("s.userId")
-		expiresAt, _ := record.Get("s.expiresAt")
+// userColumns lists the columns read by userFromRecord for a user bound to u.
+const userColumns = `u.id, u.login, u.email, u.password, u.roles, u.email_verified,
+	u.totp_secret, u.totp_enabled, u.totp_counter, u.recovery_codes, u.oidc_identity`
+
+func userFromRecord(record *neo4j.Record) models.User {
+	return models.User{
+		ID:            stringValue(record, "u.id"),
+		Login:         stringValue(record, "u.login"),
+		Email:         stringValue(record, "u.email"),
+		Password:      stringValue(record, "u.password"),
+		Roles:         stringsValue(record, "u.roles"),
+		EmailVerified: boolValue(record, "u.email_verified"),
+		TOTPSecret:    stringValue(record, "u.totp_secret"),
+		TOTPEnabled:   boolValue(record, "u.totp_enabled"),
+		TOTPCounter:   intValue(record, "u.totp_counter"),
+		RecoveryCodes: stringsValue(record, "u.recovery_codes"),
+		OIDCIdentity:  stringValue(record, "u.oidc_identity"),
+	}
+}
+
+// personColumns lists the columns read by personFromRecord for a person
+// bound to p.
+const personColumns = `p.id, p.name, p.occupation, p.image_url, p.twitter, p.description, p.created_at, p.source_ids`
+
+// personFromRecord builds a Person from a record with the personColumns.
+// Missing properties are returned as zero values.
+func personFromRecord(record *neo4j.Record) models.Person {
+	return models.Person{
+		ID:          stringValue(record, "p.id"),
+		Name:        stringValue(record, "p.name"),
+		Occupation:  stringValue(record, "p.occupation"),
+		ImageURL:    stringValue(record, "p.image_url"),
+		Twitter:     stringValue(record, "p.twitter"),
+		Description: stringValue(record, "p.description"),
+		CreatedAt:   intValue(record, "p.created_at"),
+		SourceIDs:   stringsValue(record, "p.source_ids"),
+	}
+}
 
-		return models.Session{
-			ID:        id.(string),
-			UserID:    userID.(string),
-			ExpiresAt: expiresAt.(int64),
-		}, nil
+// relationshipColumns lists the columns read by relationshipFromRecord for a
+// relationship bound to r between persons bound to a and b.
+const relationshipColumns = `r.id, a.id, b.id, r.type, r.details, r.start_date, r.end_date, r.source_ids`
+
+// activeAt is a Cypher predicate that mirrors models.Relationship.ActiveAt
+// for a relationship bound to r and a YYYY-MM-DD date in $at.
+const activeAt = `((coalesce(r.start_date, '') = '' OR r.start_date <= $at)
+		 AND (coalesce(r.end_date, '') = '' OR r.end_date >= $at OR $at STARTS WITH r.end_date))`
+
+// relationshipFromRecord builds a Relationship from a record with the
+// relationshipColumns.
+func relationshipFromRecord(record *neo4j.Record) models.Relationship {
+	return models.Relationship{
+		ID:        stringValue(record, "r.id"),
+		From:      stringValue(record, "a.id"),
+		To:        stringValue(record, "b.id"),
+		Type:      stringValue(record, "r.type"),
+		Details:   stringValue(record, "r.details"),
+		StartDate: stringValue(record, "r.start_date"),
+		EndDate:   stringValue(record, "r.end_date"),
+		SourceIDs: stringsValue(record, "r.source_ids"),
 	}
+}
 
-	return models.Session{}, ErrNoSuchSession
+func stringValue(record *neo4j.Record, key string) string {
+	value, _ := record.Get(key)
+	str, _ := value.(string)
+	return str
 }
 
-func DeleteSession(ctx context.Context, driver neo4j.DriverWithContext, sessionID string) error {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-	defer session.Close(ctx)
+// optionalStrings turns a nil pointer into a Cypher null.
+func optionalStrings(values *[]string) interface{} {
+	if values == nil {
+		return nil
+	}
+	return stringList(*values)
+}
+
+// nullIfEmpty turns an empty string into a Cypher null, so that it is not
+// caught by uniqueness constraints.
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
 
-	_, err := session.Run(ctx,
-		`MATCH (s:Session {id: $id})
-		 DELETE s`,
-		map[string]interface{}{"id": sessionID})
+// runAndConsume runs a write query and waits for its summary, so that errors
+// such as constraint violations are reported rather than lost with the result.
+func runAndConsume(ctx context.Context, session neo4j.SessionWithContext, cypher string, params map[string]interface{}) error {
+	result, err := session.Run(ctx, cypher, params)
 	if err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
+		return err
 	}
-	return nil
+	_, err = result.Consume(ctx)
+	return err
+}
+
+// isConstraintViolation reports whether err was caused by a uniqueness
+// constraint created in migrations.go.
+func isConstraintViolation(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	return errors.As(err, &neo4jErr) && neo4jErr.Code == "Neo.ClientError.Schema.ConstraintValidationFailed"
+}
+
+// stringsValue reads a list of strings; a missing or empty list is nil.
+func stringsValue(record *neo4j.Record, key string) []string {
+	value, _ := record.Get(key)
+	return toStrings(value)
+}
+
+func toStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	var strs []string
+	for _, item := range list {
+		if str, ok := item.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+func boolValue(record *neo4j.Record, key string) bool {
+	value, _ := record.Get(key)
+	b, _ := value.(bool)
+	return b
+}
+
+func intValue(record *neo4j.Record, key string) int64 {
+	value, _ := record.Get(key)
+	i, _ := value.(int64)
+	return i
+}
+
+// optionalString turns a nil pointer into a Cypher null.
+func optionalString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
 }
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Proposals are :Proposal nodes that hold the proposed person or
+// relationship as a JSON payload, so nothing of them shows up in queries
+// over :Person and :RELATIONSHIP until they are approved.
+
+// proposalColumns lists the columns read by proposalFromRecord for a
+// proposal bound to p.
+const proposalColumns = `p.id, p.kind, p.payload, p.status, p.author_id, p.reviewer_id, p.reason, p.created_at, p.updated_at`
+
+func (s *Store) AddProposal(ctx context.Context, proposal models.Proposal) error {
+	params, err := proposalParams(proposal)
+	if err != nil {
+		return err
+	}
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Adding proposal: id=%s, kind=%s", proposal.ID, proposal.Kind)
+
+	err = runAndConsume(ctx, session,
+		`CREATE (p:Proposal {
+			id: $id,
+			kind: $kind,
+			payload: $payload,
+			status: $status,
+			author_id: $author_id,
+			reviewer_id: $reviewer_id,
+			reason: $reason,
+			created_at: $created_at,
+			updated_at: $updated_at
+		})`,
+		params)
+	if err != nil {
+		log.Printf("Failed to add proposal: %v", err)
+		return fmt.Errorf("failed to add proposal: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetProposal(ctx context.Context, id string) (models.Proposal, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (p:Proposal {id: $id})
+		 RETURN `+proposalColumns,
+		map[string]interface{}{"id": id})
+	if err != nil {
+		return models.Proposal{}, fmt.Errorf("failed to query proposal: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return proposalFromRecord(result.Record())
+	}
+	return models.Proposal{}, store.ErrNoSuchProposal
+}
+
+func (s *Store) GetProposals(ctx context.Context, query models.ProposalQuery) ([]models.Proposal, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (p:Proposal)
+		 WHERE ($status = '' OR p.status = $status)
+		   AND ($author_id = '' OR p.author_id = $author_id)
+		 RETURN `+proposalColumns+`
+		 ORDER BY p.created_at, p.id`,
+		map[string]interface{}{"status": query.Status, "author_id": query.AuthorID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proposals: %w", err)
+	}
+
+	proposals := []models.Proposal{}
+	for result.Next(ctx) {
+		proposal, err := proposalFromRecord(result.Record())
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read proposals: %w", err)
+	}
+	return proposals, nil
+}
+
+func (s *Store) UpdateProposal(ctx context.Context, proposal models.Proposal, fromStatus string) error {
+	params, err := proposalParams(proposal)
+	if err != nil {
+		return err
+	}
+	params["from_status"] = fromStatus
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Updating proposal: id=%s, status=%s -> %s", proposal.ID, fromStatus, proposal.Status)
+
+	// Setting a throwaway property write-locks the proposal before its
+	// status is read, so concurrent updates are serialised.
+	result, err := session.Run(ctx,
+		`MATCH (p:Proposal {id: $id})
+		 SET p._lock = true
+		 REMOVE p._lock
+		 WITH p, p.status AS current
+		 FOREACH (_ IN CASE WHEN current = $from_status THEN [1] ELSE [] END |
+			SET p.kind = $kind,
+				p.payload = $payload,
+				p.status = $status,
+				p.author_id = $author_id,
+				p.reviewer_id = $reviewer_id,
+				p.reason = $reason,
+				p.updated_at = $updated_at)
+		 RETURN current`,
+		params)
+	if err != nil {
+		log.Printf("Failed to update proposal: %v", err)
+		return fmt.Errorf("failed to update proposal: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return store.ErrNoSuchProposal
+	}
+	if current := stringValue(record, "current"); current != fromStatus {
+		log.Printf("Proposal %s is %s, not %s", proposal.ID, current, fromStatus)
+		return store.ErrProposalChanged
+	}
+	return nil
+}
+
+func proposalParams(proposal models.Proposal) (map[string]interface{}, error) {
+	var payload interface{} = proposal.Person
+	if proposal.Kind == models.EntityRelationship {
+		payload = proposal.Relationship
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode proposal %s: %w", proposal.ID, err)
+	}
+
+	return map[string]interface{}{
+		"id":          proposal.ID,
+		"kind":        proposal.Kind,
+		"payload":     string(data),
+		"status":      proposal.Status,
+		"author_id":   proposal.AuthorID,
+		"reviewer_id": proposal.ReviewerID,
+		"reason":      proposal.Reason,
+		"created_at":  proposal.CreatedAt,
+		"updated_at":  proposal.UpdatedAt,
+	}, nil
+}
+
+func proposalFromRecord(record *neo4j.Record) (models.Proposal, error) {
+	proposal := models.Proposal{
+		ID:         stringValue(record, "p.id"),
+		Kind:       stringValue(record, "p.kind"),
+		Status:     stringValue(record, "p.status"),
+		AuthorID:   stringValue(record, "p.author_id"),
+		ReviewerID: stringValue(record, "p.reviewer_id"),
+		Reason:     stringValue(record, "p.reason"),
+		CreatedAt:  intValue(record, "p.created_at"),
+		UpdatedAt:  intValue(record, "p.updated_at"),
+	}
+
+	payload := []byte(stringValue(record, "p.payload"))
+	var err error
+	if proposal.Kind == models.EntityRelationship {
+		err = json.Unmarshal(payload, &proposal.Relationship)
+	} else {
+		err = json.Unmarshal(payload, &proposal.Person)
+	}
+	if err != nil {
+		return models.Proposal{}, fmt.Errorf("failed to decode proposal %s: %w", proposal.ID, err)
+	}
+	return proposal, nil
+}
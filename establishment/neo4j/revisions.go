@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// revisionColumns lists the columns read by revisionFromRecord for a
+// revision bound to v.
+const revisionColumns = `v.id, v.entity_type, v.entity_id, v.version, v.action, v.author_id, v.created_at, v.before, v.after`
+
+func (s *Store) GetRevisions(ctx context.Context, target models.EntityRef) ([]models.Revision, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (v:Revision {entity_type: $type, entity_id: $id})
+		 RETURN `+revisionColumns+`
+		 ORDER BY v.version`,
+		map[string]interface{}{"type": target.Type, "id": target.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revisions: %w", err)
+	}
+
+	revisions := []models.Revision{}
+	for result.Next(ctx) {
+		revisions = append(revisions, revisionFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+func (s *Store) GetRevision(ctx context.Context, target models.EntityRef, version int64) (models.Revision, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (v:Revision {entity_type: $type, entity_id: $id, version: $version})
+		 RETURN `+revisionColumns,
+		map[string]interface{}{"type": target.Type, "id": target.ID, "version": version})
+	if err != nil {
+		return models.Revision{}, fmt.Errorf("failed to query revision: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return revisionFromRecord(result.Record()), nil
+	}
+	return models.Revision{}, store.ErrNoSuchRevision
+}
+
+// recordRevision stores a revision of target in the same transaction as the
+// write it describes, numbered after the latest revision of target. The write
+// itself locks the entity, so concurrent writes cannot reuse a version.
+func recordRevision(ctx context.Context, tx neo4j.ManagedTransaction, target models.EntityRef, before, after interface{}) error {
+	rev, err := store.NewRevision(ctx, target, before, after)
+	if err != nil {
+		return err
+	}
+
+	return execAndConsume(ctx, tx,
+		`OPTIONAL MATCH (old:Revision {entity_type: $type, entity_id: $id})
+		 WITH coalesce(max(old.version), 0) + 1 AS version
+		 CREATE (v:Revision {
+			id: $revision_id,
+			entity_type: $type,
+			entity_id: $id,
+			version: version,
+			action: $action,
+			author_id: $author_id,
+			created_at: $created_at,
+			before: $before,
+			after: $after
+		 })`,
+		map[string]interface{}{
+			"revision_id": rev.ID,
+			"type":        target.Type,
+			"id":          target.ID,
+			"action":      rev.Action,
+			"author_id":   rev.AuthorID,
+			"created_at":  rev.CreatedAt,
+			"before":      string(rev.Before),
+			"after":       string(rev.After),
+		})
+}
+
+func revisionFromRecord(record *neo4j.Record) models.Revision {
+	rev := models.Revision{
+		ID: stringValue(record, "v.id"),
+		Entity: models.EntityRef{
+			Type: stringValue(record, "v.entity_type"),
+			ID:   stringValue(record, "v.entity_id"),
+		},
+		Version:   intValue(record, "v.version"),
+		Action:    stringValue(record, "v.action"),
+		AuthorID:  stringValue(record, "v.author_id"),
+		CreatedAt: intValue(record, "v.created_at"),
+	}
+	if before := stringValue(record, "v.before"); before != "" {
+		rev.Before = []byte(before)
+	}
+	if after := stringValue(record, "v.after"); after != "" {
+		rev.After = []byte(after)
+	}
+	return rev
+}
+
+// execAndConsume is runAndConsume for a managed transaction.
+func execAndConsume(ctx context.Context, tx neo4j.ManagedTransaction, cypher string, params map[string]interface{}) error {
+	result, err := tx.Run(ctx, cypher, params)
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume(ctx)
+	return err
+}
+
+func personRef(id string) models.EntityRef {
+	return models.EntityRef{Type: models.EntityPerson, ID: id}
+}
+
+func relationshipRef(id string) models.EntityRef {
+	return models.EntityRef{Type: models.EntityRelationship, ID: id}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/search"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// personSearchIndex is the full-text index created by migration 4. Its
+// standard-folding analyzer strips diacritics at index time; queries are
+// folded by the search package before they are sent.
+const personSearchIndex = "person_search"
+
+func (s *Store) SearchPersons(ctx context.Context, query string, limit int) ([]models.SearchResult, error) {
+	lucene := search.LuceneQuery(query)
+	if lucene == "" {
+		return []models.SearchResult{}, nil
+	}
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	log.Printf("Searching persons: q=%q, lucene=%q", query, lucene)
+
+	result, err := session.Run(ctx,
+		`CALL db.index.fulltext.queryNodes($index, $query) YIELD node AS p, score
+		 RETURN `+personColumns+`, score
+		 ORDER BY score DESC
+		 LIMIT $limit`,
+		map[string]interface{}{
+			"index": personSearchIndex,
+			"query": lucene,
+			"limit": limit,
+		})
+	if err != nil {
+		log.Printf("Failed to search persons: %v", err)
+		return nil, fmt.Errorf("failed to search persons: %w", err)
+	}
+
+	results := []models.SearchResult{}
+	for result.Next(ctx) {
+		score, _ := result.Record().Get("score")
+		value, _ := score.(float64)
+		results = append(results, models.SearchResult{Person: personFromRecord(result.Record()), Score: value})
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search results: %w", err)
+	}
+
+	log.Printf("Returning %d search results for %q", len(results), query)
+	return results, nil
+}
+
+func (s *Store) SuggestPersons(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error) {
+	lucene := search.LucenePrefixQuery("name", prefix)
+	if lucene == "" {
+		return []models.Suggestion{}, nil
+	}
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`CALL db.index.fulltext.queryNodes($index, $query) YIELD node AS p, score
+		 RETURN p.id, p.name, p.occupation
+		 ORDER BY score DESC, p.name
+		 LIMIT $limit`,
+		map[string]interface{}{
+			"index": personSearchIndex,
+			"query": lucene,
+			"limit": limit,
+		})
+	if err != nil {
+		log.Printf("Failed to suggest persons: %v", err)
+		return nil, fmt.Errorf("failed to suggest persons: %w", err)
+	}
+
+	suggestions := []models.Suggestion{}
+	for result.Next(ctx) {
+		suggestions = append(suggestions, models.Suggestion{
+			ID:         stringValue(result.Record(), "p.id"),
+			Name:       stringValue(result.Record(), "p.name"),
+			Occupation: stringValue(result.Record(), "p.occupation"),
+		})
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read suggestions: %w", err)
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// sessionColumns lists the columns read by sessionFromRecord for a session
+// bound to s. Sessions keep the camelCase property names they were first
+// stored with.
+const sessionColumns = `s.id, s.userId, s.expiresAt, s.createdAt, s.lastSeenAt, s.userAgent, s.ip`
+
+func (s *Store) CreateSession(ctx context.Context, session models.Session) error {
+	neo4jSession := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer neo4jSession.Close(ctx)
+
+	err := runAndConsume(ctx, neo4jSession,
+		`CREATE (s:Session {
+			id: $id,
+			userId: $userId,
+			expiresAt: $expiresAt,
+			createdAt: $createdAt,
+			lastSeenAt: $lastSeenAt,
+			userAgent: $userAgent,
+			ip: $ip
+		})`,
+		map[string]interface{}{
+			"id":         session.ID,
+			"userId":     session.UserID,
+			"expiresAt":  session.ExpiresAt,
+			"createdAt":  session.CreatedAt,
+			"lastSeenAt": session.LastSeenAt,
+			"userAgent":  session.UserAgent,
+			"ip":         session.IP,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Session {id: $id})
+		 RETURN `+sessionColumns,
+		map[string]interface{}{"id": sessionID})
+	if err != nil {
+		return models.Session{}, fmt.Errorf("failed to query session: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return sessionFromRecord(result.Record()), nil
+	}
+
+	return models.Session{}, store.ErrNoSuchSession
+}
+
+func (s *Store) GetUserSessions(ctx context.Context, userID string, now int64) ([]models.Session, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Session {userId: $userId})
+		 WHERE s.expiresAt > $now
+		 RETURN `+sessionColumns+`
+		 ORDER BY coalesce(s.lastSeenAt, 0) DESC, s.id`,
+		map[string]interface{}{"userId": userID, "now": now})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+
+	sessions := []models.Session{}
+	for result.Next(ctx) {
+		sessions = append(sessions, sessionFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (s *Store) TouchSession(ctx context.Context, sessionID string, lastSeenAt, expiresAt int64) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Session {id: $id})
+		 SET s.lastSeenAt = $lastSeenAt, s.expiresAt = $expiresAt
+		 RETURN s.id`,
+		map[string]interface{}{"id": sessionID, "lastSeenAt": lastSeenAt, "expiresAt": expiresAt})
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	if !result.Next(ctx) {
+		return store.ErrNoSuchSession
+	}
+	return nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, sessionID string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.Run(ctx,
+		`MATCH (s:Session {id: $id})
+		 DELETE s`,
+		map[string]interface{}{"id": sessionID})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteUserSessions(ctx context.Context, userID, exceptID string) (int64, error) {
+	return s.deleteSessions(ctx,
+		`MATCH (s:Session {userId: $userId})
+		 WHERE s.id <> $exceptId`,
+		map[string]interface{}{"userId": userID, "exceptId": exceptID})
+}
+
+func (s *Store) DeleteExpiredSessions(ctx context.Context, now int64) (int64, error) {
+	return s.deleteSessions(ctx,
+		`MATCH (s:Session)
+		 WHERE s.expiresAt < $now`,
+		map[string]interface{}{"now": now})
+}
+
+// deleteSessions deletes the sessions bound to s by match and returns how
+// many there were.
+func (s *Store) deleteSessions(ctx context.Context, match string, params map[string]interface{}) (int64, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, match+`
+		 DELETE s
+		 RETURN count(*) AS deleted`,
+		params)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return intValue(record, "deleted"), nil
+}
+
+// sessionFromRecord builds a Session from a record with the sessionColumns.
+// Sessions created before activity was recorded have zero values for it.
+func sessionFromRecord(record *neo4j.Record) models.Session {
+	return models.Session{
+		ID:         stringValue(record, "s.id"),
+		UserID:     stringValue(record, "s.userId"),
+		ExpiresAt:  intValue(record, "s.expiresAt"),
+		CreatedAt:  intValue(record, "s.createdAt"),
+		LastSeenAt: intValue(record, "s.lastSeenAt"),
+		UserAgent:  stringValue(record, "s.userAgent"),
+		IP:         stringValue(record, "s.ip"),
+	}
+}
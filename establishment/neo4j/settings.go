@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"establishment/v1/establishment/models"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// The settings are kept as properties of a single :Settings node.
+const settingsID = "global"
+
+func (s *Store) GetSettings(ctx context.Context) (models.Settings, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Settings {id: $id})
+		 RETURN s.require_2fa_for_editors`,
+		map[string]interface{}{"id": settingsID})
+	if err != nil {
+		return models.Settings{}, fmt.Errorf("failed to query settings: %w", err)
+	}
+
+	var settings models.Settings
+	if result.Next(ctx) {
+		settings.Require2FAForEditors = boolValue(result.Record(), "s.require_2fa_for_editors")
+	}
+	if err := result.Err(); err != nil {
+		return models.Settings{}, fmt.Errorf("failed to read settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (s *Store) SaveSettings(ctx context.Context, settings models.Settings) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	err := runAndConsume(ctx, session,
+		`MERGE (s:Settings {id: $id})
+		 SET s.require_2fa_for_editors = $require_2fa_for_editors`,
+		map[string]interface{}{
+			"id":                      settingsID,
+			"require_2fa_for_editors": settings.Require2FAForEditors,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Sources are :Source nodes. Persons and relationships cite them through a
+// source_ids list property, since relationships cannot point at nodes.
+
+// sourceColumns lists the columns read by sourceFromRecord for a source
+// bound to s.
+const sourceColumns = `s.id, s.url, s.title, s.publisher, s.accessed_at, s.archive_url, s.created_at`
+
+// citingPatterns matches the entity of each models.EntityRef type as t.
+var citingPatterns = map[string]string{
+	models.EntityPerson:       `(t:Person {id: $id})`,
+	models.EntityRelationship: `()-[t:RELATIONSHIP {id: $id}]->()`,
+}
+
+func (s *Store) AddSource(ctx context.Context, source models.Source) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Adding source: id=%s, url=%s", source.ID, source.URL)
+
+	err := runAndConsume(ctx, session,
+		`CREATE (s:Source {
+			id: $id,
+			url: $url,
+			title: $title,
+			publisher: $publisher,
+			accessed_at: $accessed_at,
+			archive_url: $archive_url,
+			created_at: $created_at
+		})`,
+		map[string]interface{}{
+			"id":          source.ID,
+			"url":         source.URL,
+			"title":       source.Title,
+			"publisher":   source.Publisher,
+			"accessed_at": source.AccessedAt,
+			"archive_url": source.ArchiveURL,
+			"created_at":  source.CreatedAt,
+		})
+	if err != nil {
+		log.Printf("Failed to add source: %v", err)
+		return fmt.Errorf("failed to add source: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetSource(ctx context.Context, id string) (models.Source, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Source {id: $id})
+		 RETURN `+sourceColumns,
+		map[string]interface{}{"id": id})
+	if err != nil {
+		return models.Source{}, fmt.Errorf("failed to query source: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return sourceFromRecord(result.Record()), nil
+	}
+	return models.Source{}, store.ErrNoSuchSource
+}
+
+func (s *Store) GetSources(ctx context.Context) ([]models.Source, error) {
+	return s.querySources(ctx,
+		`MATCH (s:Source)
+		 RETURN `+sourceColumns+`
+		 ORDER BY s.title, s.id`,
+		nil)
+}
+
+func (s *Store) GetSourcesByIDs(ctx context.Context, ids []string) ([]models.Source, error) {
+	if len(ids) == 0 {
+		return []models.Source{}, nil
+	}
+	return s.querySources(ctx,
+		`MATCH (s:Source)
+		 WHERE s.id IN $ids
+		 RETURN `+sourceColumns+`
+		 ORDER BY s.title, s.id`,
+		map[string]interface{}{"ids": ids})
+}
+
+func (s *Store) querySources(ctx context.Context, cypher string, params map[string]interface{}) ([]models.Source, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, cypher, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sources: %w", err)
+	}
+
+	sources := []models.Source{}
+	for result.Next(ctx) {
+		sources = append(sources, sourceFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sources: %w", err)
+	}
+	return sources, nil
+}
+
+func (s *Store) UpdateSource(ctx context.Context, id string, update models.SourceUpdate) (models.Source, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Updating source: id=%s", id)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Source {id: $id})
+		 SET s.url = coalesce($url, s.url),
+			 s.title = coalesce($title, s.title),
+			 s.publisher = coalesce($publisher, s.publisher),
+			 s.accessed_at = coalesce($accessed_at, s.accessed_at),
+			 s.archive_url = coalesce($archive_url, s.archive_url)
+		 RETURN `+sourceColumns,
+		map[string]interface{}{
+			"id":          id,
+			"url":         optionalString(update.URL),
+			"title":       optionalString(update.Title),
+			"publisher":   optionalString(update.Publisher),
+			"accessed_at": optionalString(update.AccessedAt),
+			"archive_url": optionalString(update.ArchiveURL),
+		})
+	if err != nil {
+		log.Printf("Failed to update source: %v", err)
+		return models.Source{}, fmt.Errorf("failed to update source: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return sourceFromRecord(result.Record()), nil
+	}
+	return models.Source{}, store.ErrNoSuchSource
+}
+
+func (s *Store) DeleteSource(ctx context.Context, id string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Deleting source: id=%s", id)
+
+	result, err := session.Run(ctx,
+		`MATCH (s:Source {id: $id})
+		 OPTIONAL MATCH (p:Person) WHERE $id IN p.source_ids
+		 WITH s, count(p) AS persons
+		 OPTIONAL MATCH ()-[r:RELATIONSHIP]->() WHERE $id IN r.source_ids
+		 WITH s, persons + count(r) AS citations
+		 FOREACH (_ IN CASE WHEN citations = 0 THEN [1] ELSE [] END | DELETE s)
+		 RETURN citations`,
+		map[string]interface{}{"id": id})
+	if err != nil {
+		log.Printf("Failed to delete source: %v", err)
+		return fmt.Errorf("failed to delete source: %w", err)
+	}
+
+	if !result.Next(ctx) {
+		return store.ErrNoSuchSource
+	}
+	if citations := intValue(result.Record(), "citations"); citations > 0 {
+		log.Printf("Not deleting source %s cited %d times", id, citations)
+		return store.ErrSourceInUse
+	}
+	return nil
+}
+
+func (s *Store) CiteSource(ctx context.Context, target models.EntityRef, sourceID string) error {
+	return s.updateCitation(ctx, target, sourceID,
+		`FOREACH (_ IN CASE WHEN t IS NOT NULL AND s IS NOT NULL
+		                    AND NOT $source_id IN coalesce(t.source_ids, []) THEN [1] ELSE [] END |
+			SET t.source_ids = coalesce(t.source_ids, []) + $source_id)`)
+}
+
+func (s *Store) UnciteSource(ctx context.Context, target models.EntityRef, sourceID string) error {
+	return s.updateCitation(ctx, target, sourceID,
+		`FOREACH (_ IN CASE WHEN t IS NOT NULL THEN [1] ELSE [] END |
+			SET t.source_ids = [x IN coalesce(t.source_ids, []) WHERE x <> $source_id])`)
+}
+
+// citingProjections snapshot the entity matched by citingPatterns for its
+// revision history. The relationship one needs t to also be bound to r.
+var citingProjections = map[string]string{
+	models.EntityPerson:       `t {` + personProjection + `}`,
+	models.EntityRelationship: `r {` + relationshipProjection + `}`,
+}
+
+// updateCitation runs change against the target bound to t and the source
+// bound to s, then maps missing entities to the matching store errors.
+func (s *Store) updateCitation(ctx context.Context, target models.EntityRef, sourceID, change string) error {
+	pattern, ok := citingPatterns[target.Type]
+	if !ok {
+		return fmt.Errorf("cannot cite sources from %q", target.Type)
+	}
+	projection := citingProjections[target.Type]
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+		result, err := tx.Run(ctx,
+			`OPTIONAL MATCH `+pattern+`
+			 OPTIONAL MATCH (s:Source {id: $source_id})
+			 WITH t, t AS r, s
+			 WITH t, r, s, `+projection+` AS before
+			 `+change+`
+			 RETURN t IS NOT NULL AS has_target, s IS NOT NULL AS has_source, before, `+projection+` AS after`,
+			map[string]interface{}{"id": target.ID, "source_id": sourceID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasTarget, _ := record.Get("has_target"); hasTarget != true {
+			if target.Type == models.EntityPerson {
+				return nil, store.ErrNoSuchPerson
+			}
+			return nil, store.ErrNoSuchRelationship
+		}
+		if hasSource, _ := record.Get("has_source"); hasSource != true {
+			return nil, store.ErrNoSuchSource
+		}
+
+		before, _ := record.Get("before")
+		after, _ := record.Get("after")
+		if target.Type == models.EntityPerson {
+			return nil, recordRevision(ctx, tx, target, personFromMap(before), personFromMap(after))
+		}
+		return nil, recordRevision(ctx, tx, target, relationshipFromMap(before), relationshipFromMap(after))
+	})
+	for _, sentinel := range []error{store.ErrNoSuchPerson, store.ErrNoSuchRelationship, store.ErrNoSuchSource} {
+		if errors.Is(err, sentinel) {
+			return sentinel
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update citation: %w", err)
+	}
+	log.Printf("Updated citation of source %s by %s %s", sourceID, target.Type, target.ID)
+	return nil
+}
+
+func (s *Store) GetCitations(ctx context.Context, sourceID string) (models.Citations, error) {
+	if _, err := s.GetSource(ctx, sourceID); err != nil {
+		return models.Citations{}, err
+	}
+
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	citations := models.Citations{Persons: []models.Person{}, Relationships: []models.Relationship{}}
+
+	result, err := session.Run(ctx,
+		`MATCH (p:Person)
+		 WHERE $id IN p.source_ids
+		 RETURN `+personColumns+`
+		 ORDER BY p.id`,
+		map[string]interface{}{"id": sourceID})
+	if err != nil {
+		return models.Citations{}, fmt.Errorf("failed to query citing persons: %w", err)
+	}
+	for result.Next(ctx) {
+		citations.Persons = append(citations.Persons, personFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return models.Citations{}, fmt.Errorf("failed to read citing persons: %w", err)
+	}
+
+	result, err = session.Run(ctx,
+		`MATCH (a:Person)-[r:RELATIONSHIP]->(b:Person)
+		 WHERE $id IN r.source_ids
+		 RETURN `+relationshipColumns,
+		map[string]interface{}{"id": sourceID})
+	if err != nil {
+		return models.Citations{}, fmt.Errorf("failed to query citing relationships: %w", err)
+	}
+	for result.Next(ctx) {
+		citations.Relationships = append(citations.Relationships, relationshipFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return models.Citations{}, fmt.Errorf("failed to read citing relationships: %w", err)
+	}
+
+	log.Printf("Source %s is cited by %d persons and %d relationships", sourceID, len(citations.Persons), len(citations.Relationships))
+	return citations, nil
+}
+
+func sourceFromRecord(record *neo4j.Record) models.Source {
+	return models.Source{
+		ID:         stringValue(record, "s.id"),
+		URL:        stringValue(record, "s.url"),
+		Title:      stringValue(record, "s.title"),
+		Publisher:  stringValue(record, "s.publisher"),
+		AccessedAt: stringValue(record, "s.accessed_at"),
+		ArchiveURL: stringValue(record, "s.archive_url"),
+		CreatedAt:  intValue(record, "s.created_at"),
+	}
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// tokenColumns lists the columns read by tokenFromRecord for a token bound
+// to t.
+const tokenColumns = `t.id, t.user_id, t.name, t.scopes, t.hash, t.created_at, t.expires_at, t.last_used_at`
+
+func (s *Store) AddToken(ctx context.Context, token models.APIToken) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Adding API token: id=%s, user_id=%s, name=%s", token.ID, token.UserID, token.Name)
+
+	err := runAndConsume(ctx, session,
+		`CREATE (t:APIToken {
+			id: $id,
+			user_id: $user_id,
+			name: $name,
+			scopes: $scopes,
+			hash: $hash,
+			created_at: $created_at,
+			expires_at: $expires_at,
+			last_used_at: 0
+		})`,
+		map[string]interface{}{
+			"id":         token.ID,
+			"user_id":    token.UserID,
+			"name":       token.Name,
+			"scopes":     stringList(token.Scopes),
+			"hash":       token.Hash,
+			"created_at": token.CreatedAt,
+			"expires_at": token.ExpiresAt,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to add token: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetTokenByHash(ctx context.Context, hash string) (models.APIToken, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (t:APIToken {hash: $hash})
+		 RETURN `+tokenColumns,
+		map[string]interface{}{"hash": hash})
+	if err != nil {
+		return models.APIToken{}, fmt.Errorf("failed to query token: %w", err)
+	}
+
+	if result.Next(ctx) {
+		return tokenFromRecord(result.Record()), nil
+	}
+	return models.APIToken{}, store.ErrNoSuchToken
+}
+
+func (s *Store) GetTokens(ctx context.Context, userID string) ([]models.APIToken, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (t:APIToken {user_id: $user_id})
+		 RETURN `+tokenColumns+`
+		 ORDER BY t.created_at DESC, t.id`,
+		map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+
+	tokens := []models.APIToken{}
+	for result.Next(ctx) {
+		tokens = append(tokens, tokenFromRecord(result.Record()))
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s *Store) TouchToken(ctx context.Context, id string, usedAt int64) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (t:APIToken {id: $id})
+		 SET t.last_used_at = $used_at
+		 RETURN t.id`,
+		map[string]interface{}{"id": id, "used_at": usedAt})
+	if err != nil {
+		return fmt.Errorf("failed to touch token: %w", err)
+	}
+	if !result.Next(ctx) {
+		return store.ErrNoSuchToken
+	}
+	return nil
+}
+
+func (s *Store) DeleteToken(ctx context.Context, userID, id string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	log.Printf("Revoking API token: id=%s, user_id=%s", id, userID)
+
+	result, err := session.Run(ctx,
+		`MATCH (t:APIToken {id: $id, user_id: $user_id})
+		 WITH t, t.id AS id
+		 DELETE t
+		 RETURN id`,
+		map[string]interface{}{"id": id, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if !result.Next(ctx) {
+		return store.ErrNoSuchToken
+	}
+	return nil
+}
+
+func tokenFromRecord(record *neo4j.Record) models.APIToken {
+	return models.APIToken{
+		ID:         stringValue(record, "t.id"),
+		UserID:     stringValue(record, "t.user_id"),
+		Name:       stringValue(record, "t.name"),
+		Scopes:     stringsValue(record, "t.scopes"),
+		Hash:       stringValue(record, "t.hash"),
+		CreatedAt:  intValue(record, "t.created_at"),
+		ExpiresAt:  intValue(record, "t.expires_at"),
+		LastUsedAt: intValue(record, "t.last_used_at"),
+	}
+}
+
+func (s *Store) AddOneTimeToken(ctx context.Context, token models.OneTimeToken) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	err := runAndConsume(ctx, session,
+		`CREATE (t:OneTimeToken {
+			hash: $hash,
+			user_id: $user_id,
+			purpose: $purpose,
+			created_at: $created_at,
+			expires_at: $expires_at
+		})`,
+		map[string]interface{}{
+			"hash":       token.Hash,
+			"user_id":    token.UserID,
+			"purpose":    token.Purpose,
+			"created_at": token.CreatedAt,
+			"expires_at": token.ExpiresAt,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to add one-time token: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UseOneTimeToken(ctx context.Context, hash, purpose string, now int64) (models.OneTimeToken, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	// The lock makes a concurrent use of the same token wait for this one
+	// and then fail, since the node is gone by then.
+	result, err := session.Run(ctx,
+		`MATCH (t:OneTimeToken {hash: $hash, purpose: $purpose})
+		 SET t._lock = true
+		 WITH t, t.hash AS hash, t.user_id AS user_id, t.purpose AS purpose,
+		      t.created_at AS created_at, t.expires_at AS expires_at
+		 DELETE t
+		 RETURN hash, user_id, purpose, created_at, expires_at`,
+		map[string]interface{}{"hash": hash, "purpose": purpose})
+	if err != nil {
+		return models.OneTimeToken{}, fmt.Errorf("failed to use one-time token: %w", err)
+	}
+
+	if !result.Next(ctx) {
+		if err := result.Err(); err != nil {
+			return models.OneTimeToken{}, fmt.Errorf("failed to use one-time token: %w", err)
+		}
+		return models.OneTimeToken{}, store.ErrNoSuchOneTimeToken
+	}
+	record := result.Record()
+	token := models.OneTimeToken{
+		Hash:      stringValue(record, "hash"),
+		UserID:    stringValue(record, "user_id"),
+		Purpose:   stringValue(record, "purpose"),
+		CreatedAt: intValue(record, "created_at"),
+		ExpiresAt: intValue(record, "expires_at"),
+	}
+	if _, err := result.Consume(ctx); err != nil {
+		return models.OneTimeToken{}, fmt.Errorf("failed to use one-time token: %w", err)
+	}
+	if token.ExpiresAt < now {
+		return models.OneTimeToken{}, store.ErrNoSuchOneTimeToken
+	}
+	return token, nil
+}
+
+func (s *Store) DeleteOneTimeTokens(ctx context.Context, userID, purpose string) error {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	err := runAndConsume(ctx, session,
+		`MATCH (t:OneTimeToken {user_id: $user_id, purpose: $purpose})
+		 DELETE t`,
+		map[string]interface{}{"user_id": userID, "purpose": purpose})
+	if err != nil {
+		return fmt.Errorf("failed to delete one-time tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeleteExpiredOneTimeTokens(ctx context.Context, now int64) (int64, error) {
+	session := s.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx,
+		`MATCH (t:OneTimeToken)
+		 WHERE t.expires_at < $now
+		 DELETE t
+		 RETURN count(*) AS deleted`,
+		map[string]interface{}{"now": now})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired one-time tokens: %w", err)
+	}
+
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired one-time tokens: %w", err)
+	}
+	return intValue(record, "deleted"), nil
+}
@@ -0,0 +1,312 @@
+// Package oidc signs users in with an OpenID Connect provider using the
+// authorization code flow with PKCE (RFC 7636). ID tokens must be signed
+// with RS256, the algorithm every provider supports.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway tolerates clock differences with the provider.
+const leeway = time.Minute
+
+// Claims are the parts of an ID token used to find or create the user.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Nonce             string `json:"nonce"`
+}
+
+// Provider is a configured OpenID Connect provider. Its endpoints and keys
+// are discovered on first use, so the provider need not be reachable when
+// the server starts.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Client       *http.Client
+
+	mu     sync.Mutex
+	config *discovery
+	keys   map[string]*rsa.PublicKey
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// AuthCodeURL returns the provider URL to send the browser to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", Challenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return config.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the claims of the
+// verified ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		return Claims{}, fmt.Errorf("token request failed: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, errors.New("token response has no id_token")
+	}
+
+	claims, err := p.verify(ctx, tokens.IDToken, time.Now())
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// verify checks the signature, issuer, audience and lifetime of an ID token.
+func (p *Provider) verify(ctx context.Context, idToken string, now time.Time) (Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("malformed ID token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return Claims{}, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("malformed ID token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return Claims{}, errors.New("invalid ID token signature")
+	}
+
+	var claims struct {
+		Claims
+		Audience  audience `json:"aud"`
+		ExpiresAt int64    `json:"exp"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+	switch {
+	case claims.Issuer != p.Issuer:
+		return Claims{}, fmt.Errorf("ID token issued by %q", claims.Issuer)
+	case !claims.Audience.contains(p.ClientID):
+		return Claims{}, errors.New("ID token is not meant for this client")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)):
+		return Claims{}, errors.New("ID token expired")
+	case claims.Subject == "":
+		return Claims{}, errors.New("ID token has no subject")
+	}
+	return claims.Claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var config discovery
+	if err := p.do(req, &config); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if config.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", config.Issuer)
+	}
+	p.config = &config
+	return p.config, nil
+}
+
+// key returns the signing key with the given ID, refetching the key set
+// when it is unknown in case the provider rotated its keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// audience is the aud claim, which may be a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// RandomString returns a random URL-safe string for states, nonces and
+// PKCE verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 PKCE code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
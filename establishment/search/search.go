@@ -0,0 +1,142 @@
+// Package search holds the text handling shared by the person search
+// implementations: diacritic folding, tokenizing, fuzzy matching and the
+// construction of Lucene queries for the Neo4j full-text index.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// folds maps lowercase letters with diacritics to their ASCII base. It covers
+// Polish completely and the rest of Latin-1 and Latin Extended-A.
+var folds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+	'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j",
+	'ķ': "k",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r",
+	'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w",
+	'ý': "y", 'ÿ': "y", 'ŷ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// Fold lowercases s and replaces letters with diacritics by their ASCII
+// base, so that "Wałęsa" and "walesa" compare equal.
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := folds[r]; ok {
+			b.WriteString(folded)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Tokenize folds s and splits it into words of letters and digits.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// MaxEdits is the number of typos tolerated in a term, growing with its
+// length so that short words do not match everything.
+func MaxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance returns the Levenshtein edit distance between a and b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// Match scores how well a query term matches a word: 1 for an exact match,
+// 0.8 for a prefix, 0.5 for a match within MaxEdits typos and 0 otherwise.
+// Both arguments must already be folded.
+func Match(term, word string) float64 {
+	switch {
+	case term == word:
+		return 1
+	case len(term) >= 2 && strings.HasPrefix(word, term):
+		return 0.8
+	case Distance(term, word) <= MaxEdits(term):
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// LuceneQuery builds a typo-tolerant full-text query from user input. Each
+// term matches exactly (boosted) or fuzzily, and results matching any term
+// are returned. It returns "" if q contains no searchable terms.
+func LuceneQuery(q string) string {
+	var clauses []string
+	for _, term := range Tokenize(q) {
+		clause := term + "^3"
+		if edits := MaxEdits(term); edits > 0 {
+			clause = "(" + clause + " OR " + term + "~" + string(rune('0'+edits)) + ")"
+		}
+		clauses = append(clauses, clause)
+	}
+	return strings.Join(clauses, " ")
+}
+
+// LucenePrefixQuery builds an autocomplete query against field: every term
+// must match the start of a word, and all but the last may also contain a
+// typo.
+func LucenePrefixQuery(field, q string) string {
+	terms := Tokenize(q)
+	if len(terms) == 0 {
+		return ""
+	}
+	clauses := make([]string, 0, len(terms))
+	for i, term := range terms {
+		clause := "(" + term + " OR " + term + "*)"
+		if edits := MaxEdits(term); i < len(terms)-1 && edits > 0 {
+			clause = "(" + term + "* OR " + term + "~1)"
+		}
+		clauses = append(clauses, "+"+field+":"+clause)
+	}
+	return strings.Join(clauses, " ")
+}
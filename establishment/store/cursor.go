@@ -0,0 +1,43 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"establishment/v1/establishment/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PersonCursor marks the last person of a page: the value of the sort key
+// and the ID used to break ties between equal keys.
+type PersonCursor struct {
+	Name      string `json:"n,omitempty"`
+	CreatedAt int64  `json:"c,omitempty"`
+	ID        string `json:"i"`
+}
+
+// EncodeCursor returns the opaque form of c handed out to API clients.
+func EncodeCursor(c PersonCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor.
+func DecodeCursor(s string) (PersonCursor, error) {
+	var c PersonCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return PersonCursor{}, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return PersonCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// CursorFor returns the cursor pointing just after person.
+func CursorFor(person models.Person) PersonCursor {
+	return PersonCursor{Name: person.Name, CreatedAt: person.CreatedAt, ID: person.ID}
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"github.com/google/uuid"
+)
+
+type authorKey struct{}
+
+// WithAuthor returns a copy of ctx whose writes are attributed to the user
+// with the given ID in the revision history.
+func WithAuthor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, authorKey{}, userID)
+}
+
+// AuthorFrom returns the user ID set by WithAuthor, or "" for writes made
+// outside of an authenticated request.
+func AuthorFrom(ctx context.Context) string {
+	userID, _ := ctx.Value(authorKey{}).(string)
+	return userID
+}
+
+// NewRevision records a write to target by the author in ctx. before must be
+// nil for creations and after for deletions; the action follows from that.
+// Backends assign the Version when storing the revision.
+func NewRevision(ctx context.Context, target models.EntityRef, before, after interface{}) (models.Revision, error) {
+	rev := models.Revision{
+		ID:        uuid.New().String(),
+		Entity:    target,
+		Action:    models.ActionUpdate,
+		AuthorID:  AuthorFrom(ctx),
+		CreatedAt: time.Now().Unix(),
+	}
+	var err error
+	if before == nil {
+		rev.Action = models.ActionCreate
+	} else if rev.Before, err = json.Marshal(before); err != nil {
+		return models.Revision{}, fmt.Errorf("failed to snapshot %s %s: %w", target.Type, target.ID, err)
+	}
+	if after == nil {
+		rev.Action = models.ActionDelete
+	} else if rev.After, err = json.Marshal(after); err != nil {
+		return models.Revision{}, fmt.Errorf("failed to snapshot %s %s: %w", target.Type, target.ID, err)
+	}
+	return rev, nil
+}
@@ -0,0 +1,268 @@
+// Package store defines the persistence interface used by the HTTP handlers.
+// The neo4j package provides the production implementation and the memory
+// package an in-process one that needs no database.
+package store
+
+import (
+	"context"
+	"errors"
+
+	"establishment/v1/establishment/models"
+)
+
+var (
+	ErrNoSuchPerson        = errors.New("no such person")
+	ErrPersonExists        = errors.New("person already exists")
+	ErrNoSuchUser          = errors.New("no such user")
+	ErrUserExists          = errors.New("user already exists")
+	ErrNoSuchSession       = errors.New("no such session")
+	ErrInvalidRelationship = errors.New("source and target IDs must be different")
+	ErrNoSuchSource        = errors.New("no such source")
+	ErrSourceInUse         = errors.New("source is still cited")
+	ErrPersonsNotFound     = errors.New("one or both persons not found")
+	ErrNoSuchRelationship  = errors.New("no such relationship")
+	ErrNoSuchRevision      = errors.New("no such revision")
+	ErrNoSuchProposal      = errors.New("no such proposal")
+	ErrProposalChanged     = errors.New("proposal was changed by someone else")
+	ErrNoSuchToken         = errors.New("no such token")
+	ErrNoSuchOneTimeToken  = errors.New("invalid or expired token")
+	ErrCodeUsed            = errors.New("code already used")
+)
+
+const (
+	// MaxTraversalDepth bounds variable-length graph traversals.
+	MaxTraversalDepth = 10
+	// MaxPaths bounds the number of paths returned by ShortestPaths.
+	MaxPaths = 100
+)
+
+type PersonStore interface {
+	AddPerson(ctx context.Context, person models.Person) error
+	GetPerson(ctx context.Context, id string) (models.Person, error)
+	GetPersons(ctx context.Context) ([]models.Person, error)
+	// GetPersonsByIDs returns the persons with the given IDs, skipping
+	// unknown ones.
+	GetPersonsByIDs(ctx context.Context, ids []string) ([]models.Person, error)
+	// ListPersons returns one page of persons matching query. It returns
+	// ErrInvalidCursor if query.Cursor cannot be decoded.
+	ListPersons(ctx context.Context, query models.PersonQuery) (models.PersonPage, error)
+	UpdatePerson(ctx context.Context, id string, update models.PersonUpdate) (models.Person, error)
+	// DeletePerson removes the person together with all of its relationships.
+	DeletePerson(ctx context.Context, id string) error
+	// SearchPersons matches query against name, occupation and description,
+	// tolerating typos and ignoring diacritics, best matches first.
+	SearchPersons(ctx context.Context, query string, limit int) ([]models.SearchResult, error)
+	// SuggestPersons returns persons whose name starts with the words in
+	// prefix, for autocomplete.
+	SuggestPersons(ctx context.Context, prefix string, limit int) ([]models.Suggestion, error)
+}
+
+type RelationshipStore interface {
+	// AddRelationship stores rel under rel.ID, which the caller must set.
+	AddRelationship(ctx context.Context, rel models.Relationship) error
+	GetRelationship(ctx context.Context, id string) (models.Relationship, error)
+	// GetRelationshipsByIDs returns the relationships with the given IDs,
+	// skipping unknown ones.
+	GetRelationshipsByIDs(ctx context.Context, ids []string) ([]models.Relationship, error)
+	UpdateRelationship(ctx context.Context, id string, update models.RelationshipUpdate) (models.Relationship, error)
+	DeleteRelationship(ctx context.Context, id string) error
+	// GetPersonRelationships returns the relationships starting or ending at
+	// the given person.
+	GetPersonRelationships(ctx context.Context, personID string) ([]models.Relationship, error)
+}
+
+type GraphStore interface {
+	GetGraph(ctx context.Context, filter models.GraphFilter) (models.Graph, error)
+	// ShortestPaths finds the shortest path(s) between query.From and
+	// query.To. It returns ErrNoSuchPerson if either end does not exist and
+	// an empty result if they are not connected within query.MaxDepth hops.
+	ShortestPaths(ctx context.Context, query models.PathQuery) (models.PathResult, error)
+	// GetNetwork returns the person from query.PersonID together with every
+	// person and relationship reached within query.Depth hops. It returns
+	// ErrNoSuchPerson if the person does not exist.
+	GetNetwork(ctx context.Context, query models.NetworkQuery) (models.Graph, error)
+}
+
+type SourceStore interface {
+	// AddSource stores source under source.ID, which the caller must set.
+	AddSource(ctx context.Context, source models.Source) error
+	GetSource(ctx context.Context, id string) (models.Source, error)
+	GetSources(ctx context.Context) ([]models.Source, error)
+	// GetSourcesByIDs returns the sources with the given IDs, skipping
+	// unknown ones.
+	GetSourcesByIDs(ctx context.Context, ids []string) ([]models.Source, error)
+	UpdateSource(ctx context.Context, id string, update models.SourceUpdate) (models.Source, error)
+	// DeleteSource returns ErrSourceInUse while any fact still cites it.
+	DeleteSource(ctx context.Context, id string) error
+	// CiteSource attaches a source to a person or relationship; citing a
+	// source twice has no effect. UnciteSource detaches it again.
+	CiteSource(ctx context.Context, target models.EntityRef, sourceID string) error
+	UnciteSource(ctx context.Context, target models.EntityRef, sourceID string) error
+	// GetCitations returns every person and relationship citing the source.
+	GetCitations(ctx context.Context, sourceID string) (models.Citations, error)
+}
+
+// RevisionStore reads the history written by every change to persons and
+// relationships, including citations. The history outlives the entity, so a
+// deleted person still has one.
+type RevisionStore interface {
+	// GetRevisions returns the revisions of target, oldest first.
+	GetRevisions(ctx context.Context, target models.EntityRef) ([]models.Revision, error)
+	GetRevision(ctx context.Context, target models.EntityRef, version int64) (models.Revision, error)
+}
+
+// ProposalStore keeps contributions awaiting moderation apart from the
+// public data.
+type ProposalStore interface {
+	// AddProposal stores proposal under proposal.ID, which the caller must set.
+	AddProposal(ctx context.Context, proposal models.Proposal) error
+	GetProposal(ctx context.Context, id string) (models.Proposal, error)
+	// GetProposals returns the proposals matching query, oldest first.
+	GetProposals(ctx context.Context, query models.ProposalQuery) ([]models.Proposal, error)
+	// UpdateProposal replaces the stored proposal with the same ID provided
+	// its status is still fromStatus, and returns ErrProposalChanged
+	// otherwise, so that two moderators cannot both act on one proposal.
+	UpdateProposal(ctx context.Context, proposal models.Proposal, fromStatus string) error
+}
+
+type UserStore interface {
+	AddUser(ctx context.Context, user models.User) error
+	GetUserByLogin(ctx context.Context, login string) (models.User, error)
+	GetUserByID(ctx context.Context, id string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	GetUserByOIDCIdentity(ctx context.Context, identity string) (models.User, error)
+	// GetUsers returns all users ordered by login.
+	GetUsers(ctx context.Context) ([]models.User, error)
+	// GrantRole adds role to the user's roles; granting a held role has no
+	// effect. RevokeRole removes it again.
+	GrantRole(ctx context.Context, userID, role string) (models.User, error)
+	RevokeRole(ctx context.Context, userID, role string) (models.User, error)
+	// SetPassword replaces the bcrypt hash of the user's password.
+	SetPassword(ctx context.Context, userID, hash string) error
+	SetEmailVerified(ctx context.Context, userID string) error
+	// SetTOTP replaces the user's TOTP secret, enabled flag and recovery
+	// code hashes. An empty secret turns two-factor authentication off.
+	SetTOTP(ctx context.Context, userID, secret string, enabled bool, recoveryCodes []string) error
+	// AcceptTOTPCounter records that a code for time step counter was used,
+	// or returns ErrCodeUsed if one for this or a later step already was.
+	AcceptTOTPCounter(ctx context.Context, userID string, counter int64) error
+	// UseRecoveryCode removes the recovery code with the given hash, or
+	// returns ErrCodeUsed if the user has no such unused code.
+	UseRecoveryCode(ctx context.Context, userID, hash string) error
+	// SetOIDCIdentity links the user to an OpenID Connect account, or
+	// returns ErrUserExists if another user is linked to it.
+	SetOIDCIdentity(ctx context.Context, userID, identity string) error
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, session models.Session) error
+	GetSession(ctx context.Context, sessionID string) (models.Session, error)
+	// GetUserSessions returns the unexpired sessions of a user, most
+	// recently used first.
+	GetUserSessions(ctx context.Context, userID string, now int64) ([]models.Session, error)
+	// TouchSession records activity at lastSeenAt and extends the session
+	// to expiresAt.
+	TouchSession(ctx context.Context, sessionID string, lastSeenAt, expiresAt int64) error
+	DeleteSession(ctx context.Context, sessionID string) error
+	// DeleteUserSessions removes every session of a user except exceptID
+	// and returns how many were removed.
+	DeleteUserSessions(ctx context.Context, userID, exceptID string) (int64, error)
+	// DeleteExpiredSessions removes sessions that expired before now and
+	// returns how many were removed.
+	DeleteExpiredSessions(ctx context.Context, now int64) (int64, error)
+}
+
+type TokenStore interface {
+	// AddToken stores token under token.ID, which the caller must set.
+	AddToken(ctx context.Context, token models.APIToken) error
+	// GetTokenByHash returns the token with the given hash, expired or not.
+	GetTokenByHash(ctx context.Context, hash string) (models.APIToken, error)
+	// GetTokens returns the tokens of a user, newest first.
+	GetTokens(ctx context.Context, userID string) ([]models.APIToken, error)
+	// TouchToken records that the token was used at usedAt.
+	TouchToken(ctx context.Context, id string, usedAt int64) error
+	// DeleteToken revokes a token of the given user; tokens of other users
+	// are reported as ErrNoSuchToken.
+	DeleteToken(ctx context.Context, userID, id string) error
+}
+
+// OneTimeTokenStore keeps the tokens mailed to users to verify their email
+// address or reset their password.
+type OneTimeTokenStore interface {
+	// AddOneTimeToken stores token under token.Hash.
+	AddOneTimeToken(ctx context.Context, token models.OneTimeToken) error
+	// UseOneTimeToken deletes the token with the given hash and purpose and
+	// returns it, so that it works only once. Unknown tokens and tokens that
+	// expired before now are reported as ErrNoSuchOneTimeToken.
+	UseOneTimeToken(ctx context.Context, hash, purpose string, now int64) (models.OneTimeToken, error)
+	// DeleteOneTimeTokens removes the user's tokens for purpose.
+	DeleteOneTimeTokens(ctx context.Context, userID, purpose string) error
+	// DeleteExpiredOneTimeTokens removes tokens that expired before now and
+	// returns how many were removed.
+	DeleteExpiredOneTimeTokens(ctx context.Context, now int64) (int64, error)
+}
+
+type SettingsStore interface {
+	// GetSettings returns the zero Settings until they are first saved.
+	GetSettings(ctx context.Context) (models.Settings, error)
+	SaveSettings(ctx context.Context, settings models.Settings) error
+}
+
+// ImportStore writes bulk imports.
+type ImportStore interface {
+	// ImportBatch adds batch.Persons and then batch.Relationships and
+	// applies the updates, all in one transaction, recording revisions like
+	// the single-entry methods do. If any change fails, with
+	// ErrPersonExists, ErrPersonsNotFound, ErrNoSuchPerson,
+	// ErrNoSuchRelationship or otherwise, none is made.
+	ImportBatch(ctx context.Context, batch Batch) error
+}
+
+// Batch is a set of changes imported together.
+type Batch struct {
+	Persons       []models.Person
+	Relationships []models.Relationship
+	// PersonUpdates and RelationshipUpdates change existing entries.
+	PersonUpdates       []PersonPatch
+	RelationshipUpdates []RelationshipPatch
+}
+
+// PersonPatch is an update of the person with the given ID.
+type PersonPatch struct {
+	ID     string
+	Update models.PersonUpdate
+}
+
+// RelationshipPatch is an update of the relationship with the given ID.
+type RelationshipPatch struct {
+	ID     string
+	Update models.RelationshipUpdate
+}
+
+// AuditStore keeps the audit log. It is append-only: entries cannot be
+// changed or removed through it.
+type AuditStore interface {
+	AddAuditEntry(ctx context.Context, entry models.AuditEntry) error
+	// GetAuditEntries returns at most query.Limit entries matching query,
+	// newest first.
+	GetAuditEntries(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, error)
+}
+
+// Store is everything the server needs from a backend.
+type Store interface {
+	PersonStore
+	RelationshipStore
+	GraphStore
+	SourceStore
+	RevisionStore
+	ProposalStore
+	UserStore
+	SessionStore
+	TokenStore
+	OneTimeTokenStore
+	SettingsStore
+	ImportStore
+	AuditStore
+
+	Close(ctx context.Context) error
+}
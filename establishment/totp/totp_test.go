@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The last six digits of the eight-digit RFC 6238 SHA-1 vectors.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Counter(now)
+	code := func(counter int64) string {
+		c, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		counter int64
+		ok      bool
+	}{
+		{"current step", code(current), current, true},
+		{"previous step", code(current - 1), current - 1, true},
+		{"next step", code(current + 1), current + 1, true},
+		{"with spaces", code(current)[:3] + " " + code(current)[3:], current, true},
+		{"two steps ago", code(current - 2), 0, false},
+		{"two steps ahead", code(current + 2), 0, false},
+		{"too short", code(current)[:5], 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		counter, ok := Validate(rfcSecret, tt.code, now)
+		if ok != tt.ok || counter != tt.counter {
+			t.Errorf("%s: Validate(%q) = %d, %v, want %d, %v", tt.name, tt.code, counter, ok, tt.counter, tt.ok)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("generated secret %q is not usable: %v", a, err)
+	}
+}
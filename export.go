@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"establishment/v1/establishment/graphfile"
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// graphFormats are the file formats served under /export/.
+var graphFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, models.Graph) error
+}{
+	"graphml": {"application/graphml+xml", graphfile.WriteGraphML},
+	"gexf":    {"application/gexf+xml", graphfile.WriteGEXF},
+}
+
+// GET /export/graphml?at=&person=&depth=&types=&direction=
+// GET /export/gexf?at=&person=&depth=&types=&direction=
+//
+// Exports the whole graph or, with person, its ego network as with
+// GET /person/:id/network. at keeps only the relationships active that day,
+// and the ego network only follows those.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, _ := resourcePath(r.URL.Path, "/export/")
+	format, ok := graphFormats[name]
+	if !ok {
+		log.Printf("Unknown export format: %s", r.URL.Path)
+		http.Error(w, "Unknown format: use graphml or gexf", http.StatusNotFound)
+		return
+	}
+
+	at := r.URL.Query().Get("at")
+	if at != "" {
+		if _, err := time.Parse(time.DateOnly, at); err != nil {
+			log.Printf("Invalid at in %s: %s", r.URL.Path, at)
+			http.Error(w, "Invalid at: use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var graph models.Graph
+	var err error
+	if personID := r.URL.Query().Get("person"); personID != "" {
+		var query models.NetworkQuery
+		query, err = parseNetworkQuery(personID, r)
+		if err != nil {
+			log.Printf("Invalid network query in %s: %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.At = at
+		graph, err = db.GetNetwork(ctx, query)
+		if err == store.ErrNoSuchPerson {
+			log.Printf("Person not found for ID: %s", personID)
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		graph, err = db.GetGraph(ctx, models.GraphFilter{At: at})
+	}
+	if err != nil {
+		log.Printf("Error fetching graph for export: %v", err)
+		http.Error(w, "Error fetching graph: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The document is built in memory so that encoding errors can still be
+	// reported with a status.
+	var buf bytes.Buffer
+	if err := format.write(&buf, graph); err != nil {
+		log.Printf("Error writing %s export: %v", name, err)
+		http.Error(w, "Error writing export: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="establishment.`+name+`"`)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error sending %s export: %v", name, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"establishment/v1/establishment/graphfile"
+	"establishment/v1/establishment/models"
+)
+
+func TestExportNetworkAt(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp("admin", "", nil)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		admin.expect(http.StatusCreated, http.MethodPost, "/person", models.Person{ID: id, Name: id}, nil)
+	}
+	// b was only known in the nineties, and d only through b.
+	rels := []models.Relationship{
+		{From: "a", To: "b", Type: "knows", StartDate: "1990", EndDate: "1999"},
+		{From: "b", To: "d", Type: "knows"},
+		{From: "a", To: "c", Type: "knows", StartDate: "2005"},
+	}
+	for _, rel := range rels {
+		admin.expect(http.StatusCreated, http.MethodPost, "/relationship", rel, nil)
+	}
+
+	tests := []struct {
+		at    string
+		want  []string
+		edges int
+	}{
+		{"", []string{"a", "b", "c", "d"}, 3},
+		{"1995-06-01", []string{"a", "b", "d"}, 2},
+		{"2010-01-01", []string{"a", "c"}, 1},
+	}
+	for _, tt := range tests {
+		path := "/export/graphml?person=a&depth=2&at=" + tt.at
+		resp, body := admin.do(http.MethodGet, path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d %q", path, resp.StatusCode, body)
+		}
+		doc, err := graphfile.ReadGraphML(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		var got []string
+		for _, node := range doc.Nodes {
+			got = append(got, node.ID)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) || len(doc.Edges) != tt.edges {
+			t.Errorf("GET %s: nodes %v with %d edges, want %v with %d", path, got, len(doc.Edges), tt.want, tt.edges)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+// GET /person/:id/history, GET /relationship/:id/history
+func handleHistory(w http.ResponseWriter, r *http.Request, target models.EntityRef) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /%s/:id/history", r.Method, target.Type)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	revisions, err := db.GetRevisions(ctx, target)
+	if err != nil {
+		log.Printf("Error fetching history of %s %s: %v", target.Type, target.ID, err)
+		http.Error(w, "Error fetching history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Entities written before revisions were kept have an empty history;
+	// only report 404 for IDs that never existed.
+	if len(revisions) == 0 && !entityExists(ctx, w, target) {
+		return
+	}
+
+	for i := range revisions {
+		revisions[i].Changes = revisions[i].Diff()
+	}
+	writeJSON(w, revisions)
+}
+
+// POST /person/:id/revert, POST /relationship/:id/revert
+//
+// Restores the entity to the state recorded after the given revision,
+// recreating it if it has been deleted since. The restore is itself recorded
+// as a new revision.
+func handleRevert(w http.ResponseWriter, r *http.Request, target models.EntityRef) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /%s/:id/revert", r.Method, target.Type)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Version < 1 {
+		log.Printf("Invalid input data in POST /%s/%s/revert: %v", target.Type, target.ID, err)
+		http.Error(w, "A positive version is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rev, err := db.GetRevision(ctx, target, input.Version)
+	if err == store.ErrNoSuchRevision {
+		log.Printf("Revision %d of %s %s not found", input.Version, target.Type, target.ID)
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching revision %d of %s %s: %v", input.Version, target.Type, target.ID, err)
+		http.Error(w, "Error fetching revision: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rev.After == nil {
+		log.Printf("Refusing to revert %s %s to deletion revision %d", target.Type, target.ID, rev.Version)
+		http.Error(w, fmt.Sprintf("Revision %d deleted the %s; revert to an earlier version", rev.Version, target.Type), http.StatusBadRequest)
+		return
+	}
+
+	var restored interface{}
+	switch target.Type {
+	case models.EntityPerson:
+		var person models.Person
+		if err = json.Unmarshal(rev.After, &person); err == nil {
+			if !validSourceIDs(ctx, w, person.SourceIDs) {
+				return
+			}
+			restored, err = revertPerson(ctx, person)
+		}
+	case models.EntityRelationship:
+		var rel models.Relationship
+		if err = json.Unmarshal(rev.After, &rel); err == nil {
+			if !validSourceIDs(ctx, w, rel.SourceIDs) {
+				return
+			}
+			restored, err = revertRelationship(ctx, rel)
+		}
+	}
+	switch err {
+	case nil:
+		log.Printf("Reverted %s %s to revision %d", target.Type, target.ID, rev.Version)
+		writeJSON(w, restored)
+	case store.ErrPersonsNotFound:
+		log.Printf("Cannot restore relationship %s: %v", target.ID, err)
+		http.Error(w, "Cannot restore relationship: "+err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Failed to revert %s %s to revision %d: %v", target.Type, target.ID, rev.Version, err)
+		http.Error(w, "Failed to revert: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// revertPerson overwrites every editable field of the stored person with the
+// snapshot, or adds the snapshot back if the person was deleted.
+func revertPerson(ctx context.Context, person models.Person) (models.Person, error) {
+	restored, err := db.UpdatePerson(ctx, person.ID, models.PersonUpdate{
+		Name:        &person.Name,
+		Occupation:  &person.Occupation,
+		ImageURL:    &person.ImageURL,
+		Twitter:     &person.Twitter,
+		Description: &person.Description,
+		SourceIDs:   &person.SourceIDs,
+	})
+	if err == store.ErrNoSuchPerson {
+		return person, db.AddPerson(ctx, person)
+	}
+	return restored, err
+}
+
+// revertRelationship is revertPerson for relationships. Recreating a deleted
+// relationship fails with store.ErrPersonsNotFound once an endpoint is gone.
+func revertRelationship(ctx context.Context, rel models.Relationship) (models.Relationship, error) {
+	restored, err := db.UpdateRelationship(ctx, rel.ID, models.RelationshipUpdate{
+		Type:      &rel.Type,
+		Details:   &rel.Details,
+		StartDate: &rel.StartDate,
+		EndDate:   &rel.EndDate,
+		SourceIDs: &rel.SourceIDs,
+	})
+	if err == store.ErrNoSuchRelationship {
+		return rel, db.AddRelationship(ctx, rel)
+	}
+	return restored, err
+}
+
+// entityExists reports whether target is stored, writing the error response
+// itself when it is not.
+func entityExists(ctx context.Context, w http.ResponseWriter, target models.EntityRef) bool {
+	var err error
+	switch target.Type {
+	case models.EntityPerson:
+		_, err = db.GetPerson(ctx, target.ID)
+	case models.EntityRelationship:
+		_, err = db.GetRelationship(ctx, target.ID)
+	}
+	switch err {
+	case nil:
+		return true
+	case store.ErrNoSuchPerson, store.ErrNoSuchRelationship:
+		log.Printf("No %s with ID %s", target.Type, target.ID)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("Error fetching %s %s: %v", target.Type, target.ID, err)
+		http.Error(w, "Error fetching "+target.Type+": "+err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
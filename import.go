@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/csvimport"
+	"establishment/v1/establishment/graphimport"
+)
+
+const (
+	// maxImportSize bounds the request body of an import.
+	maxImportSize = 64 << 20
+	importTimeout = 5 * time.Minute
+)
+
+// POST /import/csv
+//
+// Takes a multipart form with a persons and/or a relationships CSV file,
+// optional persons_mapping and relationships_mapping ("field=Column,..."),
+// dry_run and batch_size.
+func handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /import/csv", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		log.Printf("Invalid form in POST /import/csv: %v", err)
+		http.Error(w, "Expected a multipart form with persons and/or relationships files", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	opts, ok := importOptions(w, r)
+	if !ok {
+		return
+	}
+	persons, ok := formFile(w, r, "persons")
+	if !ok {
+		return
+	}
+	if persons != nil {
+		defer persons.Close()
+	}
+	relationships, ok := formFile(w, r, "relationships")
+	if !ok {
+		return
+	}
+	if relationships != nil {
+		defer relationships.Close()
+	}
+	if persons == nil && relationships == nil {
+		log.Printf("No files in POST /import/csv")
+		http.Error(w, "A persons or relationships file is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), importTimeout)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	report, err := csvimport.Import(ctx, db, readerOrNil(persons), readerOrNil(relationships), opts)
+	if err != nil {
+		log.Printf("Invalid CSV in POST /import/csv: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case !report.Valid:
+		log.Printf("CSV import by %s rejected: invalid rows", user.Login)
+		writeJSONStatus(w, http.StatusUnprocessableEntity, report)
+	case report.Error != "":
+		log.Printf("CSV import by %s failed: %s", user.Login, report.Error)
+		writeJSONStatus(w, http.StatusInternalServerError, report)
+	case report.DryRun:
+		writeJSON(w, report)
+	default:
+		log.Printf("User %s imported %d persons and %d relationships from CSV", user.Login, report.PersonsImported, report.RelationshipsImported)
+		writeJSONStatus(w, http.StatusCreated, report)
+	}
+}
+
+// importOptions reads the options of POST /import/csv, writing the error
+// response itself when ok is false.
+func importOptions(w http.ResponseWriter, r *http.Request) (opts csvimport.Options, ok bool) {
+	var err error
+	if opts.PersonMapping, err = csvimport.ParseMapping(r.FormValue("persons_mapping")); err != nil {
+		http.Error(w, "persons_mapping: "+err.Error(), http.StatusBadRequest)
+		return opts, false
+	}
+	if opts.RelationshipMapping, err = csvimport.ParseMapping(r.FormValue("relationships_mapping")); err != nil {
+		http.Error(w, "relationships_mapping: "+err.Error(), http.StatusBadRequest)
+		return opts, false
+	}
+	opts.DryRun, opts.BatchSize, ok = batchOptions(w, r)
+	return opts, ok
+}
+
+// batchOptions reads the dry_run and batch_size options shared by all
+// imports, writing the error response itself when ok is false.
+func batchOptions(w http.ResponseWriter, r *http.Request) (dryRun bool, batchSize int, ok bool) {
+	var err error
+	if value := r.FormValue("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return false, 0, false
+		}
+	}
+	if value := r.FormValue("batch_size"); value != "" {
+		if batchSize, err = strconv.Atoi(value); err != nil || batchSize < 1 {
+			http.Error(w, "batch_size must be a positive integer", http.StatusBadRequest)
+			return false, 0, false
+		}
+	}
+	return dryRun, batchSize, true
+}
+
+// formFile opens an optional uploaded file; it is nil if none was sent.
+func formFile(w http.ResponseWriter, r *http.Request, name string) (multipart.File, bool) {
+	file, _, err := r.FormFile(name)
+	if err == http.ErrMissingFile {
+		return nil, true
+	}
+	if err != nil {
+		log.Printf("Error reading uploaded file %s: %v", name, err)
+		http.Error(w, "Error reading "+name+" file: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return file, true
+}
+
+// POST /import/graphml
+// POST /import/gexf
+//
+// Takes a multipart form with the file, dry_run and batch_size, and upserts
+// its nodes and edges by ID.
+func handleImportGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := strings.TrimPrefix(r.URL.Path, "/import/")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		log.Printf("Invalid form in POST %s: %v", r.URL.Path, err)
+		http.Error(w, "Expected a multipart form with a file", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var opts graphimport.Options
+	var ok bool
+	if opts.DryRun, opts.BatchSize, ok = batchOptions(w, r); !ok {
+		return
+	}
+	file, ok := formFile(w, r, "file")
+	if !ok {
+		return
+	}
+	if file == nil {
+		log.Printf("No file in POST %s", r.URL.Path)
+		http.Error(w, "A file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	doc, err := graphimport.Read(format, file)
+	if err != nil {
+		log.Printf("Invalid file in POST %s: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), importTimeout)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	report, err := graphimport.Import(ctx, db, doc, opts)
+	if err != nil {
+		log.Printf("Error importing %s: %v", format, err)
+		http.Error(w, "Error importing: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case !report.Valid:
+		log.Printf("%s import by %s rejected: invalid nodes or edges", format, user.Login)
+		writeJSONStatus(w, http.StatusUnprocessableEntity, report)
+	case report.Error != "":
+		log.Printf("%s import by %s failed: %s", format, user.Login, report.Error)
+		writeJSONStatus(w, http.StatusInternalServerError, report)
+	default:
+		if !report.DryRun {
+			log.Printf("User %s imported %s: %d persons created, %d updated; %d relationships created, %d updated", user.Login, format,
+				report.PersonsCreated, report.PersonsUpdated, report.RelationshipsCreated, report.RelationshipsUpdated)
+		}
+		writeJSON(w, report)
+	}
+}
+
+// readerOrNil keeps a nil file from turning into a non-nil io.Reader.
+func readerOrNil(file multipart.File) io.Reader {
+	if file == nil {
+		return nil
+	}
+	return file
+}
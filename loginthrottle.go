@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// freeLoginAttempts failures are allowed before backoff starts.
+	freeLoginAttempts = 3
+	maxLoginBackoff   = 5 * time.Minute
+
+	defaultLoginMaxFailures = 10
+	defaultLoginLockout     = 15 * time.Minute
+)
+
+// loginThrottle slows down password guessing. Every failed attempt is
+// counted against both the login and the client IP; past freeLoginAttempts
+// each further failure doubles the wait before the next attempt, and after
+// maxFailures the login is locked for the lockout duration. Failures are
+// forgotten once none occurred for lockout.
+//
+// The counts are kept in memory, so they start over when the server
+// restarts.
+type loginThrottle struct {
+	maxFailures int
+	lockout     time.Duration
+
+	mu        sync.Mutex
+	failures  map[string]*loginFailures
+	lastPrune time.Time
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+func newLoginThrottle(maxFailures int, lockout time.Duration) *loginThrottle {
+	return &loginThrottle{maxFailures: maxFailures, lockout: lockout, failures: make(map[string]*loginFailures)}
+}
+
+// wait returns how long login must wait before its next attempt from ip.
+func (t *loginThrottle) wait(login, ip string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+	var wait time.Duration
+	for _, key := range []string{"login:" + login, "ip:" + ip} {
+		if f, ok := t.failures[key]; ok && f.until.After(now) {
+			wait = max(wait, f.until.Sub(now))
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt and reports whether it locked the login.
+func (t *loginThrottle) fail(login, ip string, now time.Time) (locked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	loginFailures := t.record("login:"+login, now)
+	if loginFailures.count >= t.maxFailures {
+		loginFailures.until = now.Add(t.lockout)
+		locked = true
+	}
+	t.record("ip:"+ip, now)
+	return locked
+}
+
+// succeed clears the failures of login. Those of the IP remain, so that a
+// guesser cannot reset them by signing in to an account of their own.
+func (t *loginThrottle) succeed(login string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, "login:"+login)
+}
+
+// record counts a failure for key and sets its backoff. Callers must hold
+// t.mu.
+func (t *loginThrottle) record(key string, now time.Time) *loginFailures {
+	f, ok := t.failures[key]
+	if !ok || t.expired(f, now) {
+		f = &loginFailures{}
+		t.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if excess := f.count - freeLoginAttempts; excess > 0 {
+		backoff := maxLoginBackoff
+		if excess <= 16 {
+			backoff = min(time.Second<<(excess-1), maxLoginBackoff)
+		}
+		f.until = now.Add(backoff)
+	}
+	return f
+}
+
+func (t *loginThrottle) expired(f *loginFailures, now time.Time) bool {
+	return !f.until.After(now) && now.Sub(f.last) >= t.lockout
+}
+
+// prune forgets expired failures, at most once per lockout. Callers must
+// hold t.mu.
+func (t *loginThrottle) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.lockout {
+		return
+	}
+	t.lastPrune = now
+	for key, f := range t.failures {
+		if t.expired(f, now) {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// newLoginThrottleFromEnv configures the throttle from LOGIN_MAX_FAILURES
+// and LOGIN_LOCKOUT.
+func newLoginThrottleFromEnv() (*loginThrottle, error) {
+	maxFailures, err := intEnv("LOGIN_MAX_FAILURES", defaultLoginMaxFailures)
+	if err != nil {
+		return nil, err
+	}
+	lockout, err := durationEnv("LOGIN_LOCKOUT", defaultLoginLockout)
+	if err != nil {
+		return nil, err
+	}
+	return newLoginThrottle(maxFailures, lockout), nil
+}
+
+// loginFailed records a failed login attempt with loginGuard.
+func loginFailed(login, ip string) {
+	if loginGuard.fail(login, ip, time.Now()) {
+		log.Printf("Locked login %s after repeated failures from %s", login, ip)
+	}
+}
@@ -3,67 +3,241 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"establishment/v1/establishment/mail"
+	"establishment/v1/establishment/memory"
 	"establishment/v1/establishment/models"
 	database "establishment/v1/establishment/neo4j"
+	"establishment/v1/establishment/oidc"
+	"establishment/v1/establishment/store"
 	"github.com/google/uuid"
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var driver neo4j.DriverWithContext
+var (
+	db store.Store
+	// loginGuard throttles failed logins.
+	loginGuard *loginThrottle
+	mailer     mail.Mailer
+	// publicURL is where users reach the server, for links in emails.
+	publicURL = strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	// requireVerifiedEmail refuses logins until the user's email address
+	// is verified.
+	requireVerifiedEmail = os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	// oidcProvider signs users in through /oidc/login; nil if not
+	// configured.
+	oidcProvider *oidc.Provider
+)
+
+const (
+	defaultPersonsLimit = 50
+	maxPersonsLimit     = 500
+)
 
 func main() {
 	ctx := context.Background()
 
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Error running %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	var err error
-	driver, err = database.ConnectToNeo4j(ctx)
+	db, err = openStore(ctx)
 	if err != nil {
-		log.Fatalf("Error connecting to Neo4j: %v", err)
+		log.Fatalf("Error opening store: %v", err)
 	}
-	defer driver.Close(ctx)
+	defer db.Close(ctx)
 
-	http.Handle("/person/", enableCORS(http.HandlerFunc(handlePerson)))
-	http.Handle("/person", enableCORS(requireAuth(http.HandlerFunc(handlePersonPost))))
-	http.Handle("/relationship", enableCORS(requireAuth(http.HandlerFunc(handleRelationship))))
-	http.Handle("/graph", enableCORS(http.HandlerFunc(handleGraph)))
-	http.Handle("/persons", enableCORS(http.HandlerFunc(handlePersons)))
-	http.Handle("/register", enableCORS(http.HandlerFunc(handleRegister)))
-	http.Handle("/login", enableCORS(http.HandlerFunc(handleLogin)))
-	http.Handle("/logout", enableCORS(http.HandlerFunc(handleLogout)))
-	http.Handle("/check-session", enableCORS(http.HandlerFunc(handleCheckSession)))
+	// The restore command cannot reach the memory backend, which is why the
+	// server can load an archive itself.
+	if path := os.Getenv("RESTORE_FROM"); path != "" {
+		manifest, err := restoreFile(ctx, db, path, os.Getenv("RESTORE_AUTHOR"))
+		if err != nil {
+			log.Fatalf("Error restoring %s: %v", path, err)
+		}
+		log.Printf("Restored %s: %v records", path, manifest.Counts)
+	}
 
-	fs := http.FileServer(http.Dir("static"))
-	http.Handle("/", fs)
+	if login := os.Getenv("ADMIN_LOGIN"); login != "" {
+		if err := bootstrapAdmin(ctx, login); err != nil {
+			log.Fatalf("Error granting admin role to %s: %v", login, err)
+		}
+	}
+
+	sweepInterval, err := durationEnv("SESSION_SWEEP_INTERVAL", defaultSessionSweepInterval)
+	if err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
+	}
+	go sweepSessions(ctx, sweepInterval)
+
+	apiLimiter, authLimiter, err := rateLimiters()
+	if err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
+	}
+	if loginGuard, err = newLoginThrottleFromEnv(); err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
+	}
+
+	if mailer, err = mail.FromEnv(); err != nil {
+		log.Fatalf("Error configuring mail: %v", err)
+	}
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+	if oidcProvider, err = newOIDCProviderFromEnv(); err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
+	}
 
 	log.Println("Server started on port :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", newRouter(apiLimiter, authLimiter)))
 }
 
-// GET /person/:id
+// newRouter registers every route and wraps them in the audit log, rate
+// limiting and CSRF checks that apply to all requests. The audit log comes
+// first so that requests refused by the rate limit are recorded as well.
+func newRouter(apiLimiter, authLimiter *rateLimiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/person/", enableCORS(http.HandlerFunc(handlePerson)))
+	mux.Handle("/person", enableCORS(requireAuth(http.HandlerFunc(handlePersonPost))))
+	mux.Handle("/relationship", enableCORS(requireAuth(http.HandlerFunc(handleRelationship))))
+	mux.Handle("/relationship/", enableCORS(http.HandlerFunc(handleRelationshipByID)))
+	mux.Handle("/graph", enableCORS(http.HandlerFunc(handleGraph)))
+	mux.Handle("/export/", enableCORS(http.HandlerFunc(handleExport)))
+	mux.Handle("/path", enableCORS(http.HandlerFunc(handlePath)))
+	mux.Handle("/search", enableCORS(http.HandlerFunc(handleSearch)))
+	mux.Handle("/search/suggest", enableCORS(http.HandlerFunc(handleSuggest)))
+	mux.Handle("/source", enableCORS(requireRole(models.RoleEditor, http.HandlerFunc(handleSourcePost))))
+	mux.Handle("/sources", enableCORS(http.HandlerFunc(handleSourcesGet)))
+	mux.Handle("/source/", enableCORS(http.HandlerFunc(handleSourceByID)))
+	mux.Handle("/proposals", enableCORS(requireAuth(http.HandlerFunc(handleProposals))))
+	mux.Handle("/proposal/", enableCORS(requireAuth(http.HandlerFunc(handleProposalByID))))
+	mux.Handle("/tokens", enableCORS(requireAuth(http.HandlerFunc(handleTokens))))
+	mux.Handle("/token/", enableCORS(requireAuth(http.HandlerFunc(handleTokenByID))))
+	mux.Handle("/import/csv", enableCORS(requireRole(models.RoleEditor, http.HandlerFunc(handleImportCSV))))
+	mux.Handle("/import/graphml", enableCORS(requireRole(models.RoleEditor, http.HandlerFunc(handleImportGraph))))
+	mux.Handle("/import/gexf", enableCORS(requireRole(models.RoleEditor, http.HandlerFunc(handleImportGraph))))
+	mux.Handle("/persons", enableCORS(http.HandlerFunc(handlePersons)))
+	mux.Handle("/admin/users", enableCORS(requireRole(models.RoleAdmin, http.HandlerFunc(handleAdminUsers))))
+	mux.Handle("/admin/users/", enableCORS(requireRole(models.RoleAdmin, http.HandlerFunc(handleAdminUser))))
+	mux.Handle("/admin/backup", enableCORS(requireRole(models.RoleAdmin, http.HandlerFunc(handleAdminBackup))))
+	mux.Handle("/admin/audit", enableCORS(requireRole(models.RoleAdmin, http.HandlerFunc(handleAdminAudit))))
+	mux.Handle("/admin/settings", enableCORS(requireRole(models.RoleAdmin, http.HandlerFunc(handleAdminSettings))))
+	mux.Handle("/sessions", enableCORS(requireAuth(http.HandlerFunc(handleSessions))))
+	mux.Handle("/session/", enableCORS(requireAuth(http.HandlerFunc(handleSessionByID))))
+	mux.Handle("/register", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleRegister))))
+	mux.Handle("/login", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleLogin))))
+	mux.Handle("/login/2fa", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleLoginTwoFactor))))
+	mux.Handle("/oidc/login", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleOIDCLogin))))
+	mux.Handle("/oidc/callback", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleOIDCCallback))))
+	mux.Handle("/2fa/", enableCORS(requireAuth(http.HandlerFunc(handleTwoFactor))))
+	mux.Handle("/verify-email", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleVerifyEmail))))
+	mux.Handle("/verify-email/resend", enableCORS(requireAuth(limitRate(authLimiter, http.HandlerFunc(handleResendVerification)))))
+	mux.Handle("/forgot-password", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleForgotPassword))))
+	mux.Handle("/reset-password", enableCORS(limitRate(authLimiter, http.HandlerFunc(handleResetPassword))))
+	mux.Handle("/logout", enableCORS(http.HandlerFunc(handleLogout)))
+	mux.Handle("/check-session", enableCORS(http.HandlerFunc(handleCheckSession)))
+
+	fs := http.FileServer(http.Dir("static"))
+	mux.Handle("/", fs)
+
+	return auditRequests(limitRate(apiLimiter, checkCSRF(mux)))
+}
+
+// openStore picks the storage backend from STORE_BACKEND ("neo4j" by default,
+// or "memory" to run without a database).
+func openStore(ctx context.Context) (store.Store, error) {
+	backend := os.Getenv("STORE_BACKEND")
+	switch backend {
+	case "", "neo4j":
+		driver, err := database.ConnectToNeo4j(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := database.Migrate(ctx, driver); err != nil {
+			driver.Close(ctx)
+			return nil, err
+		}
+		return database.NewStore(driver), nil
+	case "memory":
+		log.Println("Warning: using in-memory store, data will be lost on restart")
+		return memory.NewStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
+
+// /person/:id and its sub-resources
 func handlePerson(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		log.Printf("Unsupported method %s for /person (GET)", r.Method)
-		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+	id, sub := resourcePath(r.URL.Path, "/person/")
+	section, _, _ := strings.Cut(sub, "/")
+	if section != sub && section != "sources" {
+		http.NotFound(w, r)
+		return
+	}
+	switch section {
+	case "":
+	case "sources":
+		requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleCitation(w, r, models.EntityRef{Type: models.EntityPerson, ID: id}, sub)
+		})).ServeHTTP(w, r)
+		return
+	case "history":
+		handleHistory(w, r, models.EntityRef{Type: models.EntityPerson, ID: id})
+		return
+	case "revert":
+		requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleRevert(w, r, models.EntityRef{Type: models.EntityPerson, ID: id})
+		})).ServeHTTP(w, r)
+		return
+	case "relationships":
+		handlePersonRelationships(w, r)
+		return
+	case "network":
+		handlePersonNetwork(w, r)
+		return
+	default:
+		http.NotFound(w, r)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	switch r.Method {
+	case http.MethodGet:
+		handlePersonGet(w, r)
+	case http.MethodPut, http.MethodPatch:
+		requireRole(models.RoleEditor, http.HandlerFunc(handlePersonUpdate)).ServeHTTP(w, r)
+	case http.MethodDelete:
+		requireRole(models.RoleEditor, http.HandlerFunc(handlePersonDelete)).ServeHTTP(w, r)
+	default:
+		log.Printf("Unsupported method %s for /person/:id", r.Method)
+		http.Error(w, "Only GET, PUT, PATCH and DELETE allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /person/:id
+func handlePersonGet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	id := strings.TrimPrefix(r.URL.Path, "/person/")
+	id, _ := resourcePath(r.URL.Path, "/person/")
 	if id == "" {
 		log.Printf("No person ID provided in request: %s", r.URL.Path)
 		http.Error(w, "Person ID required", http.StatusBadRequest)
 		return
 	}
 
-	person, err := database.GetPerson(ctx, driver, id)
-	if err == database.ErrNoSuchPerson {
+	person, err := db.GetPerson(ctx, id)
+	if err == store.ErrNoSuchPerson {
 		log.Printf("Person not found for ID: %s", id)
 		http.Error(w, "Person not found", http.StatusNotFound)
 		return
@@ -74,9 +248,119 @@ func handlePerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sources, err := db.GetSourcesByIDs(ctx, person.SourceIDs)
+	if err != nil {
+		log.Printf("Error fetching sources for person %s: %v", id, err)
+		http.Error(w, "Error fetching sources: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, models.PersonDetails{Person: person, Sources: sources})
+}
+
+// PUT/PATCH /person/:id
+func handlePersonUpdate(w http.ResponseWriter, r *http.Request) {
+	id, _ := resourcePath(r.URL.Path, "/person/")
+	if id == "" {
+		log.Printf("No person ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Person ID required", http.StatusBadRequest)
+		return
+	}
+
+	var update models.PersonUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("Invalid input data in %s /person/%s: %v", r.Method, id, err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	if update.Name != nil && *update.Name == "" {
+		log.Printf("Empty name in %s /person/%s", r.Method, id)
+		http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if update.SourceIDs != nil && !validSourceIDs(ctx, w, *update.SourceIDs) {
+		return
+	}
+
+	person, err := db.UpdatePerson(ctx, id, update)
+	if err == store.ErrNoSuchPerson {
+		log.Printf("Person not found for ID: %s", id)
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update person %s: %v", id, err)
+		http.Error(w, "Failed to update person: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	writeJSON(w, person)
 }
 
+// DELETE /person/:id
+func handlePersonDelete(w http.ResponseWriter, r *http.Request) {
+	id, _ := resourcePath(r.URL.Path, "/person/")
+	if id == "" {
+		log.Printf("No person ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Person ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.DeletePerson(ctx, id); err != nil {
+		if err == store.ErrNoSuchPerson {
+			log.Printf("Person not found for ID: %s", id)
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to delete person %s: %v", id, err)
+		http.Error(w, "Failed to delete person: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /person/:id/relationships
+func handlePersonRelationships(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /person/:id/relationships", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, _ := resourcePath(r.URL.Path, "/person/")
+	if id == "" {
+		log.Printf("No person ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Person ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rels, err := db.GetPersonRelationships(ctx, id)
+	if err == store.ErrNoSuchPerson {
+		log.Printf("Person not found for ID: %s", id)
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching relationships for person %s: %v", id, err)
+		http.Error(w, "Error fetching relationships: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, rels)
+}
+
 // POST /person
 func handlePersonPost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -85,7 +369,7 @@ func handlePersonPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	var person models.Person
@@ -95,13 +379,22 @@ func handlePersonPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if person.ID == "" || person.Name == "" {
-		log.Printf("Missing required fields in POST /person: %+v", person)
-		http.Error(w, "ID and name are required", http.StatusBadRequest)
+	if !validPerson(ctx, w, person) {
+		return
+	}
+	if user, _ := currentUser(r); !user.HasRole(models.RoleEditor) {
+		propose(w, r, models.Proposal{Kind: models.EntityPerson, Person: &person})
 		return
 	}
+	person.CreatedAt = time.Now().Unix()
 
-	if err := database.AddPerson(ctx, driver, person); err != nil {
+	auditTarget(r, models.EntityPerson, person.ID)
+	if err := db.AddPerson(ctx, person); err != nil {
+		if err == store.ErrPersonExists {
+			log.Printf("Person already exists: id=%s", person.ID)
+			http.Error(w, "Person with this ID already exists", http.StatusConflict)
+			return
+		}
 		log.Printf("Failed to add person: %v", err)
 		http.Error(w, "Failed to add person: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -125,19 +418,212 @@ func handleRelationship(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := database.AddRelationship(ctx, driver, rel); err != nil {
+	if !validRelationship(ctx, w, rel) {
+		return
+	}
+	if user, _ := currentUser(r); !user.HasRole(models.RoleEditor) {
+		propose(w, r, models.Proposal{Kind: models.EntityRelationship, Relationship: &rel})
+		return
+	}
+	rel.ID = uuid.New().String()
+	auditTarget(r, models.EntityRelationship, rel.ID)
+
+	if err := db.AddRelationship(ctx, rel); err != nil {
+		if err == store.ErrInvalidRelationship {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == store.ErrPersonsNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		log.Printf("Failed to add relationship: %v", err)
 		http.Error(w, "Failed to add relationship: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	writeJSONStatus(w, http.StatusCreated, rel)
+}
+
+// validPerson reports whether person can be added, writing the error
+// response itself when it cannot.
+func validPerson(ctx context.Context, w http.ResponseWriter, person models.Person) bool {
+	if person.ID == "" || person.Name == "" {
+		log.Printf("Missing required fields in person: %+v", person)
+		http.Error(w, "ID and name are required", http.StatusBadRequest)
+		return false
+	}
+	return validSourceIDs(ctx, w, person.SourceIDs)
+}
+
+// validRelationship is validPerson for relationships. Whether the endpoints
+// exist is left to AddRelationship.
+func validRelationship(ctx context.Context, w http.ResponseWriter, rel models.Relationship) bool {
+	if rel.From == rel.To {
+		log.Printf("Invalid relationship: source_id=%s and target_id=%s are the same", rel.From, rel.To)
+		http.Error(w, store.ErrInvalidRelationship.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := rel.Validate(); err != nil {
+		log.Printf("Invalid dates in relationship: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return validSourceIDs(ctx, w, rel.SourceIDs)
+}
+
+// /relationship/:id
+func handleRelationshipByID(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/relationship/")
+	target := models.EntityRef{Type: models.EntityRelationship, ID: id}
+	if section, _, _ := strings.Cut(sub, "/"); id != "" && section != "" {
+		switch {
+		case section == "sources":
+			requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handleCitation(w, r, target, sub)
+			})).ServeHTTP(w, r)
+		case sub == "history":
+			handleHistory(w, r, target)
+		case sub == "revert":
+			requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handleRevert(w, r, target)
+			})).ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleRelationshipGet(w, r)
+	case http.MethodPut, http.MethodPatch:
+		requireRole(models.RoleEditor, http.HandlerFunc(handleRelationshipUpdate)).ServeHTTP(w, r)
+	case http.MethodDelete:
+		requireRole(models.RoleEditor, http.HandlerFunc(handleRelationshipDelete)).ServeHTTP(w, r)
+	default:
+		log.Printf("Unsupported method %s for /relationship/:id", r.Method)
+		http.Error(w, "Only GET, PUT, PATCH and DELETE allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /relationship/:id
+func handleRelationshipGet(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/relationship/")
+	if id == "" || sub != "" {
+		log.Printf("Invalid relationship path: %s", r.URL.Path)
+		http.Error(w, "Relationship ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rel, err := db.GetRelationship(ctx, id)
+	if err == store.ErrNoSuchRelationship {
+		log.Printf("Relationship not found for ID: %s", id)
+		http.Error(w, "Relationship not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching relationship %s: %v", id, err)
+		http.Error(w, "Error fetching relationship: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, rel)
+}
+
+// PUT/PATCH /relationship/:id
+func handleRelationshipUpdate(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/relationship/")
+	if id == "" || sub != "" {
+		log.Printf("Invalid relationship path: %s", r.URL.Path)
+		http.Error(w, "Relationship ID required", http.StatusBadRequest)
+		return
+	}
+
+	var update models.RelationshipUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("Invalid input data in %s /relationship/%s: %v", r.Method, id, err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	if update.Type != nil && *update.Type == "" {
+		log.Printf("Empty type in %s /relationship/%s", r.Method, id)
+		http.Error(w, "Type cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	current, err := db.GetRelationship(ctx, id)
+	if err == store.ErrNoSuchRelationship {
+		log.Printf("Relationship not found for ID: %s", id)
+		http.Error(w, "Relationship not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching relationship %s: %v", id, err)
+		http.Error(w, "Error fetching relationship: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := update.Apply(current).Validate(); err != nil {
+		log.Printf("Invalid dates in %s /relationship/%s: %v", r.Method, id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if update.SourceIDs != nil && !validSourceIDs(ctx, w, *update.SourceIDs) {
+		return
+	}
+
+	rel, err := db.UpdateRelationship(ctx, id, update)
+	if err == store.ErrNoSuchRelationship {
+		log.Printf("Relationship not found for ID: %s", id)
+		http.Error(w, "Relationship not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update relationship %s: %v", id, err)
+		http.Error(w, "Failed to update relationship: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, rel)
+}
+
+// DELETE /relationship/:id
+func handleRelationshipDelete(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/relationship/")
+	if id == "" || sub != "" {
+		log.Printf("Invalid relationship path: %s", r.URL.Path)
+		http.Error(w, "Relationship ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.DeleteRelationship(ctx, id); err != nil {
+		if err == store.ErrNoSuchRelationship {
+			log.Printf("Relationship not found for ID: %s", id)
+			http.Error(w, "Relationship not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to delete relationship %s: %v", id, err)
+		http.Error(w, "Failed to delete relationship: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// GET /graph
+// GET /graph?at=YYYY-MM-DD
 func handleGraph(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		log.Printf("Unsupported method %s for /graph", r.Method)
@@ -145,10 +631,22 @@ func handleGraph(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	filter := models.GraphFilter{At: r.URL.Query().Get("at")}
+	if filter.At != "" {
+		if _, err := time.Parse(time.DateOnly, filter.At); err != nil {
+			log.Printf("Invalid at in /graph: %s", filter.At)
+			http.Error(w, "Invalid at: use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	graph, err := database.GetGraph(ctx, driver)
+	graph, err := db.GetGraph(ctx, filter)
+	if err == nil {
+		graph, err = withSources(ctx, graph)
+	}
 	if err != nil {
 		log.Printf("Error fetching graph: %v", err)
 		http.Error(w, "Error fetching graph: "+err.Error(), http.StatusInternalServerError)
@@ -158,7 +656,7 @@ func handleGraph(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, graph)
 }
 
-// GET /persons
+// GET /persons?limit=&cursor=&sort=&order=&occupation=&has_twitter=&created_after=
 func handlePersons(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		log.Printf("Unsupported method %s for /persons", r.Method)
@@ -166,17 +664,90 @@ func handlePersons(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	query, err := parsePersonQuery(r)
+	if err != nil {
+		log.Printf("Invalid query in /persons: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	persons, err := database.GetPersons(ctx, driver)
+	page, err := db.ListPersons(ctx, query)
+	if err == store.ErrInvalidCursor {
+		log.Printf("Invalid cursor in /persons: %s", query.Cursor)
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("Error fetching persons: %v", err)
 		http.Error(w, "Error fetching persons: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	writeJSON(w, persons)
+	writeJSON(w, page)
+}
+
+// parsePersonQuery reads the paging, sorting and filtering parameters of
+// GET /persons.
+func parsePersonQuery(r *http.Request) (models.PersonQuery, error) {
+	params := r.URL.Query()
+	query := models.PersonQuery{
+		Cursor:     params.Get("cursor"),
+		Sort:       params.Get("sort"),
+		Order:      params.Get("order"),
+		Occupation: params.Get("occupation"),
+	}
+
+	var err error
+	query.Limit, err = parseLimit(params.Get("limit"), defaultPersonsLimit, maxPersonsLimit)
+	if err != nil {
+		return models.PersonQuery{}, fmt.Errorf("invalid limit: %w", err)
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = models.SortByName
+	case models.SortByName, models.SortByCreatedAt:
+	default:
+		return models.PersonQuery{}, fmt.Errorf("invalid sort %q: must be name or created_at", query.Sort)
+	}
+
+	switch query.Order {
+	case "":
+		query.Order = models.OrderAsc
+	case models.OrderAsc, models.OrderDesc:
+	default:
+		return models.PersonQuery{}, fmt.Errorf("invalid order %q: must be asc or desc", query.Order)
+	}
+
+	if value := params.Get("has_twitter"); value != "" {
+		hasTwitter, err := strconv.ParseBool(value)
+		if err != nil {
+			return models.PersonQuery{}, fmt.Errorf("invalid has_twitter %q: must be true or false", value)
+		}
+		query.HasTwitter = &hasTwitter
+	}
+
+	if value := params.Get("created_after"); value != "" {
+		createdAfter, err := parseTimestamp(value)
+		if err != nil {
+			return models.PersonQuery{}, fmt.Errorf("invalid created_after %q: use YYYY-MM-DD or RFC 3339", value)
+		}
+		query.CreatedAfter = createdAfter.Unix()
+	}
+
+	return query, nil
+}
+
+// parseTimestamp accepts either a date (YYYY-MM-DD, midnight UTC) or a full
+// RFC 3339 timestamp.
+func parseTimestamp(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
 
 // POST /register
@@ -203,8 +774,9 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Login, email, and password are required", http.StatusBadRequest)
 		return
 	}
+	auditUser(r, "", input.Login)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
@@ -214,17 +786,30 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role, err := newUserRole(ctx)
+	if err == errRegistrationClosed {
+		log.Printf("Registration closed, rejecting login=%s", input.Login)
+		http.Error(w, "Registration is closed", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		http.Error(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	user := models.User{
 		ID:       uuid.New().String(),
 		Login:    input.Login,
 		Email:    input.Email,
 		Password: string(hashedPassword),
+		Roles:    []string{role},
 	}
 
-	if err := database.AddUser(ctx, driver, user); err != nil {
-		if err == database.ErrUserExists {
+	if err := db.AddUser(ctx, user); err != nil {
+		if err == store.ErrUserExists {
 			log.Printf("User already exists: login=%s, email=%s", input.Login, input.Email)
-			http.Error(w, "User with this login or email already exists", http.StatusBadRequest)
+			http.Error(w, "User with this login or email already exists", http.StatusConflict)
 			return
 		}
 		log.Printf("Failed to register user: %v", err)
@@ -232,9 +817,39 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditUser(r, user.ID, user.Login)
+	auditTarget(r, "user", user.ID)
+
+	// The account exists either way; the user can ask for another link via
+	// /verify-email/resend.
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Login, err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
 
+var errRegistrationClosed = errors.New("registration is closed")
+
+// newUserRole returns the role to give a new account, or
+// errRegistrationClosed if REGISTRATION=closed forbids creating it.
+func newUserRole(ctx context.Context) (string, error) {
+	users, err := db.GetUsers(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(users) > 0 && os.Getenv("REGISTRATION") == "closed" {
+		return "", errRegistrationClosed
+	}
+
+	// The first user administers the installation; everyone else starts
+	// read-only until an admin grants them more.
+	if len(users) == 0 {
+		return models.RoleAdmin, nil
+	}
+	return models.RoleViewer, nil
+}
+
 // POST /login
 func handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -253,47 +868,88 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	user, err := database.GetUserByLogin(ctx, driver, input.Login)
+	auditUser(r, "", input.Login)
+	ip := clientIP(r)
+	if wait := loginGuard.wait(input.Login, ip, time.Now()); wait > 0 {
+		log.Printf("Throttling login attempt for %s from %s for %v", input.Login, ip, wait)
+		tooManyRequests(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+
+	user, err := db.GetUserByLogin(ctx, input.Login)
 	if err != nil {
 		log.Printf("Invalid login: %s", input.Login)
+		loginFailed(input.Login, ip)
 		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
 		return
 	}
 
+	auditUser(r, user.ID, user.Login)
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
 		log.Printf("Invalid password for login: %s", input.Login)
+		loginFailed(input.Login, ip)
 		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
 		return
 	}
+	if requireVerifiedEmail && !user.EmailVerified {
+		log.Printf("Refusing login of %s with unverified email", user.Login)
+		http.Error(w, "Please verify your email address first", http.StatusForbidden)
+		return
+	}
 
-	session := models.Session{
-		ID:        uuid.New().String(),
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+	// With two-factor authentication the password only earns a challenge
+	// to answer at /login/2fa.
+	if user.TOTPEnabled {
+		challenge, err := newOneTimeToken(ctx, user.ID, models.PurposeLoginChallenge, loginChallengeTTL)
+		if err != nil {
+			log.Printf("Error creating login challenge for user %s: %v", user.ID, err)
+			http.Error(w, "Error creating login challenge: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Password accepted for %s, awaiting second factor", user.Login)
+		writeJSON(w, struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+		}{true, challenge})
+		return
+	}
+
+	startSession(ctx, w, r, user)
+}
+
+// startSession signs the user in once all factors are verified, answering
+// with the CSRF token of the new session.
+func startSession(ctx context.Context, w http.ResponseWriter, r *http.Request, user models.User) {
+	session, ok := signIn(ctx, w, r, user)
+	if !ok {
+		return
 	}
-	if err := database.CreateSession(ctx, driver, session); err != nil {
+	writeJSON(w, struct {
+		CSRFToken string `json:"csrf_token"`
+	}{csrfToken(session.ID)})
+}
+
+// signIn creates a session for the user and sets its cookie, writing the
+// error response itself when ok is false.
+func signIn(ctx context.Context, w http.ResponseWriter, r *http.Request, user models.User) (session models.Session, ok bool) {
+	loginGuard.succeed(user.Login)
+	auditUser(r, user.ID, user.Login)
+
+	session = newSession(r, user.ID)
+	if err := db.CreateSession(ctx, session); err != nil {
 		log.Printf("Error creating session for user %s: %v", user.ID, err)
 		http.Error(w, "Error creating session: "+err.Error(), http.StatusInternalServerError)
-		return
+		return models.Session{}, false
 	}
 
 	log.Printf("Session created: session_id=%s, user_id=%s, expires_at=%d", session.ID, user.ID, session.ExpiresAt)
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    session.ID,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode, // Changed to Lax for better compatibility
-		// Secure: true, // Uncomment in production with HTTPS
-	})
+	setSessionCookie(w, session)
 
 	log.Printf("User logged in: %s, cookie set with session_id=%s", user.Login, session.ID)
-	w.WriteHeader(http.StatusOK)
+	return session, true
 }
 
 // POST /logout
@@ -304,7 +960,7 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	sessionID, err := r.Cookie("session_id")
@@ -314,7 +970,10 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.DeleteSession(ctx, driver, sessionID.Value); err != nil {
+	if session, err := db.GetSession(ctx, sessionID.Value); err == nil {
+		auditUser(r, session.UserID, "")
+	}
+	if err := db.DeleteSession(ctx, sessionID.Value); err != nil {
 		log.Printf("Error logging out for session %s: %v", sessionID.Value, err)
 		http.Error(w, "Error logging out: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -341,65 +1000,149 @@ func handleCheckSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	sessionID, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("No session_id cookie in /check-session")
-		http.Error(w, "No session", http.StatusUnauthorized)
-		return
-	}
-
-	log.Printf("Checking session: session_id=%s", sessionID.Value)
-
-	session, err := database.GetSession(ctx, driver, sessionID.Value)
-	if err != nil || session.ExpiresAt < time.Now().Unix() {
-		log.Printf("Session inactive or expired: session_id=%s, error: %v", sessionID.Value, err)
-		http.Error(w, "Session inactive or expired", http.StatusUnauthorized)
+	session, ok := activeSession(ctx, w, r)
+	if !ok {
 		return
 	}
 
-	user, err := database.GetUserByID(ctx, driver, session.UserID)
+	user, err := db.GetUserByID(ctx, session.UserID)
 	if err != nil {
-		log.Printf("User not found for session %s: %v", sessionID.Value, err)
+		log.Printf("User not found for session %s: %v", session.ID, err)
 		http.Error(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Session valid: session_id=%s, user=%s", sessionID.Value, user.Login)
+	log.Printf("Session valid: session_id=%s, user=%s", session.ID, user.Login)
 
 	writeJSON(w, struct {
-		Login string `json:"login"`
-	}{Login: user.Login})
+		Login       string   `json:"login"`
+		Roles       []string `json:"roles"`
+		TOTPEnabled bool     `json:"totp_enabled"`
+		CSRFToken   string   `json:"csrf_token"`
+	}{Login: user.Login, Roles: user.Roles, TOTPEnabled: user.TOTPEnabled, CSRFToken: csrfToken(session.ID)})
 }
 
-// Middleware to require authentication
-func requireAuth(next http.Handler) http.Handler {
+type (
+	userKey  struct{}
+	tokenKey struct{}
+)
+
+// requireRole only lets through requests from a signed-in user holding role
+// or a more privileged one, authenticated by a bearer API token or the
+// session cookie. next can read the user with currentUser, and its writes are
+// attributed to the user in the revision history. While the admins require
+// two-factor authentication, editors and above who have not enabled it only
+// get through to /2fa/.
+func requireRole(role string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		sessionID, err := r.Cookie("session_id")
+		user, token, ok := authenticate(ctx, w, r)
+		if !ok {
+			return
+		}
+		required, err := twoFactorRequired(ctx, user)
 		if err != nil {
-			log.Printf("No session_id cookie in request: %s", r.URL.Path)
-			http.Error(w, "Login required", http.StatusUnauthorized)
+			log.Printf("Error fetching settings: %v", err)
+			http.Error(w, "Error fetching settings: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		session, err := database.GetSession(ctx, driver, sessionID.Value)
-		if err != nil || session.ExpiresAt < time.Now().Unix() {
-			log.Printf("Session inactive or expired for ID %s: %v", sessionID.Value, err)
-			http.Error(w, "Session inactive or expired", http.StatusUnauthorized)
+		if required && !strings.HasPrefix(r.URL.Path, "/2fa/") {
+			log.Printf("User %s has not enrolled in two-factor authentication for %s %s", user.Login, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: your role requires two-factor authentication, enroll with /2fa/enroll first", http.StatusForbidden)
+			return
+		}
+		if !user.HasRole(role) {
+			log.Printf("User %s lacks role %s for %s %s", user.Login, role, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: requires the "+role+" role", http.StatusForbidden)
+			return
+		}
+		if token != nil && !token.Permits(role, r.Method) {
+			log.Printf("Token %s of %s lacks the scope for %s %s", token.ID, user.Login, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden: token scope does not allow this request", http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		auditUser(r, user.ID, user.Login)
+		userCtx := context.WithValue(store.WithAuthor(r.Context(), user.ID), userKey{}, user)
+		if token != nil {
+			userCtx = context.WithValue(userCtx, tokenKey{}, *token)
+		}
+		next.ServeHTTP(w, r.WithContext(userCtx))
 	})
 }
 
+// authenticate identifies the user behind a request from its bearer token
+// or, failing that, its session cookie. The token is nil for cookie
+// sessions. It writes the 401 response itself when ok is false.
+func authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request) (user models.User, token *models.APIToken, ok bool) {
+	var userID string
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		apiToken, err := db.GetTokenByHash(ctx, hashToken(bearer))
+		if err != nil || apiToken.ExpiresAt < time.Now().Unix() {
+			log.Printf("Invalid or expired API token for %s: %v", r.URL.Path, err)
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return models.User{}, nil, false
+		}
+		if err := db.TouchToken(ctx, apiToken.ID, time.Now().Unix()); err != nil {
+			log.Printf("Error recording use of token %s: %v", apiToken.ID, err)
+		}
+		userID, token = apiToken.UserID, &apiToken
+	} else {
+		session, ok := activeSession(ctx, w, r)
+		if !ok {
+			return models.User{}, nil, false
+		}
+		userID = session.UserID
+	}
+
+	user, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("User %s not found: %v", userID, err)
+		http.Error(w, "Session inactive or expired", http.StatusUnauthorized)
+		return models.User{}, nil, false
+	}
+	return user, token, true
+}
+
+// requireAuth lets through any signed-in user; handlers decide what the
+// user's roles allow.
+func requireAuth(next http.Handler) http.Handler {
+	return requireRole(models.RoleViewer, next)
+}
+
+// currentUser returns the user authenticated by requireRole.
+func currentUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(userKey{}).(models.User)
+	return user, ok
+}
+
+// currentToken returns the API token the request was authenticated with, if
+// any.
+func currentToken(r *http.Request) (models.APIToken, bool) {
+	token, ok := r.Context().Value(tokenKey{}).(models.APIToken)
+	return token, ok
+}
+
+// resourcePath splits a path like /person/:id/relationships into the ID and
+// the remaining sub-resource ("relationships"), both without slashes.
+func resourcePath(path, prefix string) (id, sub string) {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	id, sub, _ = strings.Cut(rest, "/")
+	return id, sub
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}) {
+	writeJSONStatus(w, http.StatusOK, data)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		log.Printf("Error encoding JSON: %v", err)
 		http.Error(w, "Error encoding JSON: "+err.Error(), http.StatusInternalServerError)
@@ -424,9 +1167,10 @@ func enableCORS(next http.Handler) http.Handler {
 
 		if allowOrigin != "" {
 			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+csrfHeader)
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
 		}
 
 		log.Printf("CORS: Origin=%s, AllowOrigin=%s", origin, allowOrigin)
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"establishment/v1/establishment/mail"
+	"establishment/v1/establishment/memory"
+	"establishment/v1/establishment/models"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// testServer serves the API from a fresh memory store. Its clients each
+// come from their own IP address, so that they are throttled and rate
+// limited independently.
+type testServer struct {
+	*httptest.Server
+	t      *testing.T
+	lastIP atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newLimitedTestServer(t, nil, nil)
+}
+
+// newLimitedTestServer serves the API with the given rate limiters.
+func newLimitedTestServer(t *testing.T, apiLimiter, authLimiter *rateLimiter) *testServer {
+	t.Helper()
+	db = memory.NewStore()
+	loginGuard = newLoginThrottle(defaultLoginMaxFailures, defaultLoginLockout)
+	mailer = mail.LogMailer{}
+	requireVerifiedEmail = false
+	oidcProvider = nil
+	trustProxy = true
+
+	s := &testServer{Server: httptest.NewServer(newRouter(apiLimiter, authLimiter)), t: t}
+	publicURL = s.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// testClient is a browser talking to a testServer.
+type testClient struct {
+	t      *testing.T
+	server *testServer
+	http   *http.Client
+	ip     string
+	// csrf is sent as the X-CSRF-Token header, and bearer as an API token,
+	// when set.
+	csrf   string
+	bearer string
+}
+
+func (s *testServer) client() *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return &testClient{
+		t:      s.t,
+		server: s,
+		http: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ip: fmt.Sprintf("192.0.2.%d", s.lastIP.Add(1)),
+	}
+}
+
+// do sends body as JSON, unless it is nil, and returns the response with
+// its body read.
+func (c *testClient) do(method, path string, body any) (*http.Response, string) {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("X-Forwarded-For", c.ip)
+	if c.csrf != "" {
+		req.Header.Set(csrfHeader, c.csrf)
+	}
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+// expect sends a request like do and fails the test unless it is answered
+// with status. It decodes the JSON response into out if out is not nil.
+func (c *testClient) expect(status int, method, path string, body, out any) {
+	c.t.Helper()
+	resp, data := c.do(method, path, body)
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s = %d %q, want %d", method, path, resp.StatusCode, data, status)
+	}
+	if out != nil {
+		if err := json.Unmarshal([]byte(data), out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func password(login string) string { return "secret-" + login }
+
+// register creates an account, which is an admin for the first user of the
+// server and a viewer for the others, and returns its ID.
+func (s *testServer) register(login string) string {
+	s.t.Helper()
+	s.client().expect(http.StatusCreated, http.MethodPost, "/register",
+		map[string]string{"login": login, "email": login + "@example.com", "password": password(login)}, nil)
+	user, err := db.GetUserByLogin(context.Background(), login)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user.ID
+}
+
+// login signs the client in with a password as a user without two-factor
+// authentication.
+func (c *testClient) login(login string) {
+	c.t.Helper()
+	var out struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	c.expect(http.StatusOK, http.MethodPost, "/login", map[string]string{"login": login, "password": password(login)}, &out)
+	if out.CSRFToken == "" {
+		c.t.Fatalf("login of %s returned no CSRF token", login)
+	}
+	c.csrf = out.CSRFToken
+}
+
+// signUp registers a user with role, granted by admin unless empty, and
+// returns a client signed in as the user.
+func (s *testServer) signUp(login, role string, admin *testClient) *testClient {
+	s.t.Helper()
+	id := s.register(login)
+	if role != "" {
+		admin.expect(http.StatusOK, http.MethodPost, "/admin/users/"+id+"/roles", map[string]string{"role": role}, nil)
+	}
+	c := s.client()
+	c.login(login)
+	return c
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp("admin", "", nil)
+	var token struct {
+		Token string `json:"token"`
+	}
+	admin.expect(http.StatusCreated, http.MethodPost, "/tokens", map[string]any{"name": "script", "scopes": []string{models.ScopeWrite}}, &token)
+	other := s.client()
+	other.login("admin")
+
+	tests := []struct {
+		name   string
+		client *testClient
+		csrf   string
+		bearer string
+		want   int
+	}{
+		{"session token", admin, admin.csrf, "", http.StatusCreated},
+		{"no token", admin, "", "", http.StatusForbidden},
+		{"wrong token", admin, "wrong", "", http.StatusForbidden},
+		{"token of another session", admin, other.csrf, "", http.StatusForbidden},
+		{"bearer token", admin, "", token.Token, http.StatusCreated},
+		{"no session", s.client(), "", "", http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		c := *tt.client
+		c.csrf, c.bearer = tt.csrf, tt.bearer
+		person := models.Person{ID: "p" + strconv.Itoa(i), Name: tt.name}
+		if resp, body := c.do(http.MethodPost, "/person", person); resp.StatusCode != tt.want {
+			t.Errorf("%s: POST /person = %d %q, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	// Reads and logins need no token.
+	c := *admin
+	c.csrf = ""
+	c.expect(http.StatusOK, http.MethodGet, "/check-session", nil, nil)
+	c.expect(http.StatusOK, http.MethodPost, "/login", map[string]string{"login": "admin", "password": password("admin")}, nil)
+}
+
+// sessions lists the sessions of the client's user.
+func (c *testClient) sessions() []sessionInfo {
+	c.t.Helper()
+	var infos []sessionInfo
+	c.expect(http.StatusOK, http.MethodGet, "/sessions", nil, &infos)
+	return infos
+}
+
+// otherSession returns the ID of the only session listed by c that is not
+// its own.
+func (c *testClient) otherSession() string {
+	c.t.Helper()
+	var other []string
+	for _, info := range c.sessions() {
+		if !info.Current {
+			other = append(other, info.ID)
+		}
+	}
+	if len(other) != 1 {
+		c.t.Fatalf("found %d other sessions, want 1", len(other))
+	}
+	return other[0]
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t)
+	laptop := s.signUp("alice", "", nil)
+	phone := s.client()
+	phone.login("alice")
+	stranger := s.signUp("bob", "", nil)
+
+	infos := laptop.sessions()
+	current := 0
+	for _, info := range infos {
+		if info.Current {
+			current++
+		}
+		if info.IP != laptop.ip && info.IP != phone.ip {
+			t.Errorf("session %s has IP %s", info.ID, info.IP)
+		}
+	}
+	if len(infos) != 2 || current != 1 {
+		t.Fatalf("sessions = %+v, want two with one current", infos)
+	}
+
+	// Sessions of other users cannot be revoked.
+	phoneSession := laptop.otherSession()
+	stranger.expect(http.StatusNotFound, http.MethodDelete, "/session/"+phoneSession, nil, nil)
+	stranger.expect(http.StatusNotFound, http.MethodDelete, "/session/unknown", nil, nil)
+	phone.expect(http.StatusOK, http.MethodGet, "/check-session", nil, nil)
+
+	laptop.expect(http.StatusNoContent, http.MethodDelete, "/session/"+phoneSession, nil, nil)
+	phone.expect(http.StatusUnauthorized, http.MethodGet, "/check-session", nil, nil)
+
+	phone.login("alice")
+	var out struct {
+		Revoked int64 `json:"revoked"`
+	}
+	laptop.expect(http.StatusOK, http.MethodDelete, "/sessions", nil, &out)
+	if out.Revoked != 1 {
+		t.Errorf("revoked %d sessions, want 1", out.Revoked)
+	}
+	phone.expect(http.StatusUnauthorized, http.MethodGet, "/check-session", nil, nil)
+	laptop.expect(http.StatusOK, http.MethodGet, "/check-session", nil, nil)
+	stranger.expect(http.StatusOK, http.MethodGet, "/check-session", nil, nil)
+
+	// API tokens cannot manage sessions.
+	var token struct {
+		Token string `json:"token"`
+	}
+	laptop.expect(http.StatusCreated, http.MethodPost, "/tokens", map[string]any{"name": "script", "scopes": []string{models.ScopeAdmin}}, &token)
+	script := s.client()
+	script.bearer = token.Token
+	script.expect(http.StatusForbidden, http.MethodGet, "/sessions", nil, nil)
+}
+
+func TestLoginThrottle(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("bob")
+	guesser := s.client()
+	wrong := map[string]string{"login": "alice", "password": "guess"}
+
+	for i := 0; i <= freeLoginAttempts; i++ {
+		guesser.expect(http.StatusUnauthorized, http.MethodPost, "/login", wrong, nil)
+	}
+	tests := []struct {
+		name   string
+		client *testClient
+		login  string
+	}{
+		{"right password", guesser, "alice"},
+		{"same login from elsewhere", s.client(), "alice"},
+		{"other login from the same IP", guesser, "bob"},
+	}
+	for _, tt := range tests {
+		resp, body := tt.client.do(http.MethodPost, "/login", map[string]string{"login": tt.login, "password": password(tt.login)})
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("%s: POST /login = %d %q with Retry-After %q, want 429 after 1s", tt.name, resp.StatusCode, body, resp.Header.Get("Retry-After"))
+		}
+	}
+	s.client().login("bob")
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle := newLoginThrottle(6, time.Hour)
+	start := time.Unix(1_000_000, 0)
+	tests := []struct {
+		// after is the time of the failure since start.
+		after time.Duration
+		// wait is the wait for the login after the failure.
+		wait   time.Duration
+		locked bool
+	}{
+		{0, 0, false},
+		{time.Second, 0, false},
+		{2 * time.Second, 0, false},
+		{3 * time.Second, time.Second, false},
+		{5 * time.Second, 2 * time.Second, false},
+		{10 * time.Second, time.Hour, true},
+	}
+	for i, tt := range tests {
+		now := start.Add(tt.after)
+		if locked := throttle.fail("alice", "192.0.2.1", now); locked != tt.locked {
+			t.Errorf("failure %d: locked = %v, want %v", i+1, locked, tt.locked)
+		}
+		if wait := throttle.wait("alice", "192.0.2.2", now); wait != tt.wait {
+			t.Errorf("failure %d: wait = %v, want %v", i+1, wait, tt.wait)
+		}
+	}
+
+	throttle.succeed("alice")
+	if wait := throttle.wait("alice", "192.0.2.2", start.Add(10*time.Second)); wait != 0 {
+		t.Errorf("wait after success = %v, want 0", wait)
+	}
+	if wait := throttle.wait("bob", "192.0.2.1", start.Add(10*time.Second)); wait != 4*time.Second {
+		t.Errorf("wait of the guessing IP = %v, want %v", wait, 4*time.Second)
+	}
+	if wait := throttle.wait("bob", "192.0.2.1", start.Add(2*time.Hour)); wait != 0 {
+		t.Errorf("wait once the lockout passed = %v, want 0", wait)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newLimitedTestServer(t,
+		newRateLimiter(rateLimit{requests: 4, period: time.Minute}),
+		newRateLimiter(rateLimit{requests: 2, period: time.Minute}))
+	c := s.client()
+	wrong := map[string]string{"login": "nobody", "password": "guess"}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodPost, "/login", http.StatusUnauthorized},
+		{http.MethodPost, "/login", http.StatusUnauthorized},
+		{http.MethodPost, "/login", http.StatusTooManyRequests},
+		{http.MethodGet, "/persons", http.StatusOK},
+		{http.MethodGet, "/persons", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		var body any
+		if tt.method == http.MethodPost {
+			body = wrong
+		}
+		resp, data := c.do(tt.method, tt.path, body)
+		if resp.StatusCode != tt.want {
+			t.Errorf("request %d: %s %s = %d %q, want %d", i+1, tt.method, tt.path, resp.StatusCode, data, tt.want)
+		}
+		if tt.want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+			t.Errorf("request %d: no Retry-After header", i+1)
+		}
+	}
+	s.client().expect(http.StatusOK, http.MethodGet, "/persons", nil, nil)
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(rateLimit{requests: 2, period: 2 * time.Second})
+	start := time.Unix(1_000_000, 0)
+	tests := []struct {
+		after time.Duration
+		wait  time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, time.Second},
+		{500 * time.Millisecond, 500 * time.Millisecond},
+		{time.Second, 0},
+		{time.Second, time.Second},
+		{10 * time.Second, 0},
+		{10 * time.Second, 0},
+		{10 * time.Second, time.Second},
+	}
+	for i, tt := range tests {
+		if wait := limiter.take("192.0.2.1", start.Add(tt.after)); wait != tt.wait {
+			t.Errorf("request %d: wait = %v, want %v", i+1, wait, tt.wait)
+		}
+	}
+	if newRateLimiter(rateLimit{}) != nil {
+		t.Error("a zero limit returned a limiter")
+	}
+}
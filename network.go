@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+const (
+	defaultNetworkDepth = 1
+	// maxNetworkDepth keeps public network requests cheap: ego networks
+	// grow with the degree to the power of the depth, and beyond a few
+	// hops cover most of the graph anyway.
+	maxNetworkDepth = 3
+)
+
+// GET /person/:id/network?depth=&types=&direction=
+func handlePersonNetwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /person/:id/network", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, _ := resourcePath(r.URL.Path, "/person/")
+	if id == "" {
+		log.Printf("No person ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Person ID required", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseNetworkQuery(id, r)
+	if err != nil {
+		log.Printf("Invalid network query for person %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	graph, err := db.GetNetwork(ctx, query)
+	if err == nil {
+		graph, err = withSources(ctx, graph)
+	}
+	if err == store.ErrNoSuchPerson {
+		log.Printf("Person not found for ID: %s", id)
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching network for person %s: %v", id, err)
+		http.Error(w, "Error fetching network: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, graph)
+}
+
+// parseNetworkQuery reads the depth, types and direction query parameters.
+func parseNetworkQuery(personID string, r *http.Request) (models.NetworkQuery, error) {
+	params := r.URL.Query()
+	query := models.NetworkQuery{
+		PersonID:  personID,
+		Types:     parseList(params.Get("types")),
+		Direction: params.Get("direction"),
+	}
+
+	switch query.Direction {
+	case "":
+		query.Direction = models.DirectionBoth
+	case models.DirectionOut, models.DirectionIn, models.DirectionBoth:
+	default:
+		return models.NetworkQuery{}, fmt.Errorf("invalid direction %q: must be out, in or both", query.Direction)
+	}
+
+	depth, err := parseDepth(params.Get("depth"), defaultNetworkDepth, maxNetworkDepth)
+	if err != nil {
+		return models.NetworkQuery{}, fmt.Errorf("invalid depth: %w", err)
+	}
+	query.Depth = depth
+	return query, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/oidc"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+const (
+	// oidcFlowCookie carries the state, nonce and PKCE verifier of a
+	// sign-in from /oidc/login to /oidc/callback.
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+	// maxLoginSuffix bounds the attempts to find a free login for a new
+	// user, which are tried as login, login-2, login-3 and so on.
+	maxLoginSuffix = 20
+)
+
+var (
+	errNoOIDCEmail = errors.New("the identity provider did not share an email address")
+	errNoFreeLogin = errors.New("no free login")
+)
+
+// newOIDCProviderFromEnv configures sign-in with the OpenID Connect provider
+// at OIDC_ISSUER, registered with OIDC_CLIENT_ID and, for confidential
+// clients, OIDC_CLIENT_SECRET. The provider must redirect back to
+// OIDC_REDIRECT_URL, which defaults to /oidc/callback under PUBLIC_URL. It
+// returns nil if OIDC_ISSUER is not set.
+func newOIDCProviderFromEnv() (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = publicURL + "/oidc/callback"
+	}
+	return &oidc.Provider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// GET /oidc/login
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /oidc/login", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if oidcProvider == nil {
+		http.Error(w, "Sign-in with an identity provider is not configured", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var flow [3]string
+	for i := range flow {
+		value, err := oidc.RandomString()
+		if err != nil {
+			log.Printf("Error generating OIDC state: %v", err)
+			http.Error(w, "Error starting sign-in: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		flow[i] = value
+	}
+	state, nonce, verifier := flow[0], flow[1], flow[2]
+
+	authURL, err := oidcProvider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error contacting identity provider: %v", err)
+		http.Error(w, "Error contacting identity provider", http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    strings.Join(flow[:], "."),
+		Path:     "/oidc/",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		// Lax lets the cookie come back with the provider's redirect.
+		SameSite: http.SameSiteLaxMode,
+		Secure:   strings.HasPrefix(publicURL, "https://"),
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET /oidc/callback
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /oidc/callback", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if oidcProvider == nil {
+		http.Error(w, "Sign-in with an identity provider is not configured", http.StatusNotFound)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/oidc/", MaxAge: -1, HttpOnly: true})
+	if err != nil {
+		log.Printf("No %s cookie in /oidc/callback", oidcFlowCookie)
+		http.Error(w, "Sign-in expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		log.Printf("Identity provider refused sign-in: %s: %s", reason, query.Get("error_description"))
+		http.Error(w, "Sign-in was refused by the identity provider: "+reason, http.StatusUnauthorized)
+		return
+	}
+	flow := strings.Split(cookie.Value, ".")
+	if len(flow) != 3 || subtle.ConstantTimeCompare([]byte(flow[0]), []byte(query.Get("state"))) != 1 {
+		log.Printf("OIDC state mismatch in /oidc/callback")
+		http.Error(w, "Sign-in expired, please try again", http.StatusBadRequest)
+		return
+	}
+	nonce, verifier := flow[1], flow[2]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, err := oidcProvider.Exchange(ctx, query.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		http.Error(w, "Sign-in with the identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := oidcUser(ctx, r, claims)
+	switch {
+	case err == errRegistrationClosed:
+		log.Printf("Registration closed, rejecting OIDC subject %s", claims.Subject)
+		http.Error(w, "Registration is closed", http.StatusForbidden)
+		return
+	case err == errNoOIDCEmail:
+		log.Printf("No email for OIDC subject %s", claims.Subject)
+		http.Error(w, "The identity provider did not share your email address", http.StatusForbidden)
+		return
+	case err == store.ErrUserExists:
+		log.Printf("OIDC subject %s conflicts with an existing user (email %s)", claims.Subject, claims.Email)
+		http.Error(w, "An account with this email address already exists; log in with your password first to link it", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error finding user for OIDC subject %s: %v", claims.Subject, err)
+		http.Error(w, "Error signing in: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The provider stands in for the password only. Users with two-factor
+	// authentication still answer a challenge at /login/2fa, which the
+	// login page takes from the fragment, never sent to the server.
+	if user.TOTPEnabled {
+		challenge, err := newOneTimeToken(ctx, user.ID, models.PurposeLoginChallenge, loginChallengeTTL)
+		if err != nil {
+			log.Printf("Error creating login challenge for user %s: %v", user.ID, err)
+			http.Error(w, "Error creating login challenge: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auditUser(r, user.ID, user.Login)
+		log.Printf("OIDC sign-in accepted for %s, awaiting second factor", user.Login)
+		http.Redirect(w, r, publicURL+"/login.html#challenge_token="+url.QueryEscape(challenge), http.StatusFound)
+		return
+	}
+	if _, ok := signIn(ctx, w, r, user); !ok {
+		return
+	}
+	redirect := os.Getenv("OIDC_POST_LOGIN_URL")
+	if redirect == "" {
+		redirect = publicURL + "/backend.html"
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcUser returns the user to sign in for an OpenID Connect account. An
+// account seen before maps to the user it was linked to. Otherwise it is
+// linked to the user signed in with r, if any, or else a new user is
+// created. It returns ErrUserExists if a user who is not signed in already
+// has the account's email address.
+func oidcUser(ctx context.Context, r *http.Request, claims oidc.Claims) (models.User, error) {
+	identity := claims.Issuer + " " + claims.Subject
+	user, err := db.GetUserByOIDCIdentity(ctx, identity)
+	if err != store.ErrNoSuchUser {
+		return user, err
+	}
+
+	// Accounts are only linked from a session, which proves the user owns
+	// the local account too. Email addresses prove nothing: local ones may
+	// never have been verified, and any provider may claim to have verified
+	// any address.
+	user, err = signedInUser(ctx, r)
+	if err == store.ErrNoSuchUser && claims.Email != "" {
+		if _, err := db.GetUserByEmail(ctx, claims.Email); err == nil {
+			return models.User{}, store.ErrUserExists
+		} else if err != store.ErrNoSuchUser {
+			return models.User{}, err
+		}
+	}
+	if err == nil {
+		log.Printf("Linking OIDC subject %s to user %s", claims.Subject, user.Login)
+		if err := db.SetOIDCIdentity(ctx, user.ID, identity); err != nil {
+			return models.User{}, err
+		}
+		user.OIDCIdentity = identity
+		return user, nil
+	}
+	if err != store.ErrNoSuchUser {
+		return models.User{}, err
+	}
+
+	if claims.Email == "" {
+		return models.User{}, errNoOIDCEmail
+	}
+	role, err := newUserRole(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+	login, err := freeLogin(ctx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+	// Without a password hash the user can only sign in through the
+	// provider, until they set a password with /forgot-password.
+	user = models.User{
+		ID:            uuid.New().String(),
+		Login:         login,
+		Email:         claims.Email,
+		Roles:         []string{role},
+		EmailVerified: claims.EmailVerified,
+		OIDCIdentity:  identity,
+	}
+	if err := db.AddUser(ctx, user); err != nil {
+		return models.User{}, err
+	}
+	log.Printf("Created user %s for OIDC subject %s", user.Login, claims.Subject)
+	return user, nil
+}
+
+// signedInUser returns the user of the unexpired session sent with r, or
+// ErrNoSuchUser if there is none.
+func signedInUser(ctx context.Context, r *http.Request) (models.User, error) {
+	sessionID := currentSessionID(r)
+	if sessionID == "" {
+		return models.User{}, store.ErrNoSuchUser
+	}
+	session, err := db.GetSession(ctx, sessionID)
+	if err != nil || session.ExpiresAt < time.Now().Unix() {
+		return models.User{}, store.ErrNoSuchUser
+	}
+	return db.GetUserByID(ctx, session.UserID)
+}
+
+// freeLogin picks an unused login for a new user from the provider's
+// preferred username or, failing that, the email address.
+func freeLogin(ctx context.Context, claims oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	for i := 1; i <= maxLoginSuffix; i++ {
+		login := base
+		if i > 1 {
+			login += "-" + strconv.Itoa(i)
+		}
+		_, err := db.GetUserByLogin(ctx, login)
+		if err == store.ErrNoSuchUser {
+			return login, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errNoFreeLogin
+}
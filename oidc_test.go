@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"establishment/v1/establishment/oidc"
+	"establishment/v1/establishment/store"
+)
+
+const testClientID = "establishment"
+
+// testProvider is an OpenID Connect provider that signs in as whoever the
+// test says, enforcing PKCE like a real one.
+type testProvider struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]testGrant
+}
+
+// testGrant is an issued authorization code waiting to be redeemed.
+type testGrant struct {
+	challenge string
+	claims    map[string]any
+}
+
+// newTestProvider starts a provider and configures s to sign in with it.
+func newTestProvider(t *testing.T, s *testServer) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{t: t, key: key, grants: make(map[string]testGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	oidcProvider = &oidc.Provider{
+		Issuer:      p.URL,
+		ClientID:    testClientID,
+		RedirectURL: s.URL + "/oidc/callback",
+		Client:      p.Client(),
+	}
+	return p
+}
+
+func (p *testProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *testProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func (p *testProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge || r.PostForm.Get("client_id") != testClientID {
+		writeJSONStatus(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(g.claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]string{"id_token": signed + "." + base64.RawURLEncoding.EncodeToString(signature)})
+}
+
+// signIn takes the client through /oidc/login and back to /oidc/callback as
+// the provider's user with the given subject and email address, and returns
+// the callback's response.
+func (p *testProvider) signIn(c *testClient, subject, email string) (*http.Response, string) {
+	p.t.Helper()
+	resp, body := c.do(http.MethodGet, "/oidc/login", nil)
+	if resp.StatusCode != http.StatusFound {
+		p.t.Fatalf("GET /oidc/login = %d %q", resp.StatusCode, body)
+	}
+	authURL, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := authURL.Query()
+	if authURL.Path != "/authorize" || query.Get("code_challenge_method") != "S256" || query.Get("state") == "" {
+		p.t.Fatalf("GET /oidc/login redirected to %s", authURL)
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.grants[code] = testGrant{
+		challenge: query.Get("code_challenge"),
+		claims: map[string]any{
+			"iss":            p.URL,
+			"aud":            testClientID,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"nonce":          query.Get("nonce"),
+			"sub":            subject,
+			"email":          email,
+			"email_verified": true,
+		},
+	}
+	p.mu.Unlock()
+
+	params := url.Values{"code": {code}, "state": {query.Get("state")}}
+	return c.do(http.MethodGet, "/oidc/callback?"+params.Encode(), nil)
+}
+
+// expectSignedIn fails the test unless the client has a session as login.
+func (c *testClient) expectSignedIn(login string) {
+	c.t.Helper()
+	var session struct {
+		Login string `json:"login"`
+	}
+	c.expect(http.StatusOK, http.MethodGet, "/check-session", nil, &session)
+	if session.Login != login {
+		c.t.Errorf("signed in as %q, want %q", session.Login, login)
+	}
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	s := newTestServer(t)
+	p := newTestProvider(t, s)
+	s.register("admin")
+	bob := s.signUp("bob", "", nil)
+
+	// A new account gets a new user.
+	c := s.client()
+	if resp, body := p.signIn(c, "carol-sub", "carol@example.com"); resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != publicURL+"/backend.html" {
+		t.Fatalf("new account: callback = %d %q to %s", resp.StatusCode, body, resp.Header.Get("Location"))
+	}
+	c.expectSignedIn("carol")
+
+	// An email address alone does not link an account to a user.
+	c = s.client()
+	if resp, body := p.signIn(c, "mallory-sub", "bob@example.com"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("email of another user: callback = %d %q, want 409", resp.StatusCode, body)
+	}
+	c.expect(http.StatusUnauthorized, http.MethodGet, "/check-session", nil, nil)
+	if _, err := db.GetUserByOIDCIdentity(context.Background(), p.URL+" mallory-sub"); err != store.ErrNoSuchUser {
+		t.Errorf("account was linked without a session: %v", err)
+	}
+
+	// A session does, whatever the email address.
+	if resp, body := p.signIn(bob, "bob-sub", "robert@example.org"); resp.StatusCode != http.StatusFound {
+		t.Fatalf("signed-in user: callback = %d %q", resp.StatusCode, body)
+	}
+	c = s.client()
+	p.signIn(c, "bob-sub", "robert@example.org")
+	c.expectSignedIn("bob")
+
+	// A forged state is refused.
+	c = s.client()
+	c.do(http.MethodGet, "/oidc/login", nil)
+	c.expect(http.StatusBadRequest, http.MethodGet, "/oidc/callback?code=x&state=forged", nil, nil)
+}
+
+func TestOIDCSignInTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	p := newTestProvider(t, s)
+	alice := s.signUp("alice", "", nil)
+	secret, counter, _ := alice.enableTwoFactor()
+	p.signIn(alice, "alice-sub", "alice@example.com")
+
+	// The provider only stands in for the password.
+	c := s.client()
+	resp, body := p.signIn(c, "alice-sub", "alice@example.com")
+	location := resp.Header.Get("Location")
+	prefix := publicURL + "/login.html#challenge_token="
+	if resp.StatusCode != http.StatusFound || !strings.HasPrefix(location, prefix) {
+		t.Fatalf("callback = %d %q to %s, want a redirect to the challenge", resp.StatusCode, body, location)
+	}
+	c.expect(http.StatusUnauthorized, http.MethodGet, "/check-session", nil, nil)
+
+	challenge, err := url.QueryUnescape(strings.TrimPrefix(location, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := map[string]string{"challenge_token": challenge, "code": totpCode(t, secret, counter+1)}
+	c.expect(http.StatusOK, http.MethodPost, "/login/2fa", input, nil)
+	c.expectSignedIn("alice")
+}
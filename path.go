@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+const defaultPathDepth = 6
+
+// GET /path?from=&to=&max_depth=&types=&all=
+func handlePath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /path", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := models.PathQuery{
+		From:  params.Get("from"),
+		To:    params.Get("to"),
+		Types: parseList(params.Get("types")),
+	}
+	if query.From == "" || query.To == "" {
+		log.Printf("Missing from or to in /path: %s", r.URL.RawQuery)
+		http.Error(w, "Both from and to are required", http.StatusBadRequest)
+		return
+	}
+	if query.From == query.To {
+		log.Printf("Same from and to in /path: %s", query.From)
+		http.Error(w, "from and to must be different", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	query.MaxDepth, err = parseDepth(params.Get("max_depth"), defaultPathDepth, store.MaxTraversalDepth)
+	if err != nil {
+		log.Printf("Invalid max_depth in /path: %v", err)
+		http.Error(w, "Invalid max_depth: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if all := params.Get("all"); all != "" {
+		query.All, err = strconv.ParseBool(all)
+		if err != nil {
+			log.Printf("Invalid all in /path: %s", all)
+			http.Error(w, "Invalid all: must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := db.ShortestPaths(ctx, query)
+	if err == store.ErrNoSuchPerson {
+		log.Printf("Person not found for path: from=%s, to=%s", query.From, query.To)
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding path from %s to %s: %v", query.From, query.To, err)
+		http.Error(w, "Error finding path: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// parseList splits a comma-separated query parameter, ignoring blanks.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseDepth parses a traversal depth, falling back to def when value is
+// empty. Depths outside 1..max are rejected.
+func parseDepth(value string, def, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if depth < 1 || depth > max {
+		return 0, fmt.Errorf("must be between 1 and %d", max)
+	}
+	return depth, nil
+}
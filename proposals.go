@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+// propose stores a person or relationship from a contributor without the
+// editor role as a pending proposal and answers 202 Accepted with it.
+func propose(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+	user, _ := currentUser(r)
+	now := time.Now().Unix()
+	proposal.ID = uuid.New().String()
+	auditTarget(r, "proposal", proposal.ID)
+	proposal.Status = models.ProposalPending
+	proposal.AuthorID = user.ID
+	proposal.CreatedAt = now
+	proposal.UpdatedAt = now
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.AddProposal(ctx, proposal); err != nil {
+		log.Printf("Failed to add proposal: %v", err)
+		http.Error(w, "Failed to add proposal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s proposed %s %s", user.Login, proposal.Kind, proposal.ID)
+	writeJSONStatus(w, http.StatusAccepted, proposal)
+}
+
+// GET /proposals?status=&author_id=
+//
+// Moderators see every proposal; everyone else only their own.
+func handleProposals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /proposals", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := models.ProposalQuery{Status: params.Get("status"), AuthorID: params.Get("author_id")}
+	if user, _ := currentUser(r); !user.HasRole(models.RoleModerator) {
+		query.AuthorID = user.ID
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	proposals, err := db.GetProposals(ctx, query)
+	if err != nil {
+		log.Printf("Error fetching proposals: %v", err)
+		http.Error(w, "Error fetching proposals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, proposals)
+}
+
+// /proposal/:id and its review actions
+func handleProposalByID(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/proposal/")
+	if id == "" {
+		log.Printf("No proposal ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Proposal ID required", http.StatusBadRequest)
+		return
+	}
+
+	var handle func(w http.ResponseWriter, r *http.Request, proposal models.Proposal)
+	method := http.MethodPost
+	switch sub {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			method, handle = http.MethodGet, handleProposalGet
+		case http.MethodPut:
+			method, handle = http.MethodPut, handleProposalRevise
+		default:
+			log.Printf("Unsupported method %s for /proposal/:id", r.Method)
+			http.Error(w, "Only GET and PUT allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	case "approve":
+		handle = handleProposalApprove
+	case "reject":
+		handle = reviewProposal(models.ProposalRejected, models.ProposalPending, models.ProposalChangesRequested)
+	case "request-changes":
+		handle = reviewProposal(models.ProposalChangesRequested, models.ProposalPending)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only "+method+" allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	proposal, err := db.GetProposal(ctx, id)
+	user, _ := currentUser(r)
+	if err == store.ErrNoSuchProposal || (err == nil && proposal.AuthorID != user.ID && !user.HasRole(models.RoleModerator)) {
+		log.Printf("Proposal not found for ID: %s", id)
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching proposal %s: %v", id, err)
+		http.Error(w, "Error fetching proposal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sub != "" && !user.HasRole(models.RoleModerator) {
+		log.Printf("User %s lacks role %s for %s %s", user.Login, models.RoleModerator, r.Method, r.URL.Path)
+		http.Error(w, "Forbidden: requires the "+models.RoleModerator+" role", http.StatusForbidden)
+		return
+	}
+
+	handle(w, r, proposal)
+}
+
+// GET /proposal/:id
+func handleProposalGet(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+	writeJSON(w, proposal)
+}
+
+// PUT /proposal/:id
+//
+// Lets the author replace the proposed person or relationship, sending the
+// proposal back to the review queue.
+func handleProposalRevise(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+	if user, _ := currentUser(r); proposal.AuthorID != user.ID {
+		log.Printf("User %s cannot revise proposal %s of %s", user.Login, proposal.ID, proposal.AuthorID)
+		http.Error(w, "Only the author can revise a proposal", http.StatusForbidden)
+		return
+	}
+	if !proposal.Editable() {
+		log.Printf("Proposal %s is %s and cannot be revised", proposal.ID, proposal.Status)
+		http.Error(w, "Proposal is "+proposal.Status+" and cannot be revised", http.StatusConflict)
+		return
+	}
+
+	var input struct {
+		Person       *models.Person       `json:"person"`
+		Relationship *models.Relationship `json:"relationship"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Invalid input data in PUT /proposal/%s: %v", proposal.ID, err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch {
+	case proposal.Kind == models.EntityPerson && input.Person != nil:
+		if !validPerson(ctx, w, *input.Person) {
+			return
+		}
+		proposal.Person = input.Person
+	case proposal.Kind == models.EntityRelationship && input.Relationship != nil:
+		if !validRelationship(ctx, w, *input.Relationship) {
+			return
+		}
+		proposal.Relationship = input.Relationship
+	default:
+		log.Printf("Missing %s in PUT /proposal/%s", proposal.Kind, proposal.ID)
+		http.Error(w, "A "+proposal.Kind+" is required", http.StatusBadRequest)
+		return
+	}
+
+	fromStatus := proposal.Status
+	proposal.Status = models.ProposalPending
+	proposal.UpdatedAt = time.Now().Unix()
+	if !updateProposal(ctx, w, proposal, fromStatus) {
+		return
+	}
+	writeJSON(w, proposal)
+}
+
+// POST /proposal/:id/approve
+//
+// Claims the proposal as approved, then adds the person or relationship on
+// behalf of its author. If that fails, e.g. because the person ID was taken
+// meanwhile, the proposal goes back to pending.
+func handleProposalApprove(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+	if proposal.Status != models.ProposalPending {
+		log.Printf("Proposal %s is %s and cannot be approved", proposal.ID, proposal.Status)
+		http.Error(w, "Only pending proposals can be approved", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pending := proposal
+	moderator, _ := currentUser(r)
+	proposal.Status = models.ProposalApproved
+	proposal.ReviewerID = moderator.ID
+	proposal.Reason = ""
+	proposal.UpdatedAt = time.Now().Unix()
+	if proposal.Kind == models.EntityRelationship {
+		rel := *proposal.Relationship
+		rel.ID = uuid.New().String()
+		proposal.Relationship = &rel
+	}
+	if !updateProposal(ctx, w, proposal, models.ProposalPending) {
+		return
+	}
+
+	authorCtx := store.WithAuthor(ctx, proposal.AuthorID)
+	var err error
+	if proposal.Kind == models.EntityPerson {
+		person := *proposal.Person
+		person.CreatedAt = proposal.UpdatedAt
+		err = db.AddPerson(authorCtx, person)
+	} else {
+		err = db.AddRelationship(authorCtx, *proposal.Relationship)
+	}
+	if err != nil {
+		log.Printf("Failed to apply proposal %s: %v", proposal.ID, err)
+		if err := db.UpdateProposal(ctx, pending, models.ProposalApproved); err != nil {
+			log.Printf("Failed to return proposal %s to pending: %v", proposal.ID, err)
+		}
+		switch err {
+		case store.ErrPersonExists, store.ErrPersonsNotFound:
+			http.Error(w, "Cannot apply proposal: "+err.Error(), http.StatusConflict)
+		case store.ErrInvalidRelationship:
+			http.Error(w, "Cannot apply proposal: "+err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to apply proposal: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("Moderator %s approved proposal %s", moderator.Login, proposal.ID)
+	writeJSON(w, proposal)
+}
+
+// reviewProposal returns the handler for POST /proposal/:id/reject and
+// /request-changes, which move a proposal in one of fromStatuses to status
+// and require a reason for the author.
+func reviewProposal(status string, fromStatuses ...string) func(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+	return func(w http.ResponseWriter, r *http.Request, proposal models.Proposal) {
+		allowed := false
+		for _, from := range fromStatuses {
+			allowed = allowed || proposal.Status == from
+		}
+		if !allowed {
+			log.Printf("Proposal %s is %s and cannot become %s", proposal.ID, proposal.Status, status)
+			http.Error(w, "Proposal is "+proposal.Status+" and cannot become "+status, http.StatusConflict)
+			return
+		}
+
+		var input struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Reason == "" {
+			log.Printf("Missing reason in %s: %v", r.URL.Path, err)
+			http.Error(w, "A reason is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		moderator, _ := currentUser(r)
+		fromStatus := proposal.Status
+		proposal.Status = status
+		proposal.ReviewerID = moderator.ID
+		proposal.Reason = input.Reason
+		proposal.UpdatedAt = time.Now().Unix()
+		if !updateProposal(ctx, w, proposal, fromStatus) {
+			return
+		}
+
+		log.Printf("Moderator %s marked proposal %s as %s", moderator.Login, proposal.ID, status)
+		writeJSON(w, proposal)
+	}
+}
+
+// updateProposal stores proposal if it is still in fromStatus, writing the
+// error response itself when it cannot.
+func updateProposal(ctx context.Context, w http.ResponseWriter, proposal models.Proposal, fromStatus string) bool {
+	err := db.UpdateProposal(ctx, proposal, fromStatus)
+	switch err {
+	case nil:
+		return true
+	case store.ErrNoSuchProposal:
+		log.Printf("Proposal not found for ID: %s", proposal.ID)
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+	case store.ErrProposalChanged:
+		log.Printf("Proposal %s changed concurrently", proposal.ID)
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Failed to update proposal %s: %v", proposal.ID, err)
+		http.Error(w, "Failed to update proposal: "+err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
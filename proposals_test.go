@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+)
+
+func TestModeration(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp("admin", "", nil)
+	moderator := s.signUp("mod", models.RoleModerator, admin)
+	editor := s.signUp("editor", models.RoleEditor, admin)
+	viewer := s.signUp("viewer", "", nil)
+	other := s.signUp("other", "", nil)
+
+	var proposal models.Proposal
+	viewer.expect(http.StatusAccepted, http.MethodPost, "/person", models.Person{ID: "p1", Name: "Pat"}, &proposal)
+	if proposal.Status != models.ProposalPending || proposal.Person == nil || proposal.Person.ID != "p1" {
+		t.Fatalf("proposal = %+v", proposal)
+	}
+	if _, err := db.GetPerson(context.Background(), "p1"); err != store.ErrNoSuchPerson {
+		t.Errorf("proposed person was added: %v", err)
+	}
+
+	// Proposals are private to their authors and the moderators.
+	tests := []struct {
+		name   string
+		client *testClient
+		want   int
+	}{
+		{"author", viewer, 1},
+		{"other viewer", other, 0},
+		{"editor", editor, 0},
+		{"moderator", moderator, 1},
+		{"admin", admin, 1},
+	}
+	for _, tt := range tests {
+		var proposals []models.Proposal
+		tt.client.expect(http.StatusOK, http.MethodGet, "/proposals", nil, &proposals)
+		if len(proposals) != tt.want {
+			t.Errorf("%s sees %d proposals, want %d", tt.name, len(proposals), tt.want)
+		}
+	}
+	path := "/proposal/" + proposal.ID
+	other.expect(http.StatusNotFound, http.MethodGet, path, nil, nil)
+	viewer.expect(http.StatusOK, http.MethodGet, path, nil, nil)
+
+	// Only moderators review them, and other users do not see them at all.
+	reason := map[string]string{"reason": "needs a source"}
+	for _, action := range []string{"/approve", "/reject", "/request-changes"} {
+		viewer.expect(http.StatusForbidden, http.MethodPost, path+action, reason, nil)
+		editor.expect(http.StatusNotFound, http.MethodPost, path+action, reason, nil)
+		other.expect(http.StatusNotFound, http.MethodPost, path+action, reason, nil)
+	}
+
+	moderator.expect(http.StatusOK, http.MethodPost, path+"/approve", nil, &proposal)
+	if proposal.Status != models.ProposalApproved {
+		t.Errorf("approved proposal has status %s", proposal.Status)
+	}
+	person, err := db.GetPerson(context.Background(), "p1")
+	if err != nil || person.Name != "Pat" {
+		t.Errorf("approved person = %+v, %v", person, err)
+	}
+	revisions, err := db.GetRevisions(context.Background(), models.EntityRef{Type: models.EntityPerson, ID: "p1"})
+	if err != nil || len(revisions) != 1 || revisions[0].AuthorID != proposal.AuthorID {
+		t.Errorf("revisions of the approved person = %+v, %v, want one by the author", revisions, err)
+	}
+	moderator.expect(http.StatusConflict, http.MethodPost, path+"/approve", nil, nil)
+	moderator.expect(http.StatusConflict, http.MethodPost, path+"/reject", reason, nil)
+
+	// Editors write directly.
+	editor.expect(http.StatusCreated, http.MethodPost, "/person", models.Person{ID: "p2", Name: "Sam"}, nil)
+}
+
+func TestProposalReview(t *testing.T) {
+	s := newTestServer(t)
+	moderator := s.signUp("admin", "", nil)
+	viewer := s.signUp("viewer", "", nil)
+	reason := map[string]string{"reason": "needs a source"}
+
+	var proposal models.Proposal
+	viewer.expect(http.StatusAccepted, http.MethodPost, "/person", models.Person{ID: "p1", Name: "Pat"}, &proposal)
+	path := "/proposal/" + proposal.ID
+
+	moderator.expect(http.StatusBadRequest, http.MethodPost, path+"/request-changes", map[string]string{}, nil)
+	moderator.expect(http.StatusOK, http.MethodPost, path+"/request-changes", reason, &proposal)
+	if proposal.Status != models.ProposalChangesRequested || proposal.Reason != reason["reason"] {
+		t.Errorf("proposal = %+v, want changes requested", proposal)
+	}
+	moderator.expect(http.StatusConflict, http.MethodPost, path+"/approve", nil, nil)
+	moderator.expect(http.StatusOK, http.MethodPost, path+"/reject", reason, &proposal)
+	if proposal.Status != models.ProposalRejected {
+		t.Errorf("proposal = %+v, want rejected", proposal)
+	}
+	moderator.expect(http.StatusConflict, http.MethodPost, path+"/approve", nil, nil)
+	if _, err := db.GetPerson(context.Background(), "p1"); err != store.ErrNoSuchPerson {
+		t.Errorf("rejected person was added: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimit allows requests per period, in bursts of up to requests.
+type rateLimit struct {
+	requests int
+	period   time.Duration
+}
+
+// rateLimiter is a token bucket per client: each bucket holds up to
+// limit.requests tokens, refills at limit.requests per limit.period and
+// every request takes one token.
+type rateLimiter struct {
+	limit rateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil for a zero limit, which limitRate treats as no
+// limit at all.
+func newRateLimiter(limit rateLimit) *rateLimiter {
+	if limit.requests == 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+// take spends a token of key's bucket, or reports how long to wait until
+// one is available.
+func (l *rateLimiter) take(key string, now time.Time) (retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	capacity := float64(l.limit.requests)
+	perSecond := capacity / l.limit.period.Seconds()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+}
+
+// prune forgets buckets that have refilled completely, at most once per
+// period. Callers must hold l.mu.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.limit.period {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.limit.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitRate rejects requests from clients that exceed limiter with 429 Too
+// Many Requests. A nil limiter lets everything through.
+func limitRate(limiter *rateLimiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if wait := limiter.take(ip, time.Now()); wait > 0 {
+			log.Printf("Rate limit exceeded by %s for %s %s", ip, r.Method, r.URL.Path)
+			tooManyRequests(w, wait, "Too many requests, try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooManyRequests answers 429 with a Retry-After header in whole seconds.
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// rateLimiters configures the limit for all requests per client from
+// RATE_LIMIT and the stricter one for /login and /register from
+// AUTH_RATE_LIMIT.
+func rateLimiters() (api, auth *rateLimiter, err error) {
+	apiLimit, err := rateEnv("RATE_LIMIT", rateLimit{requests: 300, period: time.Minute})
+	if err != nil {
+		return nil, nil, err
+	}
+	authLimit, err := rateEnv("AUTH_RATE_LIMIT", rateLimit{requests: 20, period: time.Minute})
+	if err != nil {
+		return nil, nil, err
+	}
+	return newRateLimiter(apiLimit), newRateLimiter(authLimit), nil
+}
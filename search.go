@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSearchLimit  = 20
+	defaultSuggestLimit = 10
+	maxSearchLimit      = 100
+)
+
+// GET /search?q=&limit=
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /search", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		log.Printf("Missing q in /search")
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		log.Printf("Invalid limit in /search: %v", err)
+		http.Error(w, "Invalid limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	results, err := db.SearchPersons(ctx, q, limit)
+	if err != nil {
+		log.Printf("Error searching persons for %q: %v", q, err)
+		http.Error(w, "Error searching persons: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, results)
+}
+
+// GET /search/suggest?q=&limit=
+func handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /search/suggest", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultSuggestLimit, maxSearchLimit)
+	if err != nil {
+		log.Printf("Invalid limit in /search/suggest: %v", err)
+		http.Error(w, "Invalid limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	q := r.URL.Query().Get("q")
+	suggestions, err := db.SuggestPersons(ctx, q, limit)
+	if err != nil {
+		log.Printf("Error suggesting persons for %q: %v", q, err)
+		http.Error(w, "Error suggesting persons: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, suggestions)
+}
+
+// parseLimit parses a result limit, falling back to def when value is empty.
+// Limits outside 1..max are rejected.
+func parseLimit(value string, def, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > max {
+		return 0, fmt.Errorf("must be between 1 and %d", max)
+	}
+	return limit, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// sessionTTL is how long a session lasts without activity; every use
+	// extends it again.
+	sessionTTL = 24 * time.Hour
+	// sessionTouchInterval limits how often activity on a session is
+	// written to the store.
+	sessionTouchInterval = time.Minute
+
+	defaultSessionSweepInterval = 10 * time.Minute
+	maxUserAgentLength          = 256
+)
+
+// trustProxy makes clientIP believe the X-Forwarded-For header, which is only
+// safe behind a reverse proxy that sets it.
+var trustProxy = os.Getenv("TRUST_PROXY") == "true"
+
+// sessionInfo describes a session to its owner. The session ID itself is the
+// cookie secret, so sessions are identified by a hash of it instead.
+type sessionInfo struct {
+	ID         string `json:"id"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"`
+}
+
+// /sessions: GET lists the caller's active sessions, DELETE revokes all but
+// the current one.
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if !sessionOnly(w, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	current := currentSessionID(r)
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := db.GetUserSessions(ctx, user.ID, time.Now().Unix())
+		if err != nil {
+			log.Printf("Error fetching sessions of user %s: %v", user.ID, err)
+			http.Error(w, "Error fetching sessions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		infos := make([]sessionInfo, 0, len(sessions))
+		for _, session := range sessions {
+			infos = append(infos, sessionInfo{
+				ID:         sessionHandle(session.ID),
+				CreatedAt:  session.CreatedAt,
+				LastSeenAt: session.LastSeenAt,
+				ExpiresAt:  session.ExpiresAt,
+				UserAgent:  session.UserAgent,
+				IP:         session.IP,
+				Current:    session.ID == current,
+			})
+		}
+		writeJSON(w, infos)
+	case http.MethodDelete:
+		revoked, err := db.DeleteUserSessions(ctx, user.ID, current)
+		if err != nil {
+			log.Printf("Failed to revoke sessions of user %s: %v", user.ID, err)
+			http.Error(w, "Failed to revoke sessions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s revoked %d other sessions", user.Login, revoked)
+		writeJSON(w, struct {
+			Revoked int64 `json:"revoked"`
+		}{revoked})
+	default:
+		log.Printf("Unsupported method %s for /sessions", r.Method)
+		http.Error(w, "Only GET and DELETE allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DELETE /session/:id, where the ID is the one listed by GET /sessions.
+func handleSessionByID(w http.ResponseWriter, r *http.Request) {
+	if !sessionOnly(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		log.Printf("Unsupported method %s for /session/:id", r.Method)
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, sub := resourcePath(r.URL.Path, "/session/")
+	if id == "" || sub != "" {
+		log.Printf("Invalid session path: %s", r.URL.Path)
+		http.Error(w, "Session ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	sessions, err := db.GetUserSessions(ctx, user.ID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error fetching sessions of user %s: %v", user.ID, err)
+		http.Error(w, "Error fetching sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, session := range sessions {
+		if sessionHandle(session.ID) != id {
+			continue
+		}
+		if err := db.DeleteSession(ctx, session.ID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", id, err)
+			http.Error(w, "Failed to revoke session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s revoked session %s", user.Login, id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	log.Printf("Session %s not found for user %s", id, user.ID)
+	http.Error(w, "Session not found", http.StatusNotFound)
+}
+
+// newSession starts a session for the user signing in with r.
+func newSession(r *http.Request, userID string) models.Session {
+	now := time.Now()
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return models.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		ExpiresAt:  now.Add(sessionTTL).Unix(),
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+		UserAgent:  userAgent,
+		IP:         clientIP(r),
+	}
+}
+
+// activeSession loads the unexpired session named by the request's cookie
+// and slides its expiry forward, writing the 401 response itself when there
+// is none.
+func activeSession(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.Session, bool) {
+	sessionID, err := r.Cookie("session_id")
+	if err != nil {
+		log.Printf("No session_id cookie in request: %s", r.URL.Path)
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return models.Session{}, false
+	}
+
+	now := time.Now()
+	session, err := db.GetSession(ctx, sessionID.Value)
+	if err != nil || session.ExpiresAt < now.Unix() {
+		log.Printf("Session inactive or expired for ID %s: %v", sessionID.Value, err)
+		http.Error(w, "Session inactive or expired", http.StatusUnauthorized)
+		return models.Session{}, false
+	}
+
+	if now.Sub(time.Unix(session.LastSeenAt, 0)) >= sessionTouchInterval {
+		session.LastSeenAt = now.Unix()
+		session.ExpiresAt = now.Add(sessionTTL).Unix()
+		if err := db.TouchSession(ctx, session.ID, session.LastSeenAt, session.ExpiresAt); err != nil {
+			log.Printf("Error renewing session %s: %v", session.ID, err)
+		} else {
+			setSessionCookie(w, session)
+		}
+	}
+	return session, true
+}
+
+func setSessionCookie(w http.ResponseWriter, session models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // Changed to Lax for better compatibility
+		// Secure: true, // Uncomment in production with HTTPS
+	})
+}
+
+// currentSessionID returns the ID of the session cookie sent with r, if any.
+func currentSessionID(r *http.Request) string {
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// sessionHandle derives the public identifier of a session from its ID.
+func sessionHandle(sessionID string) string {
+	return hashToken(sessionID)[:16]
+}
+
+// clientIP returns the address of the client that sent r.
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sweepSessions deletes expired sessions and mailed tokens every interval
+// until ctx is done.
+func sweepSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			now := time.Now().Unix()
+			deleted, err := db.DeleteExpiredSessions(sweepCtx, now)
+			if err != nil {
+				log.Printf("Error deleting expired sessions: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d expired sessions", deleted)
+			}
+			deleted, err = db.DeleteExpiredOneTimeTokens(sweepCtx, now)
+			if err != nil {
+				log.Printf("Error deleting expired one-time tokens: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d expired one-time tokens", deleted)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+// GET /sources
+func handleSourcesGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Printf("Unsupported method %s for /sources", r.Method)
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sources, err := db.GetSources(ctx)
+	if err != nil {
+		log.Printf("Error fetching sources: %v", err)
+		http.Error(w, "Error fetching sources: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, sources)
+}
+
+// POST /source
+func handleSourcePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /source (POST)", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var source models.Source
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		log.Printf("Invalid input data in POST /source: %v", err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSource(source); err != nil {
+		log.Printf("Invalid source in POST /source: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source.ID = uuid.New().String()
+	source.CreatedAt = time.Now().Unix()
+	auditTarget(r, "source", source.ID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.AddSource(ctx, source); err != nil {
+		log.Printf("Failed to add source: %v", err)
+		http.Error(w, "Failed to add source: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, source)
+}
+
+// /source/:id and /source/:id/citations
+func handleSourceByID(w http.ResponseWriter, r *http.Request) {
+	id, sub := resourcePath(r.URL.Path, "/source/")
+	if id == "" {
+		log.Printf("No source ID provided in request: %s", r.URL.Path)
+		http.Error(w, "Source ID required", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case sub == "citations" && r.Method == http.MethodGet:
+		handleSourceCitations(w, r, id)
+	case sub != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet:
+		handleSourceGet(w, r, id)
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleSourceUpdate(w, r, id)
+		})).ServeHTTP(w, r)
+	case r.Method == http.MethodDelete:
+		requireRole(models.RoleEditor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleSourceDelete(w, r, id)
+		})).ServeHTTP(w, r)
+	default:
+		log.Printf("Unsupported method %s for /source/:id", r.Method)
+		http.Error(w, "Only GET, PUT, PATCH and DELETE allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /source/:id
+func handleSourceGet(w http.ResponseWriter, r *http.Request, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	source, err := db.GetSource(ctx, id)
+	if err == store.ErrNoSuchSource {
+		log.Printf("Source not found for ID: %s", id)
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching source %s: %v", id, err)
+		http.Error(w, "Error fetching source: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, source)
+}
+
+// PUT/PATCH /source/:id
+func handleSourceUpdate(w http.ResponseWriter, r *http.Request, id string) {
+	var update models.SourceUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("Invalid input data in %s /source/%s: %v", r.Method, id, err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	current, err := db.GetSource(ctx, id)
+	if err == store.ErrNoSuchSource {
+		log.Printf("Source not found for ID: %s", id)
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching source %s: %v", id, err)
+		http.Error(w, "Error fetching source: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := validateSource(update.Apply(current)); err != nil {
+		log.Printf("Invalid source in %s /source/%s: %v", r.Method, id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source, err := db.UpdateSource(ctx, id, update)
+	if err == store.ErrNoSuchSource {
+		log.Printf("Source not found for ID: %s", id)
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update source %s: %v", id, err)
+		http.Error(w, "Failed to update source: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, source)
+}
+
+// DELETE /source/:id
+func handleSourceDelete(w http.ResponseWriter, r *http.Request, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.DeleteSource(ctx, id); err != nil {
+		switch err {
+		case store.ErrNoSuchSource:
+			log.Printf("Source not found for ID: %s", id)
+			http.Error(w, "Source not found", http.StatusNotFound)
+		case store.ErrSourceInUse:
+			log.Printf("Source %s is still cited", id)
+			http.Error(w, "Source is still cited; remove the citations first", http.StatusConflict)
+		default:
+			log.Printf("Failed to delete source %s: %v", id, err)
+			http.Error(w, "Failed to delete source: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /source/:id/citations
+func handleSourceCitations(w http.ResponseWriter, r *http.Request, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	citations, err := db.GetCitations(ctx, id)
+	if err == store.ErrNoSuchSource {
+		log.Printf("Source not found for ID: %s", id)
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching citations of source %s: %v", id, err)
+		http.Error(w, "Error fetching citations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, citations)
+}
+
+// POST /person/:id/sources, DELETE /person/:id/sources/:sourceId and the
+// same under /relationship/:id. sub is the path after the entity ID.
+func handleCitation(w http.ResponseWriter, r *http.Request, target models.EntityRef, sub string) {
+	_, sourceID, _ := strings.Cut(sub, "/")
+
+	switch {
+	case r.Method == http.MethodPost && sourceID == "":
+		var input struct {
+			SourceID string `json:"source_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.SourceID == "" {
+			log.Printf("Invalid input data in POST /%s/%s/sources: %v", target.Type, target.ID, err)
+			http.Error(w, "source_id is required", http.StatusBadRequest)
+			return
+		}
+		sourceID = input.SourceID
+	case r.Method == http.MethodDelete && sourceID != "":
+	default:
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only POST .../sources and DELETE .../sources/:id allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if r.Method == http.MethodPost {
+		err = db.CiteSource(ctx, target, sourceID)
+	} else {
+		err = db.UnciteSource(ctx, target, sourceID)
+	}
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case store.ErrNoSuchPerson, store.ErrNoSuchRelationship, store.ErrNoSuchSource:
+		log.Printf("Citation of %s by %s %s failed: %v", sourceID, target.Type, target.ID, err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("Failed to update citation of %s by %s %s: %v", sourceID, target.Type, target.ID, err)
+		http.Error(w, "Failed to update citation: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func validateSource(source models.Source) error {
+	u, err := url.ParseRequestURI(source.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if source.AccessedAt != "" {
+		if _, err := time.Parse(time.DateOnly, source.AccessedAt); err != nil {
+			return errors.New("accessed_at must be YYYY-MM-DD")
+		}
+	}
+	return nil
+}
+
+// validSourceIDs reports whether every ID names an existing source, writing
+// the error response itself when it does not.
+func validSourceIDs(ctx context.Context, w http.ResponseWriter, ids []string) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	sources, err := db.GetSourcesByIDs(ctx, ids)
+	if err != nil {
+		log.Printf("Error fetching sources %v: %v", ids, err)
+		http.Error(w, "Error fetching sources: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	known := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		known[source.ID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			log.Printf("Unknown source ID: %s", id)
+			http.Error(w, "Unknown source ID: "+id, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// withSources fills graph.Sources with every source its nodes and edges cite.
+func withSources(ctx context.Context, graph models.Graph) (models.Graph, error) {
+	sources, err := db.GetSourcesByIDs(ctx, graph.CitedSourceIDs())
+	if err != nil {
+		return models.Graph{}, err
+	}
+	graph.Sources = sources
+	return graph, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"github.com/google/uuid"
+)
+
+const (
+	// tokenPrefix makes API tokens easy to recognise, e.g. by secret scanners.
+	tokenPrefix = "est_"
+
+	defaultTokenDays = 90
+	maxTokenDays     = 365
+)
+
+// /tokens: GET lists the caller's tokens, POST creates one.
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	if !sessionOnly(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleTokensGet(w, r)
+	case http.MethodPost:
+		handleTokenPost(w, r)
+	default:
+		log.Printf("Unsupported method %s for /tokens", r.Method)
+		http.Error(w, "Only GET and POST allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /tokens
+func handleTokensGet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	tokens, err := db.GetTokens(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error fetching tokens of user %s: %v", user.ID, err)
+		http.Error(w, "Error fetching tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, tokens)
+}
+
+// POST /tokens
+//
+// The response is the only place the token itself ever appears; only its
+// hash is stored.
+func handleTokenPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Invalid input data in POST /tokens: %v", err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	if input.Name == "" || len(input.Scopes) == 0 {
+		log.Printf("Missing required fields in POST /tokens")
+		http.Error(w, "Name and scopes are required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !models.ValidScope(scope) {
+			log.Printf("Unknown scope %q in POST /tokens", scope)
+			http.Error(w, "Scopes must be among: "+strings.Join(models.Scopes, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = defaultTokenDays
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxTokenDays {
+		log.Printf("Invalid expires_in_days in POST /tokens: %d", input.ExpiresInDays)
+		http.Error(w, "expires_in_days must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newTokenSecret()
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, "Error generating token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, _ := currentUser(r)
+	now := time.Now()
+	token := models.APIToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		Hash:      hashToken(secret),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.AddDate(0, 0, input.ExpiresInDays).Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.AddToken(ctx, token); err != nil {
+		log.Printf("Failed to add token: %v", err)
+		http.Error(w, "Failed to add token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s created API token %s (%s)", user.Login, token.ID, token.Name)
+	auditTarget(r, "token", token.ID)
+	writeJSONStatus(w, http.StatusCreated, struct {
+		models.APIToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+// DELETE /token/:id
+func handleTokenByID(w http.ResponseWriter, r *http.Request) {
+	if !sessionOnly(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		log.Printf("Unsupported method %s for /token/:id", r.Method)
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, sub := resourcePath(r.URL.Path, "/token/")
+	if id == "" || sub != "" {
+		log.Printf("Invalid token path: %s", r.URL.Path)
+		http.Error(w, "Token ID required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, _ := currentUser(r)
+	if err := db.DeleteToken(ctx, user.ID, id); err != nil {
+		if err == store.ErrNoSuchToken {
+			log.Printf("Token %s not found for user %s", id, user.ID)
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to revoke token %s: %v", id, err)
+		http.Error(w, "Failed to revoke token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s revoked API token %s", user.Login, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionOnly refuses requests authenticated by an API token, so that a
+// leaked token cannot be used to mint further tokens.
+func sessionOnly(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := currentToken(r); ok {
+		log.Printf("Rejecting token-authenticated request to %s", r.URL.Path)
+		http.Error(w, "Tokens can only be managed from a browser session", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func newTokenSecret() (string, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + secret, nil
+}
+
+// randomSecret returns 32 random bytes encoded for use in URLs.
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/store"
+	"establishment/v1/establishment/totp"
+)
+
+const (
+	// totpIssuer names the service in authenticator apps.
+	totpIssuer = "Political Connections"
+
+	recoveryCodeCount = 10
+	loginChallengeTTL = 5 * time.Minute
+)
+
+// secondFactor is the input proving possession of the second factor: a
+// current TOTP code or one of the recovery codes.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// /2fa/enroll, /2fa/confirm, /2fa/disable and /2fa/recovery-codes, all POST
+func handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !sessionOnly(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for %s", r.Method, r.URL.Path)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/2fa/") {
+	case "enroll":
+		handleTwoFactorEnroll(w, r)
+	case "confirm":
+		handleTwoFactorConfirm(w, r)
+	case "disable":
+		handleTwoFactorDisable(w, r)
+	case "recovery-codes":
+		handleRecoveryCodes(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// POST /2fa/enroll
+//
+// Generates a new secret and returns it with the otpauth:// URI to show as
+// a QR code. Two-factor authentication only takes effect once a code from
+// the app is confirmed via /2fa/confirm.
+func handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	if user.TOTPEnabled {
+		log.Printf("User %s already has two-factor authentication", user.Login)
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		http.Error(w, "Error generating secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.SetTOTP(ctx, user.ID, secret, false, nil); err != nil {
+		log.Printf("Failed to store TOTP secret of user %s: %v", user.ID, err)
+		http.Error(w, "Failed to start enrollment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s started two-factor enrollment", user.Login)
+	writeJSON(w, struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{secret, totp.ProvisioningURI(totpIssuer, user.Login, secret)})
+}
+
+// POST /2fa/confirm {"code"}
+//
+// Enables two-factor authentication and returns the recovery codes, which
+// are shown only this once.
+func handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		log.Printf("User %s has no two-factor enrollment to confirm", user.Login)
+		http.Error(w, "Start enrollment via /2fa/enroll first", http.StatusConflict)
+		return
+	}
+
+	var input secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		log.Printf("Missing code in POST /2fa/confirm: %v", err)
+		http.Error(w, "A code is required", http.StatusBadRequest)
+		return
+	}
+	counter, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		log.Printf("Invalid TOTP code confirming enrollment of %s", user.Login)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Error generating recovery codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.SetTOTP(ctx, user.ID, user.TOTPSecret, true, hashes); err != nil {
+		log.Printf("Failed to enable two-factor authentication of user %s: %v", user.ID, err)
+		http.Error(w, "Failed to enable two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.AcceptTOTPCounter(ctx, user.ID, counter); err != nil && err != store.ErrCodeUsed {
+		log.Printf("Error recording TOTP use of user %s: %v", user.ID, err)
+	}
+
+	log.Printf("User %s enabled two-factor authentication", user.Login)
+	writeJSON(w, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+}
+
+// POST /2fa/disable {"code"} or {"recovery_code"}
+func handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := verifiedSecondFactor(ctx, w, r)
+	if !ok {
+		return
+	}
+	if err := db.SetTOTP(ctx, user.ID, "", false, nil); err != nil {
+		log.Printf("Failed to disable two-factor authentication of user %s: %v", user.ID, err)
+		http.Error(w, "Failed to disable two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s disabled two-factor authentication", user.Login)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /2fa/recovery-codes {"code"} or {"recovery_code"}
+//
+// Replaces all recovery codes with new ones.
+func handleRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := verifiedSecondFactor(ctx, w, r)
+	if !ok {
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Error generating recovery codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.SetTOTP(ctx, user.ID, user.TOTPSecret, true, hashes); err != nil {
+		log.Printf("Failed to replace recovery codes of user %s: %v", user.ID, err)
+		http.Error(w, "Failed to replace recovery codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s replaced their recovery codes", user.Login)
+	writeJSON(w, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+}
+
+// POST /login/2fa {"challenge_token", "code"} or {"challenge_token", "recovery_code"}
+//
+// Completes a login started by /login for a user with two-factor
+// authentication. A challenge works once, so a wrong code means starting
+// over with the password.
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Printf("Unsupported method %s for /login/2fa", r.Method)
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Invalid input data in POST /login/2fa: %v", err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	challenge, ok := useOneTimeToken(ctx, w, input.ChallengeToken, models.PurposeLoginChallenge)
+	if !ok {
+		return
+	}
+	user, err := db.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		log.Printf("User %s of login challenge not found: %v", challenge.UserID, err)
+		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		return
+	}
+	auditUser(r, user.ID, user.Login)
+
+	ip := clientIP(r)
+	if wait := loginGuard.wait(user.Login, ip, time.Now()); wait > 0 {
+		log.Printf("Throttling second factor for %s from %s for %v", user.Login, ip, wait)
+		tooManyRequests(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+	ok, err = checkSecondFactor(ctx, user, input.secondFactor)
+	if err != nil {
+		log.Printf("Error checking second factor of %s: %v", user.Login, err)
+		http.Error(w, "Error checking code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		log.Printf("Invalid second factor for login: %s", user.Login)
+		loginFailed(user.Login, ip)
+		http.Error(w, "Invalid code, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	startSession(ctx, w, r, user)
+}
+
+// verifiedSecondFactor reads a secondFactor from the request body and checks
+// it for the current user, writing the error response itself when it is
+// missing or wrong.
+func verifiedSecondFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	user, _ := currentUser(r)
+	if !user.TOTPEnabled {
+		log.Printf("User %s has no two-factor authentication", user.Login)
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return models.User{}, false
+	}
+
+	var input secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Invalid input data in POST %s: %v", r.URL.Path, err)
+		http.Error(w, "Invalid input data", http.StatusBadRequest)
+		return models.User{}, false
+	}
+	ok, err := checkSecondFactor(ctx, user, input)
+	if err != nil {
+		log.Printf("Error checking second factor of %s: %v", user.Login, err)
+		http.Error(w, "Error checking code: "+err.Error(), http.StatusInternalServerError)
+		return models.User{}, false
+	}
+	if !ok {
+		log.Printf("Invalid second factor from %s for %s", user.Login, r.URL.Path)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// checkSecondFactor reports whether input holds a TOTP code or recovery code
+// of user that has not been used before, and marks it used.
+func checkSecondFactor(ctx context.Context, user models.User, input secondFactor) (bool, error) {
+	var err error
+	switch {
+	case input.Code != "":
+		counter, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err = db.AcceptTOTPCounter(ctx, user.ID, counter)
+	case input.RecoveryCode != "":
+		err = db.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(input.RecoveryCode)))
+	default:
+		return false, nil
+	}
+	if err == store.ErrCodeUsed {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// newRecoveryCodes returns recoveryCodeCount codes like "abcd-efgh" along
+// with the hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// twoFactorRequired tells whether the admins require two-factor
+// authentication for editors and user holds the editor role or above without
+// having enabled it.
+func twoFactorRequired(ctx context.Context, user models.User) (bool, error) {
+	if user.TOTPEnabled || !user.HasRole(models.RoleEditor) {
+		return false, nil
+	}
+	settings, err := db.GetSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return settings.Require2FAForEditors, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"establishment/v1/establishment/models"
+	"establishment/v1/establishment/totp"
+)
+
+func totpCode(t *testing.T, secret string, counter int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enableTwoFactor enrolls the client's user in two-factor authentication. It
+// returns the secret, the counter of the code that confirmed it, which
+// cannot be used again, and the recovery codes.
+func (c *testClient) enableTwoFactor() (secret string, counter int64, recoveryCodes []string) {
+	c.t.Helper()
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	c.expect(http.StatusOK, http.MethodPost, "/2fa/enroll", nil, &enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+		c.t.Errorf("enrollment URI = %q", enrollment.URI)
+	}
+
+	counter = totp.Counter(time.Now())
+	c.expect(http.StatusUnauthorized, http.MethodPost, "/2fa/confirm", secondFactor{Code: totpCode(c.t, enrollment.Secret, counter-5)}, nil)
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	c.expect(http.StatusOK, http.MethodPost, "/2fa/confirm", secondFactor{Code: totpCode(c.t, enrollment.Secret, counter)}, &confirmation)
+	if len(confirmation.RecoveryCodes) != recoveryCodeCount {
+		c.t.Fatalf("got %d recovery codes, want %d", len(confirmation.RecoveryCodes), recoveryCodeCount)
+	}
+	return enrollment.Secret, counter, confirmation.RecoveryCodes
+}
+
+// startLogin checks the password of a user with two-factor authentication
+// and returns the challenge to answer at /login/2fa.
+func (c *testClient) startLogin(login string) string {
+	c.t.Helper()
+	var out struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+		CSRFToken         string `json:"csrf_token"`
+	}
+	c.expect(http.StatusOK, http.MethodPost, "/login", map[string]string{"login": login, "password": password(login)}, &out)
+	if !out.TwoFactorRequired || out.ChallengeToken == "" || out.CSRFToken != "" {
+		c.t.Fatalf("login of %s = %+v, want a challenge only", login, out)
+	}
+	return out.ChallengeToken
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signUp("alice", "", nil)
+	secret, counter, recoveryCodes := alice.enableTwoFactor()
+	var session struct {
+		TOTPEnabled bool `json:"totp_enabled"`
+	}
+	alice.expect(http.StatusOK, http.MethodGet, "/check-session", nil, &session)
+	if !session.TOTPEnabled {
+		t.Error("two-factor authentication is not enabled after confirming it")
+	}
+
+	next := totpCode(t, secret, counter+1)
+	tests := []struct {
+		name   string
+		factor secondFactor
+		// reuse answers the challenge of the previous test again.
+		reuse bool
+		want  int
+	}{
+		{"code used to confirm", secondFactor{Code: totpCode(t, secret, counter)}, false, http.StatusUnauthorized},
+		{"spent challenge", secondFactor{Code: next}, true, http.StatusBadRequest},
+		{"fresh code", secondFactor{Code: next}, false, http.StatusOK},
+		{"code used before", secondFactor{Code: next}, false, http.StatusUnauthorized},
+		{"no factor", secondFactor{}, false, http.StatusUnauthorized},
+		{"recovery code", secondFactor{RecoveryCode: recoveryCodes[0]}, false, http.StatusOK},
+		{"recovery code used before", secondFactor{RecoveryCode: recoveryCodes[0]}, false, http.StatusUnauthorized},
+		{"recovery code as typed", secondFactor{RecoveryCode: strings.ToUpper(strings.Replace(recoveryCodes[1], "-", " ", 1))}, false, http.StatusOK},
+	}
+	var challenge string
+	for _, tt := range tests {
+		c := s.client()
+		if !tt.reuse {
+			challenge = c.startLogin("alice")
+			c.expect(http.StatusUnauthorized, http.MethodGet, "/check-session", nil, nil)
+		}
+		input := struct {
+			ChallengeToken string `json:"challenge_token"`
+			secondFactor
+		}{challenge, tt.factor}
+		resp, body := c.do(http.MethodPost, "/login/2fa", input)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: POST /login/2fa = %d %q, want %d", tt.name, resp.StatusCode, body, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK {
+			if !strings.Contains(body, "csrf_token") {
+				t.Errorf("%s: POST /login/2fa = %q, want a CSRF token", tt.name, body)
+			}
+			c.expect(http.StatusOK, http.MethodGet, "/check-session", nil, nil)
+		}
+	}
+}
+
+func TestRequireTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp("admin", "", nil)
+	editor := s.signUp("editor", models.RoleEditor, admin)
+	viewer := s.signUp("viewer", "", nil)
+	require := models.Settings{Require2FAForEditors: true}
+
+	// The admin would lock themselves out otherwise.
+	admin.expect(http.StatusConflict, http.MethodPut, "/admin/settings", require, nil)
+	admin.enableTwoFactor()
+	admin.expect(http.StatusOK, http.MethodPut, "/admin/settings", require, nil)
+
+	tests := []struct {
+		name   string
+		client *testClient
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"editor writes", editor, http.MethodPost, "/person", models.Person{ID: "p1", Name: "Pat"}, http.StatusForbidden},
+		{"editor reads", editor, http.MethodGet, "/proposals", nil, http.StatusForbidden},
+		{"editor reads public data", editor, http.MethodGet, "/graph", nil, http.StatusOK},
+		{"viewer proposes", viewer, http.MethodPost, "/person", models.Person{ID: "p2", Name: "Sam"}, http.StatusAccepted},
+		{"admin with two factors", admin, http.MethodPost, "/person", models.Person{ID: "p3", Name: "Lee"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if resp, body := tt.client.do(tt.method, tt.path, tt.body); resp.StatusCode != tt.want {
+			t.Errorf("%s: %s %s = %d %q, want %d", tt.name, tt.method, tt.path, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	// The editor can still enroll, and is let through once they have.
+	editor.enableTwoFactor()
+	editor.expect(http.StatusCreated, http.MethodPost, "/person", models.Person{ID: "p1", Name: "Pat"}, nil)
+}